@@ -0,0 +1,95 @@
+package natsbackend
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	v1alpha1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/account/v1alpha1"
+)
+
+// AuthCalloutConfig names the user issues and the xkey of the
+// authorization callout of an account. Their public keys are filled
+// into the authorization claims when the account JWT is signed.
+// +k8s:deepcopy-gen=true
+type AuthCalloutConfig struct {
+	// AuthUsers are names of user issues of the account that handle the callout requests
+	AuthUsers []string `json:"authUsers,omitempty"`
+	// XKey is the name of the account xkey the callout requests are encrypted for
+	XKey string `json:"xkey,omitempty"`
+}
+
+// resolveAuthCallout returns the authorization claims of the account with the
+// public keys of the named auth users and xkey. Auth users and xkeys whose
+// nkeys do not exist yet are left out.
+func resolveAuthCallout(ctx context.Context, storage logical.Storage, issue IssueAccountStorage) (v1alpha1.ExternalAuthorization, error) {
+	authorization := *issue.Claims.Authorization.DeepCopy()
+	if issue.AuthCallout == nil {
+		return authorization, nil
+	}
+
+	for _, user := range issue.AuthCallout.AuthUsers {
+		publicKey, err := readNkeyPublicKey(ctx, storage, getUserNkeyPath(issue.Operator, issue.Account, user))
+		if err != nil {
+			return authorization, err
+		}
+		if publicKey == "" {
+			log.Warn().
+				Str("operator", issue.Operator).Str("account", issue.Account).
+				Msgf("auth callout user nkey does not exist: %s", user)
+			continue
+		}
+		authorization.AuthUsers = append(authorization.AuthUsers, publicKey)
+	}
+
+	if issue.AuthCallout.XKey != "" {
+		publicKey, err := readNkeyPublicKey(ctx, storage, getAccountXKeyPath(issue.Operator, issue.Account, issue.AuthCallout.XKey))
+		if err != nil {
+			return authorization, err
+		}
+		if publicKey == "" {
+			log.Warn().
+				Str("operator", issue.Operator).Str("account", issue.Account).
+				Msgf("auth callout xkey does not exist: %s", issue.AuthCallout.XKey)
+		}
+		authorization.XKey = publicKey
+	}
+	return authorization, nil
+}
+
+// refreshAuthCalloutAccount re-issues the account if its authorization callout
+// names the user or the xkey, so that it publishes their current public keys
+func refreshAuthCalloutAccount(ctx context.Context, storage logical.Storage, operator string, account string, user string, xkey string) error {
+	issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator: operator,
+		Account:  account,
+	})
+	if err != nil || issue == nil || issue.AuthCallout == nil {
+		return err
+	}
+	if (user == "" || !containsString(issue.AuthCallout.AuthUsers, user)) &&
+		(xkey == "" || issue.AuthCallout.XKey != xkey) {
+		return nil
+	}
+
+	log.Info().
+		Str("operator", operator).Str("account", account).
+		Msg("auth callout keys modified, account will be updated")
+	return refreshAccount(ctx, storage, issue)
+}
+
+// readNkeyPublicKey returns the public key of the stored nkey.
+// An empty string is returned if the nkey does not exist.
+func readNkeyPublicKey(ctx context.Context, storage logical.Storage, path string) (string, error) {
+	nkey, err := readNkey(ctx, storage, path)
+	if err != nil || nkey == nil {
+		return "", err
+	}
+	keyPair, err := nkeys.FromSeed(nkey.Seed)
+	if err != nil {
+		return "", err
+	}
+	return keyPair.PublicKey()
+}
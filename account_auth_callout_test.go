@@ -0,0 +1,129 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthCallout(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	readAuthorization := func() jwt.ExternalAuthorization {
+		stored, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(stored.JWT)
+		assert.NoError(t, err)
+		return claims.Authorization
+	}
+	readPublicKey := func(path string) string {
+		publicKey, err := readNkeyPublicKey(context.Background(), reqStorage, path)
+		assert.NoError(t, err)
+		return publicKey
+	}
+
+	resp := write("issue/operator/op1", nil)
+	assert.False(t, resp.IsError())
+
+	t.Run("Test account names auth user and xkey", func(t *testing.T) {
+		allowed, err := placeholderPublicKey(nkeys.PrefixByteAccount)
+		assert.NoError(t, err)
+		resp := write("issue/operator/op1/account/ac1", map[string]interface{}{
+			"authCallout": map[string]interface{}{
+				"authUsers": []interface{}{"auth"},
+				"xkey":      "xk1",
+			},
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"authorization": map[string]interface{}{
+						"allowed_accounts": []interface{}{allowed},
+					},
+				},
+			},
+		})
+		assert.False(t, resp.IsError())
+
+		// the xkey is created along with the account,
+		// the auth user does not exist yet
+		authorization := readAuthorization()
+		assert.Equal(t, readPublicKey(getAccountXKeyPath("op1", "ac1", "xk1")), authorization.XKey)
+		assert.Empty(t, authorization.AuthUsers)
+		assert.Equal(t, jwt.StringList{allowed}, authorization.AllowedAccounts)
+	})
+
+	t.Run("Test creating the auth user updates the account", func(t *testing.T) {
+		resp := write("issue/operator/op1/account/ac1/user/auth", nil)
+		assert.False(t, resp.IsError())
+
+		authorization := readAuthorization()
+		assert.Equal(t, jwt.StringList{readPublicKey(getUserNkeyPath("op1", "ac1", "auth"))}, authorization.AuthUsers)
+	})
+
+	t.Run("Test importing the xkey updates the account", func(t *testing.T) {
+		seed, err := createSeed(nkeys.PrefixByteCurve)
+		assert.NoError(t, err)
+		resp := write("nkey/operator/op1/account/ac1/xkey/xk1", map[string]interface{}{"seed": string(seed)})
+		assert.False(t, resp.IsError())
+
+		assert.Equal(t, readPublicKey(getAccountXKeyPath("op1", "ac1", "xk1")), readAuthorization().XKey)
+	})
+
+	t.Run("Test deleting the auth user and xkey updates the account", func(t *testing.T) {
+		deletedXKey := readAuthorization().XKey
+		for _, path := range []string{
+			"issue/operator/op1/account/ac1/user/auth",
+			"nkey/operator/op1/account/ac1/xkey/xk1",
+		} {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.DeleteOperation,
+				Path:      path,
+				Storage:   reqStorage,
+			})
+			assert.NoError(t, err)
+			assert.Nil(t, resp)
+		}
+
+		// the account drops the deleted user and
+		// publishes the xkey created in place of the deleted one
+		authorization := readAuthorization()
+		assert.Empty(t, authorization.AuthUsers)
+		assert.NotEmpty(t, authorization.XKey)
+		assert.NotEqual(t, deletedXKey, authorization.XKey)
+		assert.Equal(t, readPublicKey(getAccountXKeyPath("op1", "ac1", "xk1")), authorization.XKey)
+	})
+
+	t.Run("Test deleting the account deletes the xkey", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "issue/operator/op1/account/ac1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		nkey, err := readAccountXKey(context.Background(), reqStorage, NkeyParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			XKey:     "xk1",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, nkey)
+	})
+}
@@ -0,0 +1,229 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	v1alpha1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/account/v1alpha1"
+)
+
+// refreshedAccounts records the accounts re-issued by a request,
+// so that accounts importing from each other are only re-issued once.
+type refreshedAccounts struct {
+	mu       sync.Mutex
+	accounts map[string]bool
+}
+
+type refreshedAccountsKey struct{}
+
+// withRefreshedAccounts starts recording the re-issued accounts.
+// A context that already records them is returned unchanged.
+func withRefreshedAccounts(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(refreshedAccountsKey{}).(*refreshedAccounts); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, refreshedAccountsKey{}, &refreshedAccounts{
+		accounts: map[string]bool{},
+	})
+}
+
+// markAccountRefreshed records that the account has been re-issued
+func markAccountRefreshed(ctx context.Context, operator string, account string) {
+	refreshed, ok := ctx.Value(refreshedAccountsKey{}).(*refreshedAccounts)
+	if !ok {
+		return
+	}
+	refreshed.mu.Lock()
+	defer refreshed.mu.Unlock()
+	refreshed.accounts[operator+"/"+account] = true
+}
+
+// isAccountRefreshed reports whether the account has been re-issued by the request
+func isAccountRefreshed(ctx context.Context, operator string, account string) bool {
+	refreshed, ok := ctx.Value(refreshedAccountsKey{}).(*refreshedAccounts)
+	if !ok {
+		return false
+	}
+	refreshed.mu.Lock()
+	defer refreshed.mu.Unlock()
+	return refreshed.accounts[operator+"/"+account]
+}
+
+// importsFrom reports whether the import references the exporting account
+// either by the name of its issue or by its public key
+func importsFrom(imp v1alpha1.Import, exporter string, exporterPublicKey string) bool {
+	if imp.Account == "" {
+		return false
+	}
+	return imp.Account == exporter || (exporterPublicKey != "" && imp.Account == exporterPublicKey)
+}
+
+// resolveImports returns the imports of the account with the exporting
+// account issues resolved to their current public keys and the tokens of
+// referenced activations filled in. Imports from account issues that
+// don't exist are left out.
+func resolveImports(ctx context.Context, storage logical.Storage, issue IssueAccountStorage, accountPublicKey string) ([]v1alpha1.Import, error) {
+	if issue.Claims.Imports == nil {
+		return nil, nil
+	}
+
+	// public keys of the account issues, used to find the
+	// exporter of activations referenced by public key
+	var exporters map[string]string
+
+	imports := make([]v1alpha1.Import, 0, len(issue.Claims.Imports))
+	for _, imp := range issue.Claims.Imports {
+		imp := *imp.DeepCopy()
+
+		exporter := ""
+		switch {
+		case imp.Account == "":
+			if imp.Activation != "" {
+				return nil, fmt.Errorf("import %q references activation %q without an account", imp.Name, imp.Activation)
+			}
+		case nkeys.IsValidPublicAccountKey(imp.Account):
+			if imp.Activation != "" {
+				if exporters == nil {
+					var err error
+					exporters, err = listAccountPublicKeys(ctx, storage, issue.Operator)
+					if err != nil {
+						return nil, err
+					}
+				}
+				exporter = exporters[imp.Account]
+			}
+		default:
+			publicKey, err := readAccountPublicKey(ctx, storage, issue.Operator, imp.Account)
+			if err != nil {
+				return nil, err
+			}
+			if publicKey == "" {
+				log.Warn().
+					Str("operator", issue.Operator).Str("account", issue.Account).
+					Msgf("import %q: account issue %s does not exist, the import is left out", imp.Name, imp.Account)
+				continue
+			}
+			exporter = imp.Account
+			imp.Account = publicKey
+		}
+
+		if imp.Activation != "" {
+			token, err := resolveImportActivation(ctx, storage, issue, imp, exporter, accountPublicKey)
+			if err != nil {
+				return nil, err
+			}
+			imp.Token = token
+		}
+		imports = append(imports, imp)
+	}
+	return imports, nil
+}
+
+// checkImportAccounts returns a warning for every import that names
+// an account issue that doesn't exist. Such imports are left out of
+// the account jwt until the account issue is created.
+func checkImportAccounts(ctx context.Context, storage logical.Storage, operator string, imports []v1alpha1.Import) ([]string, error) {
+	var warnings []string
+	for _, imp := range imports {
+		if imp.Account == "" || nkeys.IsValidPublicAccountKey(imp.Account) {
+			continue
+		}
+		publicKey, err := readAccountPublicKey(ctx, storage, operator, imp.Account)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey == "" {
+			warnings = append(warnings, fmt.Sprintf("import %q: account issue %s does not exist, the import is left out", imp.Name, imp.Account))
+		}
+	}
+	return warnings, nil
+}
+
+// listAccountPublicKeys returns the names of the account issues
+// of the operator indexed by their public keys
+func listAccountPublicKeys(ctx context.Context, storage logical.Storage, operator string) (map[string]string, error) {
+	accounts, err := listAccountIssues(ctx, storage, operator)
+	if err != nil {
+		return nil, err
+	}
+	publicKeys := map[string]string{}
+	for _, account := range accounts {
+		publicKey, err := readAccountPublicKey(ctx, storage, operator, account)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey != "" {
+			publicKeys[publicKey] = account
+		}
+	}
+	return publicKeys, nil
+}
+
+// isExportingAccountChanged reports whether the importers of an account are
+// affected by its re-issued jwt. That is the case if its public key, its
+// exports or the signing keys that sign its activations have changed.
+// Undecodable jwts are treated as changed.
+func isExportingAccountChanged(previous *JWTStorage, current *JWTStorage) bool {
+	if previous == nil || current == nil {
+		return previous != current
+	}
+	if previous.JWT == current.JWT {
+		return false
+	}
+	before, err := jwt.DecodeAccountClaims(previous.JWT)
+	if err != nil {
+		return true
+	}
+	after, err := jwt.DecodeAccountClaims(current.JWT)
+	if err != nil {
+		return true
+	}
+	return before.Subject != after.Subject ||
+		!reflect.DeepEqual(before.Exports, after.Exports) ||
+		!reflect.DeepEqual(before.SigningKeys, after.SigningKeys)
+}
+
+// refreshImportingAccounts re-issues and pushes all accounts of the operator
+// that import from the exporting account. Accounts already re-issued
+// by the request are skipped.
+func refreshImportingAccounts(ctx context.Context, storage logical.Storage, operator string, exporter string, exporterPublicKey string) error {
+	accounts, err := listAccountIssues(ctx, storage, operator)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		if account == exporter || isAccountRefreshed(ctx, operator, account) {
+			continue
+		}
+		issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+			Operator: operator,
+			Account:  account,
+		})
+		if err != nil {
+			return err
+		}
+		if issue == nil {
+			continue
+		}
+		for _, imp := range issue.Claims.Imports {
+			if importsFrom(imp, exporter, exporterPublicKey) {
+				log.Info().
+					Str("operator", operator).Str("account", account).
+					Msgf("exporting account %s modified, account will be updated", exporter)
+				err := refreshAccount(ctx, storage, issue)
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountImportByName(t *testing.T) {
+	b, reqStorage, memory := getTestBackendWithResolver(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"syncAccountServer": true,
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"accountServerUrl": "nats://localhost:4222",
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	exporterClaims := map[string]interface{}{
+		"account": map[string]interface{}{
+			"limits": map[string]interface{}{
+				"exports":         -1,
+				"wildcardExports": true,
+			},
+			"exports": []interface{}{
+				map[string]interface{}{
+					"name":    "events",
+					"subject": "events.>",
+					"type":    "Stream",
+				},
+			},
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/exporter",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"claims": exporterClaims,
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/importer",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"limits": map[string]interface{}{
+						"imports": -1,
+					},
+					"imports": []interface{}{
+						map[string]interface{}{
+							"name":    "events",
+							"subject": "events.>",
+							"account": "exporter",
+							"type":    "Stream",
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	readAccountClaims := func(account string) *jwt.AccountClaims {
+		accountJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  account,
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(accountJWT.JWT)
+		assert.NoError(t, err)
+		return claims
+	}
+
+	t.Run("Test import is resolved to the public key of the account issue", func(t *testing.T) {
+		claims := readAccountClaims("importer")
+		assert.Len(t, claims.Imports, 1)
+		assert.Equal(t, readAccountClaims("exporter").Subject, claims.Imports[0].Account)
+
+		// the issue keeps the name
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "importer",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "exporter", issue.Claims.Imports[0].Account)
+	})
+
+	t.Run("Test importers are re-issued with the new public key of the exporter", func(t *testing.T) {
+		oldPublicKey := readAccountClaims("exporter").Subject
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "nkey/operator/op1/account/exporter",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		pushes := len(memory.Pushes())
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/exporter",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"claims": exporterClaims,
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		newPublicKey := readAccountClaims("exporter").Subject
+		assert.NotEqual(t, oldPublicKey, newPublicKey)
+		claims := readAccountClaims("importer")
+		assert.Equal(t, newPublicKey, claims.Imports[0].Account)
+
+		// the importer is pushed after the exporter
+		var pushed []string
+		for _, push := range memory.Pushes()[pushes:] {
+			pushed = append(pushed, push.Name)
+		}
+		assert.Equal(t, []string{"exporter", "importer"}, pushed)
+	})
+
+	t.Run("Test accounts importing from each other", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/exporter",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"claims": map[string]interface{}{
+					"account": map[string]interface{}{
+						"limits": map[string]interface{}{
+							"imports":         -1,
+							"exports":         -1,
+							"wildcardExports": true,
+						},
+						"exports": exporterClaims["account"].(map[string]interface{})["exports"],
+						"imports": []interface{}{
+							map[string]interface{}{
+								"name":    "other",
+								"subject": "other.>",
+								"account": "importer",
+								"type":    "Stream",
+							},
+						},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, readAccountClaims("importer").Subject, readAccountClaims("exporter").Imports[0].Account)
+	})
+
+	t.Run("Test imports from deleted accounts are left out", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "issue/operator/op1/account/exporter",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Empty(t, readAccountClaims("importer").Imports)
+	})
+}
+
+func TestAccountImportersOnlyFollowExportChanges(t *testing.T) {
+	b, reqStorage, memory := getTestBackendWithResolver(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	exporterClaims := func(subject string) map[string]interface{} {
+		return map[string]interface{}{
+			"account": map[string]interface{}{
+				"limits": map[string]interface{}{
+					"exports":         -1,
+					"wildcardExports": true,
+				},
+				"exports": []interface{}{
+					map[string]interface{}{
+						"name":    "events",
+						"subject": subject,
+						"type":    "Stream",
+					},
+				},
+			},
+		}
+	}
+	importerPushes := func() int {
+		n := 0
+		for _, push := range memory.Pushes() {
+			if push.Name == "importer" {
+				n++
+			}
+		}
+		return n
+	}
+
+	resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+		"syncAccountServer": true,
+		"claims": map[string]interface{}{
+			"operator": map[string]interface{}{
+				"accountServerUrl": "nats://localhost:4222",
+			},
+		},
+	})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/exporter", map[string]interface{}{
+		"claims": exporterClaims("events.>"),
+	})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/importer", map[string]interface{}{
+		"claims": map[string]interface{}{
+			"account": map[string]interface{}{
+				"limits": map[string]interface{}{
+					"imports": -1,
+				},
+				"imports": []interface{}{
+					map[string]interface{}{
+						"name":    "events",
+						"subject": "events.>",
+						"account": "exporter",
+						"type":    "Stream",
+					},
+				},
+			},
+		},
+	})
+	assert.False(t, resp.IsError())
+
+	t.Run("Test user revocations of the exporter don't re-issue importers", func(t *testing.T) {
+		pushes := importerPushes()
+		resp := request(logical.CreateOperation, "issue/operator/op1/account/exporter/user/u1", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+		resp = request(logical.DeleteOperation, "issue/operator/op1/account/exporter/user/u1", nil)
+		assert.Nil(t, resp)
+		assert.Equal(t, pushes, importerPushes())
+	})
+
+	t.Run("Test changed exports re-issue importers", func(t *testing.T) {
+		pushes := importerPushes()
+		resp := request(logical.UpdateOperation, "issue/operator/op1/account/exporter", map[string]interface{}{
+			"claims": exporterClaims("events.*"),
+		})
+		assert.False(t, resp.IsError())
+		assert.Equal(t, pushes+1, importerPushes())
+	})
+}
+
+func TestAccountImportOfMissingAccountWarns(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/importer",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"limits": map[string]interface{}{
+						"imports": -1,
+					},
+					"imports": []interface{}{
+						map[string]interface{}{
+							"name":    "events",
+							"subject": "events.>",
+							"account": "exproter",
+							"type":    "Stream",
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+	assert.Len(t, resp.Warnings, 1)
+	assert.Contains(t, resp.Warnings[0], "exproter")
+}
@@ -0,0 +1,33 @@
+package natsbackend
+
+import (
+	"context"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// AccountResolverFactory creates the resolver used to sync the accounts
+// of the operator to its account server. nil is returned if the account
+// server can't be reached yet.
+type AccountResolverFactory func(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) (resolver.AccountResolver, error)
+
+type accountResolverFactoryKey struct{}
+
+// withAccountResolverFactory passes the factory to the handlers
+// of a request, as they don't have access to the backend.
+func withAccountResolverFactory(ctx context.Context, factory AccountResolverFactory) context.Context {
+	if factory == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, accountResolverFactoryKey{}, factory)
+}
+
+// openAccountResolver creates the resolver for the account server of the operator.
+// The factory of the backend is used if set, newAccountServerResolver otherwise.
+func openAccountResolver(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) (resolver.AccountResolver, error) {
+	if factory, ok := ctx.Value(accountResolverFactoryKey{}).(AccountResolverFactory); ok {
+		return factory(ctx, storage, op)
+	}
+	return newAccountServerResolver(ctx, storage, op)
+}
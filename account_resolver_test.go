@@ -0,0 +1,135 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
+)
+
+func TestAccountResolverSync(t *testing.T) {
+	b, reqStorage, memory := getTestBackendWithResolver(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"syncAccountServer": true,
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"accountServerUrl": "nats://localhost:4222",
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1/user/u1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	readAccountIssueStatus := func() AccountServerStatus {
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		return issue.Status.AccountServer
+	}
+	lastPush := func(name string) *resolver.Push {
+		pushes := memory.Pushes()
+		for i := len(pushes) - 1; i >= 0; i-- {
+			if pushes[i].Name == name {
+				return &pushes[i]
+			}
+		}
+		return nil
+	}
+
+	t.Run("Test accounts are pushed on create", func(t *testing.T) {
+		push := lastPush("ac1")
+		assert.NotNil(t, push)
+		assert.Equal(t, push.JWT, memory.Accounts()[push.Account])
+
+		status := readAccountIssueStatus()
+		assert.True(t, status.Synced)
+		assert.Equal(t, resolver.MemoryServer, status.Result.Acknowledged[0].Server)
+	})
+
+	t.Run("Test deleted users are revoked at the account server", func(t *testing.T) {
+		userNkey, err := readUserNkey(context.Background(), reqStorage, NkeyParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			User:     "u1",
+		})
+		assert.NoError(t, err)
+		kp, err := toNkeyData(userNkey)
+		assert.NoError(t, err)
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "issue/operator/op1/account/ac1/user/u1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		claims, err := jwt.DecodeAccountClaims(lastPush("ac1").JWT)
+		assert.NoError(t, err)
+		assert.Contains(t, claims.Revocations, kp.PublicKey)
+	})
+
+	t.Run("Test periodic func pushes accounts", func(t *testing.T) {
+		pushes := len(memory.Pushes())
+		err := b.periodicFunc(context.Background(), &logical.Request{Storage: reqStorage})
+		assert.NoError(t, err)
+		assert.Greater(t, len(memory.Pushes()), pushes)
+		assert.True(t, readAccountIssueStatus().Synced)
+	})
+
+	t.Run("Test failed pushes are recorded in the account status", func(t *testing.T) {
+		memory.SetError(fmt.Errorf("unavailable"))
+		defer memory.SetError(nil)
+
+		err := b.periodicFunc(context.Background(), &logical.Request{Storage: reqStorage})
+		assert.NoError(t, err)
+		status := readAccountIssueStatus()
+		assert.False(t, status.Synced)
+		assert.Equal(t, "unavailable", status.Error)
+		assert.Equal(t, "unavailable", status.Result.Failed[0].Error)
+	})
+
+	t.Run("Test accounts are deleted from the account server", func(t *testing.T) {
+		publicKey := lastPush("ac1").Account
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "issue/operator/op1/account/ac1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, []string{publicKey}, memory.Deletes())
+		assert.NotContains(t, memory.Accounts(), publicKey)
+	})
+}
@@ -19,6 +19,9 @@ type NatsBackend struct {
 	*framework.Backend
 	lock   sync.RWMutex
 	client *NatsClient
+	// accountResolver creates the resolver used to sync the account server.
+	// Defaults to a connection to the account server url of the operator.
+	accountResolver AccountResolverFactory
 }
 
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
@@ -49,10 +52,15 @@ func backend() *NatsBackend {
 			pathJWT(&b),
 			pathIssue(&b),
 			pathCreds(&b),
+			pathRole(&b),
+			pathImportNsc(&b),
+			pathExportNsc(&b),
+			pathGarbageCollect(&b),
+			pathFsck(&b),
 			[]*framework.Path{},
 		),
 		Secrets: []*framework.Secret{
-			// b.hashiCupsToken(),
+			b.natsUserCreds(),
 		},
 		BackendType:       logical.TypeLogical,
 		Invalidate:        b.invalidate,
@@ -62,6 +70,11 @@ func backend() *NatsBackend {
 	return &b
 }
 
+// HandleRequest passes the account resolver factory of the backend to the handlers
+func (b *NatsBackend) HandleRequest(ctx context.Context, req *logical.Request) (*logical.Response, error) {
+	return b.Backend.HandleRequest(withAccountResolverFactory(ctx, b.accountResolver), req)
+}
+
 // backendHelp should contain help information for the backend
 const backendHelp = `
 The HashiCups secrets backend dynamically generates user tokens.
@@ -183,6 +196,7 @@ func readOperation[T any](ctx context.Context, s logical.Storage, path string) (
 }
 
 func (b *NatsBackend) periodicFunc(ctx context.Context, sys *logical.Request) error {
+	ctx = withAccountResolverFactory(ctx, b.accountResolver)
 	b.Logger().Info("Periodic: starting periodic func for syncing accounts to nats")
 	operators, err := listOperatorIssues(ctx, sys.Storage)
 	if err != nil {
@@ -196,6 +210,10 @@ func (b *NatsBackend) periodicFunc(ctx context.Context, sys *logical.Request) er
 			return err
 		}
 		if operatorIssue != nil {
+			if err = b.periodicExpireSigningKeys(ctx, sys.Storage, operatorIssue); err != nil {
+				b.Logger().Info(err.Error())
+			}
+
 			b.Logger().Debug(fmt.Sprintf("Periodic: operator %s selected for auto sync to account server", operator))
 			accountNames, err := listAccountIssues(ctx, sys.Storage, operator)
 			if err != nil {
@@ -230,6 +248,10 @@ func (b *NatsBackend) periodicFunc(ctx context.Context, sys *logical.Request) er
 					continue
 				}
 			}
+
+			if err = reconcileAccountServer(ctx, sys.Storage, operatorIssue); err != nil {
+				b.Logger().Info(err.Error())
+			}
 		}
 	}
 	return nil
@@ -333,3 +355,33 @@ func (b *NatsBackend) periodicRefreshAccountIssues(ctx context.Context, storage
 	}
 	return nil
 }
+
+// periodicExpireSigningKeys drops rotated signing keys of the operator
+// and its accounts once their overlap window is closed.
+func (b *NatsBackend) periodicExpireSigningKeys(ctx context.Context, storage logical.Storage, operator *IssueOperatorStorage) error {
+	now := time.Now()
+	if err := expireOperatorSigningKeys(ctx, storage, operator, now); err != nil {
+		return err
+	}
+
+	issuesList, err := listAccountIssues(ctx, storage, operator.Operator)
+	if err != nil {
+		return err
+	}
+	for _, issueName := range issuesList {
+		issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+			Operator: operator.Operator,
+			Account:  issueName,
+		})
+		if err != nil {
+			return err
+		}
+		if issue == nil {
+			continue
+		}
+		if err := expireAccountSigningKeys(ctx, storage, issue, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/require"
@@ -35,6 +36,19 @@ func getTestBackend(tb testing.TB) (*NatsBackend, logical.Storage) {
 	return b.(*NatsBackend), config.StorageView
 }
 
+// getTestBackendWithResolver constructs a test backend that syncs
+// account servers to the returned in-memory resolver.
+func getTestBackendWithResolver(tb testing.TB) (*NatsBackend, logical.Storage, *resolver.MemoryResolver) {
+	tb.Helper()
+
+	b, storage := getTestBackend(tb)
+	memory := resolver.NewMemoryResolver()
+	b.accountResolver = func(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) (resolver.AccountResolver, error) {
+		return memory, nil
+	}
+	return b, storage, memory
+}
+
 // runAcceptanceTests will separate unit tests from
 // acceptance tests, which will make active requests
 // to your target API.
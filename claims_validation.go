@@ -0,0 +1,184 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+
+	accountv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/account/v1alpha1"
+	operatorv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/operator/v1alpha1"
+	userv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
+)
+
+// The claims of an issue are validated before the issue is stored.
+// Keys that are filled in by the plugin when the JWT is signed, e.g. the
+// subject or the signing keys, may not exist yet. They are replaced by
+// throw-away public keys of the same type.
+
+// validateOperatorIssue validates the claims of an operator issue with nats-jwt.
+// Blocking issues are returned as error, all other issues as warnings.
+func validateOperatorIssue(params IssueOperatorParameters) ([]string, error) {
+	claims := params.Claims.DeepCopy()
+
+	operatorPublicKey, err := placeholderPublicKey(nkeys.PrefixByteOperator)
+	if err != nil {
+		return nil, err
+	}
+	claims.SigningKeys, err = placeholderPublicKeys(nkeys.PrefixByteOperator, len(claims.SigningKeys))
+	if err != nil {
+		return nil, err
+	}
+	// the system account is set by the plugin
+	claims.SystemAccount = ""
+	claims.Subject = operatorPublicKey
+	claims.Issuer = operatorPublicKey
+
+	natsJwt := operatorv1.Convert(claims)
+	vr := jwt.CreateValidationResults()
+	natsJwt.Validate(vr)
+	return validationResults(vr)
+}
+
+// validateAccountIssue validates the claims of an account issue with nats-jwt.
+// The imports are resolved like they are when the JWT is signed.
+// Blocking issues are returned as error, all other issues as warnings.
+func validateAccountIssue(ctx context.Context, storage logical.Storage, params IssueAccountParameters) ([]string, error) {
+	claims := params.Claims.DeepCopy()
+
+	accountPublicKey, err := readAccountPublicKey(ctx, storage, params.Operator, params.Account)
+	if err != nil {
+		return nil, err
+	}
+	if accountPublicKey == "" {
+		accountPublicKey, err = placeholderPublicKey(nkeys.PrefixByteAccount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	operatorPublicKey, err := placeholderPublicKey(nkeys.PrefixByteOperator)
+	if err != nil {
+		return nil, err
+	}
+
+	importWarnings, err := checkImportAccounts(ctx, storage, params.Operator, claims.Imports)
+	if err != nil {
+		return nil, err
+	}
+	imports, err := resolveImports(ctx, storage, IssueAccountStorage{
+		Operator: params.Operator,
+		Account:  params.Account,
+		Claims:   *claims,
+	}, accountPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	claims.Imports = imports
+
+	claims.SigningKeys, err = placeholderPublicKeys(nkeys.PrefixByteAccount, len(claims.SigningKeys))
+	if err != nil {
+		return nil, err
+	}
+	for i := range claims.ScopedSigningKeys {
+		claims.ScopedSigningKeys[i].Key, err = placeholderPublicKey(nkeys.PrefixByteAccount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if params.AuthCallout != nil {
+		authUsers, err := placeholderPublicKeys(nkeys.PrefixByteUser, len(params.AuthCallout.AuthUsers))
+		if err != nil {
+			return nil, err
+		}
+		claims.Authorization.AuthUsers = append(claims.Authorization.AuthUsers, authUsers...)
+		if params.AuthCallout.XKey != "" {
+			claims.Authorization.XKey, err = placeholderPublicKey(nkeys.PrefixByteCurve)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	claims.Subject = accountPublicKey
+	claims.Issuer = operatorPublicKey
+
+	natsJwt, err := accountv1.Convert(claims)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims: %s", err)
+	}
+	vr := jwt.CreateValidationResults()
+	natsJwt.Validate(vr)
+	warnings, err := validationResults(vr)
+	if err != nil {
+		return nil, err
+	}
+	return append(importWarnings, warnings...), nil
+}
+
+// validateUserIssue validates the claims of a user issue with nats-jwt.
+// Blocking issues are returned as error, all other issues as warnings.
+func validateUserIssue(params IssueUserParameters) ([]string, error) {
+	claims := params.Claims.DeepCopy()
+
+	userPublicKey, err := placeholderPublicKey(nkeys.PrefixByteUser)
+	if err != nil {
+		return nil, err
+	}
+	accountPublicKey, err := placeholderPublicKey(nkeys.PrefixByteAccount)
+	if err != nil {
+		return nil, err
+	}
+	if params.UseSigningKey != "" {
+		// the issuer account is set by the plugin
+		claims.IssuerAccount = accountPublicKey
+	}
+	claims.Subject = userPublicKey
+	claims.Issuer = accountPublicKey
+
+	natsJwt, err := userv1.Convert(claims)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claims: %s", err)
+	}
+	vr := jwt.CreateValidationResults()
+	natsJwt.Validate(vr)
+	return validationResults(vr)
+}
+
+// validationResults returns the blocking issues as a single error
+// and the remaining issues as warnings
+func validationResults(vr *jwt.ValidationResults) ([]string, error) {
+	errs := vr.Errors()
+	if len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		return nil, fmt.Errorf("invalid claims: %s", strings.Join(messages, "; "))
+	}
+	return vr.Warnings(), nil
+}
+
+func placeholderPublicKey(prefix nkeys.PrefixByte) (string, error) {
+	keyPair, err := nkeys.CreatePair(prefix)
+	if err != nil {
+		return "", err
+	}
+	return keyPair.PublicKey()
+}
+
+func placeholderPublicKeys(prefix nkeys.PrefixByte, n int) ([]string, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	publicKeys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		publicKey, err := placeholderPublicKey(prefix)
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
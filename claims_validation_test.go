@@ -0,0 +1,178 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssueClaimsValidation(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	t.Run("Test invalid operator claims are refused", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"claims": map[string]interface{}{
+					"operator": map[string]interface{}{
+						"assertServerVersion": "two",
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+		assert.Contains(t, resp.Error().Error(), "assert server version")
+
+		issue, err := readOperatorIssue(context.Background(), reqStorage, IssueOperatorParameters{
+			Operator: "op1",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, issue)
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"signingKeys": []interface{}{"opsk1"},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	t.Run("Test invalid account claims are refused", func(t *testing.T) {
+		for name, claims := range map[string]map[string]interface{}{
+			"exports exceed the limits": {
+				"exports": []interface{}{
+					map[string]interface{}{
+						"subject": "foo.>",
+						"type":    "Stream",
+					},
+				},
+			},
+			"invalid mapping subject": {
+				"mappings": map[string]interface{}{
+					"foo bar": []interface{}{
+						map[string]interface{}{
+							"subject": "bar",
+							"weight":  100,
+						},
+					},
+				},
+			},
+			"invalid default permissions": {
+				"defaultPermissions": map[string]interface{}{
+					"resp": map[string]interface{}{
+						"max": 1,
+						"ttl": "soon",
+					},
+				},
+			},
+		} {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "issue/operator/op1/account/ac1",
+				Storage:   reqStorage,
+				Data: map[string]interface{}{
+					"claims": map[string]interface{}{
+						"account": claims,
+					},
+				},
+			})
+			assert.NoError(t, err, name)
+			assert.True(t, resp.IsError(), name)
+
+			issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+				Operator: "op1",
+				Account:  "ac1",
+			})
+			assert.NoError(t, err, name)
+			assert.Nil(t, issue, name)
+		}
+	})
+
+	t.Run("Test signing key names are not validated as public keys", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/ac1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"useSigningKey": "opsk1",
+				"claims": map[string]interface{}{
+					"account": map[string]interface{}{
+						"signingKeys": []interface{}{"acsk1"},
+						"scopedSigningKeys": []interface{}{
+							map[string]interface{}{
+								"key":  "acsk2",
+								"role": "restricted",
+							},
+						},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, resp)
+	})
+
+	t.Run("Test invalid user claims are refused", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/ac1/user/u1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"useSigningKey": "acsk1",
+				"claims": map[string]interface{}{
+					"user": map[string]interface{}{
+						"src": []interface{}{"not-a-cidr"},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+
+		issue, err := readUserIssue(context.Background(), reqStorage, IssueUserParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			User:     "u1",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, issue)
+	})
+
+	t.Run("Test warnings are returned", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/ac1/user/u1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"claims": map[string]interface{}{
+					"exp": time.Now().Add(-time.Hour).Unix(),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, []string{"claim is expired"}, resp.Warnings)
+
+		issue, err := readUserIssue(context.Background(), reqStorage, IssueUserParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			User:     "u1",
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, issue)
+	})
+}
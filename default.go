@@ -6,4 +6,8 @@ const (
 
 	// DefaultSysUser is the name of the system user
 	DefaultPushUser = "default-push"
+
+	// DefaultSysAccountSigningKey is the name of the system account's signing
+	// key that signs its users if the operator enforces strict signing key usage
+	DefaultSysAccountSigningKey = "default-signing"
 )
@@ -0,0 +1,285 @@
+package natsbackend
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// DryRunData represents the data returned by an issue write with dryRun set
+type DryRunData struct {
+	// JWT that would be issued
+	JWT string `json:"jwt,omitempty"`
+	// Diff of the decoded claims against the currently stored JWT
+	Diff []ClaimsChange `json:"diff"`
+	// Reissued lists the other entities whose JWTs would be re-issued
+	Reissued []string `json:"reissued"`
+	// Pushed lists the accounts that would be pushed to the account server
+	Pushed []string `json:"pushed"`
+}
+
+// ClaimsChange is a changed field of the decoded claims.
+// Nested fields are separated by dots, e.g. "nats.limits.subs".
+type ClaimsChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// claims that change with every signed JWT
+var ignoredClaimsChanges = map[string]bool{
+	"iat": true,
+	"jti": true,
+}
+
+// dryRunIssue runs an issue write against a throw-away view of the storage.
+// Pushes to the account server are recorded instead of sent. The JWT
+// stored at jwtPath is compared with the currently stored one.
+func dryRunIssue(ctx context.Context, storage logical.Storage, jwtPath string, warnings []string, write func(ctx context.Context, storage logical.Storage) error) (*logical.Response, error) {
+	view := newDryRunStorage(storage)
+	memory := resolver.NewMemoryResolver()
+	ctx = withAccountResolverFactory(ctx, func(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) (resolver.AccountResolver, error) {
+		return memory, nil
+	})
+
+	err := write(ctx, view)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingIssueFailedError, err.Error())), nil
+	}
+
+	current, err := readStoredJWT(ctx, storage, jwtPath)
+	if err != nil {
+		return nil, err
+	}
+	issued, err := readStoredJWT(ctx, view, jwtPath)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := diffJWTClaims(current, issued)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &DryRunData{
+		JWT:      issued,
+		Diff:     diff,
+		Reissued: []string{},
+		Pushed:   []string{},
+	}
+	for _, path := range view.written() {
+		if path != jwtPath && strings.HasPrefix(path, "jwt/") {
+			data.Reissued = append(data.Reissued, strings.TrimPrefix(path, "jwt/"))
+		}
+	}
+	pushed := map[string]bool{}
+	for _, push := range memory.Pushes() {
+		if !pushed[push.Name] {
+			pushed[push.Name] = true
+			data.Pushed = append(data.Pushed, push.Name)
+		}
+	}
+
+	rval := map[string]interface{}{}
+	err = stm.StructToMap(data, &rval)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data:     rval,
+		Warnings: warnings,
+	}, nil
+}
+
+func readStoredJWT(ctx context.Context, storage logical.Storage, path string) (string, error) {
+	stored, err := getFromStorage[JWTStorage](ctx, storage, path)
+	if err != nil || stored == nil {
+		return "", err
+	}
+	return stored.JWT, nil
+}
+
+// diffJWTClaims compares the decoded payloads of two JWTs.
+// An empty JWT has no claims.
+func diffJWTClaims(current string, issued string) ([]ClaimsChange, error) {
+	currentClaims, err := decodeJWTPayload(current)
+	if err != nil {
+		return nil, err
+	}
+	issuedClaims, err := decodeJWTPayload(issued)
+	if err != nil {
+		return nil, err
+	}
+
+	currentFields := map[string]interface{}{}
+	flattenClaims("", currentClaims, currentFields)
+	issuedFields := map[string]interface{}{}
+	flattenClaims("", issuedClaims, issuedFields)
+
+	paths := map[string]bool{}
+	for path := range currentFields {
+		paths[path] = true
+	}
+	for path := range issuedFields {
+		paths[path] = true
+	}
+
+	diff := []ClaimsChange{}
+	for path := range paths {
+		if ignoredClaimsChanges[path] {
+			continue
+		}
+		before, after := currentFields[path], issuedFields[path]
+		if !reflect.DeepEqual(before, after) {
+			diff = append(diff, ClaimsChange{
+				Path: path,
+				Old:  before,
+				New:  after,
+			})
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i].Path < diff[j].Path
+	})
+	return diff, nil
+}
+
+func decodeJWTPayload(token string) (map[string]interface{}, error) {
+	claims := map[string]interface{}{}
+	if token == "" {
+		return claims, nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("could not decode jwt: %s", err)
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode jwt: %s", err)
+	}
+	return claims, nil
+}
+
+// flattenClaims collects the fields of nested objects with their dotted path.
+// Lists are compared as a whole.
+func flattenClaims(prefix string, claims map[string]interface{}, fields map[string]interface{}) {
+	for k, v := range claims {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenClaims(path, nested, fields)
+			continue
+		}
+		fields[path] = v
+	}
+}
+
+// dryRunStorage is a copy-on-write view of a storage.
+// Writes and deletes are kept in memory, reads fall through
+// to the underlying storage for untouched keys.
+type dryRunStorage struct {
+	mu      sync.Mutex
+	storage logical.Storage
+	entries map[string]*logical.StorageEntry
+	deleted map[string]bool
+}
+
+var _ logical.Storage = &dryRunStorage{}
+
+func newDryRunStorage(storage logical.Storage) *dryRunStorage {
+	return &dryRunStorage{
+		storage: storage,
+		entries: map[string]*logical.StorageEntry{},
+		deleted: map[string]bool{},
+	}
+}
+
+func (s *dryRunStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := s.storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merged := map[string]bool{}
+	for _, key := range keys {
+		if !s.deleted[prefix+key] {
+			merged[key] = true
+		}
+	}
+	for key := range s.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		key = strings.TrimPrefix(key, prefix)
+		if i := strings.Index(key, "/"); i >= 0 {
+			key = key[:i+1]
+		}
+		merged[key] = true
+	}
+
+	list := make([]string, 0, len(merged))
+	for key := range merged {
+		list = append(list, key)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func (s *dryRunStorage) Get(ctx context.Context, key string) (*logical.StorageEntry, error) {
+	s.mu.Lock()
+	entry, written := s.entries[key]
+	deleted := s.deleted[key]
+	s.mu.Unlock()
+	if written {
+		return entry, nil
+	}
+	if deleted {
+		return nil, nil
+	}
+	return s.storage.Get(ctx, key)
+}
+
+func (s *dryRunStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[entry.Key] = entry
+	delete(s.deleted, entry.Key)
+	return nil
+}
+
+func (s *dryRunStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	s.deleted[key] = true
+	return nil
+}
+
+// written returns the keys written to the view in sorted order
+func (s *dryRunStorage) written() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
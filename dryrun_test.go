@@ -0,0 +1,210 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssueDryRun(t *testing.T) {
+	b, reqStorage, memory := getTestBackendWithResolver(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"syncAccountServer": true,
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"accountServerUrl": "nats://localhost:4222",
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1/user/u1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	accountJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+		Operator: "op1",
+		Account:  "ac1",
+	})
+	assert.NoError(t, err)
+	pushes := len(memory.Pushes())
+
+	t.Run("Test account dry run", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/ac1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"dryRun": true,
+				"claims": map[string]interface{}{
+					"account": map[string]interface{}{
+						"signingKeys": []interface{}{"acsk1"},
+						"limits": map[string]interface{}{
+							"subs": 10,
+						},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		diff := map[string]ClaimsChange{}
+		for _, change := range resp.Data["diff"].([]interface{}) {
+			c := change.(map[string]interface{})
+			diff[c["path"].(string)] = ClaimsChange{Path: c["path"].(string), Old: c["old"], New: c["new"]}
+		}
+		assert.Contains(t, diff, "nats.limits.subs")
+		assert.EqualValues(t, 10, diff["nats.limits.subs"].New)
+		assert.Contains(t, diff, "nats.signing_keys")
+		assert.NotContains(t, diff, "iat")
+		assert.NotContains(t, diff, "sub")
+
+		// the new signing key re-issues the users
+		assert.Equal(t, []interface{}{"operator/op1/account/ac1/user/u1"}, resp.Data["reissued"])
+		assert.Equal(t, []interface{}{"ac1"}, resp.Data["pushed"])
+		assert.NotEmpty(t, resp.Data["jwt"])
+
+		// nothing is stored or pushed
+		stored, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, accountJWT.JWT, stored.JWT)
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, issue.Claims.SigningKeys)
+		signingKey, err := readAccountSigningNkey(context.Background(), reqStorage, NkeyParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			Signing:  "acsk1",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, signingKey)
+		assert.Len(t, memory.Pushes(), pushes)
+	})
+
+	t.Run("Test dry run of a new account", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/ac2",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"dryRun": true,
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.NotEmpty(t, resp.Data["diff"])
+
+		accounts, err := listAccountIssues(context.Background(), reqStorage, "op1")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"ac1"}, accounts)
+		nkey, err := readAccountNkey(context.Background(), reqStorage, NkeyParameters{
+			Operator: "op1",
+			Account:  "ac2",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, nkey)
+	})
+
+	t.Run("Test user dry run", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/ac1/user/u1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"dryRun": true,
+				"claims": map[string]interface{}{
+					"user": map[string]interface{}{
+						"subs": 5,
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, []interface{}{}, resp.Data["reissued"])
+		assert.Equal(t, []interface{}{}, resp.Data["pushed"])
+
+		changes := resp.Data["diff"].([]interface{})
+		assert.Len(t, changes, 1)
+		assert.Equal(t, "nats.subs", changes[0].(map[string]interface{})["path"])
+	})
+
+	t.Run("Test invalid claims are refused", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/ac1/user/u1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"dryRun": true,
+				"claims": map[string]interface{}{
+					"user": map[string]interface{}{
+						"src": []interface{}{"not-a-cidr"},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+	})
+}
+
+func TestDryRunStorage(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+	assert.NoError(t, storage.Put(ctx, &logical.StorageEntry{Key: "a/b", Value: []byte("b")}))
+	assert.NoError(t, storage.Put(ctx, &logical.StorageEntry{Key: "a/c/d", Value: []byte("d")}))
+
+	view := newDryRunStorage(storage)
+	assert.NoError(t, view.Put(ctx, &logical.StorageEntry{Key: "a/e/f", Value: []byte("f")}))
+	assert.NoError(t, view.Delete(ctx, "a/b"))
+
+	keys, err := view.List(ctx, "a/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c/", "e/"}, keys)
+
+	entry, err := view.Get(ctx, "a/b")
+	assert.NoError(t, err)
+	assert.Nil(t, entry)
+	entry, err = view.Get(ctx, "a/c/d")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("d"), entry.Value)
+	assert.Equal(t, []string{"a/e/f"}, view.written())
+
+	// the underlying storage is untouched
+	entry, err = storage.Get(ctx, "a/b")
+	assert.NoError(t, err)
+	assert.NotNil(t, entry)
+	keys, err = storage.List(ctx, "a/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c/"}, keys)
+}
@@ -34,6 +34,46 @@ const (
 	DeleteCredsFailedError  = "deleting creds failed"
 	CredsNotFoundError      = "creds not found"
 
+	// ROLE
+	AddingRoleFailedError  = "adding role failed"
+	ReadingRoleFailedError = "reading role failed"
+	ListRolesFailedError   = "listing roles failed"
+	DeleteRoleFailedError  = "deleting role failed"
+	RoleNotFoundError      = "role not found"
+
+	// ROTATION
+	RotatingSigningKeyFailedError = "rotating signing key failed"
+
+	// ACTIVATION
+	IssuingActivationFailedError = "issuing activation failed"
+
+	// OFFLINE OPERATOR
+	ReadingOperatorClaimsFailedError = "reading operator claims failed"
+	AcceptingOperatorJWTFailedError  = "accepting operator jwt failed"
+
+	// SIGNING
+	SigningUserFailedError        = "signing user failed"
+	RevokingSignedUserFailedError = "revoking signed user failed"
+
+	// ADOPTION
+	AdoptingIssueFailedError = "adopting issue failed"
+
+	// IMPORT
+	ImportingNscStoreFailedError = "importing nsc store failed"
+
+	// EXPORT
+	ExportingNscStoreFailedError = "exporting nsc store failed"
+
+	// SERVER CONFIG
+	RenderingServerConfigFailedError = "rendering server config failed"
+
+	// GARBAGE COLLECTION
+	CollectingOrphansFailedError = "collecting orphaned entries failed"
+	PurgingOrphansFailedError    = "purging orphaned entries failed"
+
+	// CONSISTENCY CHECK
+	CheckingConsistencyFailedError = "checking consistency failed"
+
 	// // Operator Errors
 	// OperatorNotConfiguredError      = "operator not configured"
 	// OperatorMissingError            = "missing operator"
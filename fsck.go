@@ -0,0 +1,526 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/rs/zerolog/log"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// The consistency check walks the operator, account and user issues of an
+// operator. The stored JWT of every issue is decoded, which verifies its
+// signature, and checked against the stored nkeys and the JWT of its parent,
+// the same chain nats-server verifies. The claims are compared with a JWT
+// re-issued from the issue in a throw-away view of the storage.
+
+// checks of the consistency check
+const (
+	FsckCheckNkey      = "nkey"
+	FsckCheckJWT       = "jwt"
+	FsckCheckSignature = "signature"
+	FsckCheckSubject   = "subject"
+	FsckCheckIssuer    = "issuer"
+	FsckCheckExpired   = "expired"
+	FsckCheckClaims    = "claims"
+	FsckCheckCreds     = "creds"
+	FsckCheckStatus    = "status"
+	FsckCheckRepair    = "repair"
+)
+
+// FsckParameters is the user facing interface for the consistency check.
+// Using pascal case on purpose.
+type FsckParameters struct {
+	Operator string `json:"operator"`
+	// Repair re-issues the entities with problems
+	Repair bool `json:"repair,omitempty"`
+}
+
+// FsckData represents the report of the consistency check
+type FsckData struct {
+	Operator string `json:"operator"`
+	// Checked lists the checked entities, e.g. "operator/op1/account/ac1"
+	Checked []string `json:"checked"`
+	// Problems lists the problems found
+	Problems []FsckProblem `json:"problems"`
+}
+
+// FsckProblem is a problem found by the consistency check
+type FsckProblem struct {
+	// Entity with the problem, e.g. "operator/op1/account/ac1/user/u1"
+	Entity  string `json:"entity"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+	// Diff of the stored claims against the claims of the issue
+	Diff []ClaimsChange `json:"diff,omitempty"`
+	// Repaired is set if the problem is gone after re-issuing the entity
+	Repaired bool `json:"repaired,omitempty"`
+}
+
+func pathFsck(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "fsck/operator/" + framework.GenericNameRegex("operator") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"repair": {
+					Type:        framework.TypeBool,
+					Description: "Re-issue the operator, accounts and users with problems",
+					Required:    false,
+					Default:     false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathFsck,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathFsck,
+				},
+			},
+			HelpSynopsis:    `Checks the consistency of an operator with all accounts and users.`,
+			HelpDescription: `Verifies the stored JWTs of the operator, its accounts and users against the stored nkeys, signing keys and issues. Writing with repair re-issues the entities with problems.`,
+		},
+	}
+}
+
+func (b *NatsBackend) pathFsck(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params FsckParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+	// reading never repairs
+	params.Repair = params.Repair && req.Operation == logical.UpdateOperation
+
+	report, err := fsckOperator(ctx, req.Storage, params.Operator, params.Repair)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", CheckingConsistencyFailedError, err)), nil
+	}
+	if report == nil {
+		return logical.ErrorResponse(IssueNotFoundError), nil
+	}
+
+	rval := map[string]interface{}{}
+	err = stm.StructToMap(report, &rval)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{Data: rval}, nil
+}
+
+// fsckOperator checks the operator and all of its accounts and users top
+// down, so that repaired parents are in place when the children are checked
+func fsckOperator(ctx context.Context, storage logical.Storage, operator string, repair bool) (*FsckData, error) {
+	op, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{Operator: operator})
+	if err != nil || op == nil {
+		return nil, err
+	}
+
+	report := &FsckData{
+		Operator: operator,
+		Checked:  []string{},
+		Problems: []FsckProblem{},
+	}
+	entity := "operator/" + operator
+	err = fsckEntity(report, entity, repair, func() ([]FsckProblem, error) {
+		return checkOperatorConsistency(ctx, storage, op)
+	}, func() error {
+		return refreshOperator(ctx, storage, op)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := listAccountIssues(ctx, storage, operator)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+			Operator: operator,
+			Account:  account,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if issue == nil {
+			continue
+		}
+		err = fsckEntity(report, entity+"/account/"+account, repair, func() ([]FsckProblem, error) {
+			return checkAccountConsistency(ctx, storage, op, issue)
+		}, func() error {
+			return refreshAccount(ctx, storage, issue)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		users, err := listUserIssues(ctx, storage, IssueUserParameters{
+			Operator: operator,
+			Account:  account,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			issue, err := readUserIssue(ctx, storage, IssueUserParameters{
+				Operator: operator,
+				Account:  account,
+				User:     user,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if issue == nil {
+				continue
+			}
+			err = fsckEntity(report, entity+"/account/"+account+"/user/"+user, repair, func() ([]FsckProblem, error) {
+				return checkUserConsistency(ctx, storage, op, issue)
+			}, func() error {
+				return refreshUser(ctx, storage, issue)
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// fsckEntity checks an entity and adds its problems to the report. With repair
+// set, an entity with problems is re-issued and checked again. Problems that
+// are gone afterwards are marked as repaired.
+func fsckEntity(report *FsckData, entity string, repair bool, check func() ([]FsckProblem, error), refresh func() error) error {
+	report.Checked = append(report.Checked, entity)
+	problems, err := check()
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if repair {
+		log.Info().Str("entity", entity).Msg("repair inconsistent issue")
+		err := refresh()
+		if err != nil {
+			problems = append(problems, FsckProblem{
+				Check:   FsckCheckRepair,
+				Message: fmt.Sprintf("could not re-issue: %s", err),
+			})
+		} else {
+			remaining, err := check()
+			if err != nil {
+				return err
+			}
+			for i := range problems {
+				problems[i].Repaired = !containsFsckCheck(remaining, problems[i].Check)
+			}
+		}
+	}
+
+	for _, problem := range problems {
+		problem.Entity = entity
+		report.Problems = append(report.Problems, problem)
+	}
+	return nil
+}
+
+func containsFsckCheck(problems []FsckProblem, check string) bool {
+	for _, problem := range problems {
+		if problem.Check == check {
+			return true
+		}
+	}
+	return false
+}
+
+func checkOperatorConsistency(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) ([]FsckProblem, error) {
+	problems := []FsckProblem{}
+
+	nkey, err := readOperatorNkey(ctx, storage, NkeyParameters{Operator: op.Operator})
+	if err != nil {
+		return nil, err
+	}
+	if nkey == nil && op.OfflineIdentityKey == "" {
+		problems = append(problems, FsckProblem{Check: FsckCheckNkey, Message: "operator nkey does not exist"})
+	}
+	publicKey, err := readOperatorPublicKey(ctx, storage, op.Operator)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := readOperatorJWT(ctx, storage, JWTParameters{Operator: op.Operator})
+	if err != nil {
+		return nil, err
+	}
+	// the operator status is not stored but derived on read,
+	// it is checked as reported by the operator issue
+	status := getIssueOperatorStatus(ctx, storage, op)
+	problems = append(problems, checkStatusConsistency(status.Operator, nkey != nil, token != nil)...)
+	if token == nil {
+		message := "operator jwt does not exist"
+		if op.OfflineIdentityKey != "" {
+			message += ": sign the claims of issue/operator/" + op.Operator + "/offline"
+		}
+		return append(problems, FsckProblem{Check: FsckCheckJWT, Message: message}), nil
+	}
+
+	claims, err := jwt.DecodeOperatorClaims(token.JWT)
+	if err != nil {
+		return append(problems, FsckProblem{Check: FsckCheckSignature, Message: fmt.Sprintf("could not decode operator jwt: %s", err)}), nil
+	}
+	problems = append(problems, checkClaimsDataConsistency(&claims.ClaimsData, publicKey, []string{publicKey})...)
+
+	if op.OfflineIdentityKey != "" {
+		// the operator jwt is signed outside of Vault
+		expected, err := createOperatorClaims(ctx, storage, *op)
+		if err != nil {
+			return nil, err
+		}
+		err = checkOfflineOperatorClaims(expected, claims)
+		if err != nil {
+			problems = append(problems, FsckProblem{Check: FsckCheckClaims, Message: fmt.Sprintf("%s: sign the claims of issue/operator/%s/offline", err, op.Operator)})
+		}
+		return problems, nil
+	}
+
+	return append(problems, checkReissuedClaims(ctx, storage, getOperatorJWTPath(op.Operator), func(ctx context.Context, view logical.Storage) error {
+		issue, err := readOperatorIssue(ctx, view, IssueOperatorParameters{Operator: op.Operator})
+		if err != nil {
+			return err
+		}
+		return refreshOperator(ctx, view, issue)
+	})...), nil
+}
+
+func checkAccountConsistency(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage, issue *IssueAccountStorage) ([]FsckProblem, error) {
+	problems := []FsckProblem{}
+
+	nkey, err := readAccountNkey(ctx, storage, NkeyParameters{Operator: issue.Operator, Account: issue.Account})
+	if err != nil {
+		return nil, err
+	}
+	if nkey == nil {
+		problems = append(problems, FsckProblem{Check: FsckCheckNkey, Message: "account nkey does not exist"})
+	}
+	token, err := readAccountJWT(ctx, storage, JWTParameters{Operator: issue.Operator, Account: issue.Account})
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, checkStatusConsistency(issue.Status.Account, nkey != nil, token != nil)...)
+	if token == nil {
+		return append(problems, FsckProblem{Check: FsckCheckJWT, Message: "account jwt does not exist"}), nil
+	}
+
+	claims, err := jwt.DecodeAccountClaims(token.JWT)
+	if err != nil {
+		return append(problems, FsckProblem{Check: FsckCheckSignature, Message: fmt.Sprintf("could not decode account jwt: %s", err)}), nil
+	}
+
+	// accounts are trusted if signed by the operator identity key
+	// or one of the signing keys published in the operator jwt
+	publicKey, err := readAccountPublicKey(ctx, storage, issue.Operator, issue.Account)
+	if err != nil {
+		return nil, err
+	}
+	trusted, err := readTrustedOperatorKeys(ctx, storage, op.Operator)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, checkClaimsDataConsistency(&claims.ClaimsData, publicKey, trusted)...)
+	signed, err := isAccountIdentityKeySigned(ctx, storage, op, issue.Account)
+	if err != nil {
+		return nil, err
+	}
+	if signed {
+		problems = append(problems, FsckProblem{Check: FsckCheckIssuer, Message: "account jwt is signed with the operator identity key although the operator requires signing keys"})
+	}
+
+	return append(problems, checkReissuedClaims(ctx, storage, getAccountJWTPath(issue.Operator, issue.Account), func(ctx context.Context, view logical.Storage) error {
+		issue, err := readAccountIssue(ctx, view, IssueAccountParameters{Operator: issue.Operator, Account: issue.Account})
+		if err != nil {
+			return err
+		}
+		return refreshAccount(ctx, view, issue)
+	})...), nil
+}
+
+func checkUserConsistency(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage, issue *IssueUserStorage) ([]FsckProblem, error) {
+	problems := []FsckProblem{}
+
+	nkey, err := readUserNkey(ctx, storage, NkeyParameters{Operator: issue.Operator, Account: issue.Account, User: issue.User})
+	if err != nil {
+		return nil, err
+	}
+	if nkey == nil {
+		problems = append(problems, FsckProblem{Check: FsckCheckNkey, Message: "user nkey does not exist"})
+	}
+	token, err := readUserJWT(ctx, storage, JWTParameters{Operator: issue.Operator, Account: issue.Account, User: issue.User})
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, checkStatusConsistency(issue.Status.User, nkey != nil, token != nil)...)
+	if token == nil {
+		return append(problems, FsckProblem{Check: FsckCheckJWT, Message: "user jwt does not exist"}), nil
+	}
+
+	claims, err := jwt.DecodeUserClaims(token.JWT)
+	if err != nil {
+		return append(problems, FsckProblem{Check: FsckCheckSignature, Message: fmt.Sprintf("could not decode user jwt: %s", err)}), nil
+	}
+
+	// users are trusted if signed by the account identity key
+	// or one of the signing keys published in the account jwt
+	publicKey, err := readNkeyPublicKey(ctx, storage, getUserNkeyPath(issue.Operator, issue.Account, issue.User))
+	if err != nil {
+		return nil, err
+	}
+	accountPublicKey, trusted, err := readTrustedAccountKeys(ctx, storage, issue.Operator, issue.Account)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, checkClaimsDataConsistency(&claims.ClaimsData, publicKey, trusted)...)
+	if claims.Issuer != accountPublicKey && claims.IssuerAccount != accountPublicKey {
+		problems = append(problems, FsckProblem{Check: FsckCheckIssuer, Message: fmt.Sprintf("issuer account %s of the user jwt is not the account %s", claims.IssuerAccount, accountPublicKey)})
+	}
+	signed, err := isUserIdentityKeySigned(ctx, storage, op, issue.Account, issue.User)
+	if err != nil {
+		return nil, err
+	}
+	if signed {
+		problems = append(problems, FsckProblem{Check: FsckCheckIssuer, Message: "user jwt is signed with the account identity key although the operator enforces strict signing key usage"})
+	}
+
+	creds, err := readUserCreds(ctx, storage, CredsParameters{Operator: issue.Operator, Account: issue.Account, User: issue.User})
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil {
+		problems = append(problems, FsckProblem{Check: FsckCheckCreds, Message: "user creds do not exist"})
+	} else if !strings.Contains(creds.Creds, token.JWT) {
+		problems = append(problems, FsckProblem{Check: FsckCheckCreds, Message: "user creds do not contain the stored user jwt"})
+	}
+
+	return append(problems, checkReissuedClaims(ctx, storage, getUserJWTPath(issue.Operator, issue.Account, issue.User), func(ctx context.Context, view logical.Storage) error {
+		issue, err := readUserIssue(ctx, view, IssueUserParameters{Operator: issue.Operator, Account: issue.Account, User: issue.User})
+		if err != nil {
+			return err
+		}
+		return refreshUser(ctx, view, issue)
+	})...), nil
+}
+
+// checkStatusConsistency compares the status of an issue with the stored nkey and jwt
+func checkStatusConsistency(status IssueStatus, nkey bool, jwt bool) []FsckProblem {
+	if status.Nkey == nkey && status.JWT == jwt {
+		return nil
+	}
+	return []FsckProblem{{
+		Check:   FsckCheckStatus,
+		Message: fmt.Sprintf("status (nkey: %t, jwt: %t) does not match the stored nkey and jwt (nkey: %t, jwt: %t)", status.Nkey, status.JWT, nkey, jwt),
+	}}
+}
+
+// checkClaimsDataConsistency checks the subject, issuer and expiry of a decoded jwt
+func checkClaimsDataConsistency(claims *jwt.ClaimsData, subject string, trusted []string) []FsckProblem {
+	problems := []FsckProblem{}
+	if claims.Subject != subject {
+		problems = append(problems, FsckProblem{Check: FsckCheckSubject, Message: fmt.Sprintf("subject %s does not match the stored nkey %s", claims.Subject, subject)})
+	}
+	if !containsString(trusted, claims.Issuer) {
+		problems = append(problems, FsckProblem{Check: FsckCheckIssuer, Message: fmt.Sprintf("issuer %s is neither the identity key nor a published signing key", claims.Issuer)})
+	}
+	if claims.Expires > 0 && claims.Expires < time.Now().Unix() {
+		problems = append(problems, FsckProblem{Check: FsckCheckExpired, Message: fmt.Sprintf("jwt expired at %s", time.Unix(claims.Expires, 0).UTC().Format(time.RFC3339))})
+	}
+	return problems
+}
+
+// checkReissuedClaims re-issues the jwt at jwtPath in a throw-away view of the
+// storage and compares the claims with the stored jwt
+func checkReissuedClaims(ctx context.Context, storage logical.Storage, jwtPath string, refresh func(ctx context.Context, view logical.Storage) error) []FsckProblem {
+	view := newDryRunStorage(storage)
+	memory := resolver.NewMemoryResolver()
+	ctx = withAccountResolverFactory(ctx, func(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) (resolver.AccountResolver, error) {
+		return memory, nil
+	})
+
+	err := refresh(ctx, view)
+	if err != nil {
+		return []FsckProblem{{Check: FsckCheckClaims, Message: fmt.Sprintf("could not re-issue the jwt: %s", err)}}
+	}
+	current, err := readStoredJWT(ctx, storage, jwtPath)
+	if err != nil {
+		return []FsckProblem{{Check: FsckCheckClaims, Message: err.Error()}}
+	}
+	issued, err := readStoredJWT(ctx, view, jwtPath)
+	if err != nil {
+		return []FsckProblem{{Check: FsckCheckClaims, Message: err.Error()}}
+	}
+	diff, err := diffJWTClaims(current, issued)
+	if err != nil {
+		return []FsckProblem{{Check: FsckCheckClaims, Message: err.Error()}}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return []FsckProblem{{Check: FsckCheckClaims, Message: "stored claims differ from the claims of the issue", Diff: diff}}
+}
+
+// readTrustedOperatorKeys returns the operator identity key and the signing
+// keys published in the stored operator jwt
+func readTrustedOperatorKeys(ctx context.Context, storage logical.Storage, operator string) ([]string, error) {
+	publicKey, err := readOperatorPublicKey(ctx, storage, operator)
+	if err != nil {
+		return nil, err
+	}
+	trusted := []string{publicKey}
+	token, err := readOperatorJWT(ctx, storage, JWTParameters{Operator: operator})
+	if err != nil || token == nil {
+		return trusted, err
+	}
+	claims, err := jwt.DecodeOperatorClaims(token.JWT)
+	if err != nil {
+		// reported with the operator
+		return trusted, nil
+	}
+	return append(trusted, claims.SigningKeys...), nil
+}
+
+// readTrustedAccountKeys returns the account identity key and the signing
+// keys published in the stored account jwt
+func readTrustedAccountKeys(ctx context.Context, storage logical.Storage, operator string, account string) (string, []string, error) {
+	publicKey, err := readAccountPublicKey(ctx, storage, operator, account)
+	if err != nil {
+		return "", nil, err
+	}
+	trusted := []string{publicKey}
+	token, err := readAccountJWT(ctx, storage, JWTParameters{Operator: operator, Account: account})
+	if err != nil || token == nil {
+		return publicKey, trusted, err
+	}
+	claims, err := jwt.DecodeAccountClaims(token.JWT)
+	if err != nil {
+		// reported with the account
+		return publicKey, trusted, nil
+	}
+	return publicKey, append(trusted, claims.SigningKeys.Keys()...), nil
+}
@@ -0,0 +1,112 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsck(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	problems := func(resp *logical.Response) map[string]map[string]bool {
+		found := map[string]map[string]bool{}
+		for _, problem := range resp.Data["problems"].([]interface{}) {
+			p := problem.(map[string]interface{})
+			entity := p["entity"].(string)
+			if found[entity] == nil {
+				found[entity] = map[string]bool{}
+			}
+			repaired, _ := p["repaired"].(bool)
+			found[entity][p["check"].(string)] = repaired
+		}
+		return found
+	}
+
+	resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+		"createSystemAccount": true,
+	})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1", map[string]interface{}{
+		"claims": map[string]interface{}{
+			"account": map[string]interface{}{
+				"signingKeys": []interface{}{"acsk1"},
+			},
+		},
+	})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1/user/u1", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1/user/u2", map[string]interface{}{
+		"useSigningKey": "acsk1",
+	})
+	assert.False(t, resp.IsError())
+
+	t.Run("Test consistent operator", func(t *testing.T) {
+		resp := request(logical.ReadOperation, "fsck/operator/op1", nil)
+		assert.False(t, resp.IsError())
+		assert.Empty(t, resp.Data["problems"])
+		assert.Contains(t, resp.Data["checked"], "operator/op1/account/ac1/user/u2")
+
+		resp = request(logical.ReadOperation, "fsck/operator/unknown", nil)
+		assert.True(t, resp.IsError())
+	})
+
+	t.Run("Test replaced account nkey is found and repaired", func(t *testing.T) {
+		kp, err := nkeys.CreateAccount()
+		assert.NoError(t, err)
+		seed, err := kp.Seed()
+		assert.NoError(t, err)
+		err = storeInStorage(context.Background(), reqStorage, getAccountNkeyPath("op1", "ac1"), &NKeyStorage{Seed: seed})
+		assert.NoError(t, err)
+
+		resp := request(logical.ReadOperation, "fsck/operator/op1", map[string]interface{}{"repair": true})
+		assert.False(t, resp.IsError())
+		found := problems(resp)
+		assert.Contains(t, found["operator/op1/account/ac1"], FsckCheckSubject)
+		assert.Contains(t, found["operator/op1/account/ac1/user/u1"], FsckCheckIssuer)
+		// reading never repairs
+		assert.False(t, found["operator/op1/account/ac1"][FsckCheckSubject])
+
+		resp = request(logical.UpdateOperation, "fsck/operator/op1", map[string]interface{}{"repair": true})
+		assert.False(t, resp.IsError())
+		found = problems(resp)
+		assert.True(t, found["operator/op1/account/ac1"][FsckCheckSubject])
+		assert.True(t, found["operator/op1/account/ac1/user/u1"][FsckCheckIssuer])
+
+		resp = request(logical.ReadOperation, "fsck/operator/op1", nil)
+		assert.False(t, resp.IsError())
+		assert.Empty(t, resp.Data["problems"])
+	})
+
+	t.Run("Test user signed by a removed signing key", func(t *testing.T) {
+		resp := request(logical.UpdateOperation, "issue/operator/op1/account/ac1", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+
+		resp = request(logical.ReadOperation, "fsck/operator/op1", nil)
+		assert.False(t, resp.IsError())
+		found := problems(resp)
+		assert.Len(t, found, 1)
+		assert.Contains(t, found["operator/op1/account/ac1/user/u2"], FsckCheckIssuer)
+
+		// the user can't be re-issued without the signing key
+		resp = request(logical.UpdateOperation, "fsck/operator/op1", map[string]interface{}{"repair": true})
+		assert.False(t, resp.IsError())
+		found = problems(resp)
+		assert.False(t, found["operator/op1/account/ac1/user/u2"][FsckCheckIssuer])
+		assert.Contains(t, found["operator/op1/account/ac1/user/u2"], FsckCheckRepair)
+	})
+}
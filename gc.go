@@ -0,0 +1,243 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/rs/zerolog/log"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// The nkeys, jwts and creds of an issue are stored next to it in trees
+// of the same layout, e.g.
+//
+//	issue/operator/<operator>/account/<account>/user/<user>
+//	nkey/operator/<operator>/account/<account>/user/<user>
+//	jwt/operator/<operator>/account/<account>/user/<user>
+//	creds/operator/<operator>/account/<account>/user/<user>
+//
+// An entry is orphaned if its issue no longer exists. Issues are orphaned
+// if the issue of their operator or account no longer exists.
+
+// GarbageCollectParameters is the user facing interface for the garbage collection.
+// Using pascal case on purpose.
+type GarbageCollectParameters struct {
+	// Purge deletes the orphaned entries
+	Purge bool `json:"purge,omitempty"`
+}
+
+// GarbageCollectData represents the orphaned entries found by the garbage collection
+type GarbageCollectData struct {
+	Issues []string `json:"issues"`
+	Nkeys  []string `json:"nkeys"`
+	JWTs   []string `json:"jwts"`
+	Creds  []string `json:"creds"`
+	// Purged is set if the orphaned entries are deleted
+	Purged bool `json:"purged"`
+}
+
+func pathGarbageCollect(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "gc$",
+			Fields: map[string]*framework.FieldSchema{
+				"purge": {
+					Type:        framework.TypeBool,
+					Description: "Delete the orphaned entries",
+					Required:    false,
+					Default:     false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathGarbageCollect,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathGarbageCollect,
+				},
+			},
+			HelpSynopsis:    `Finds orphaned nkeys, jwts and creds.`,
+			HelpDescription: `Lists the issues, nkeys, jwts and creds whose parent issue no longer exists. Writing with purge deletes them.`,
+		},
+	}
+}
+
+func (b *NatsBackend) pathGarbageCollect(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params GarbageCollectParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+	// reading never purges
+	params.Purge = params.Purge && req.Operation == logical.UpdateOperation
+
+	orphans, err := findOrphans(ctx, req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", CollectingOrphansFailedError, err)), nil
+	}
+	if params.Purge {
+		err = purgeOrphans(ctx, req.Storage, orphans)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("%s: %s", PurgingOrphansFailedError, err)), nil
+		}
+	}
+
+	rval := map[string]interface{}{}
+	err = stm.StructToMap(orphans, &rval)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{Data: rval}, nil
+}
+
+// findOrphans walks the issue, nkey, jwt and creds trees
+// and returns the entries whose parent issue doesn't exist
+func findOrphans(ctx context.Context, storage logical.Storage) (*GarbageCollectData, error) {
+	issues, err := collectKeys(ctx, storage, "issue/")
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, key := range issues {
+		existing[key] = true
+	}
+
+	orphans := &GarbageCollectData{
+		Issues: []string{},
+		Nkeys:  []string{},
+		JWTs:   []string{},
+		Creds:  []string{},
+	}
+	for _, key := range issues {
+		parent, ok := getParentIssuePath(key)
+		if ok && parent != "" && !isLiveIssue(existing, parent) {
+			orphans.Issues = append(orphans.Issues, key)
+		}
+	}
+
+	trees := []struct {
+		prefix  string
+		orphans *[]string
+	}{
+		{"nkey/", &orphans.Nkeys},
+		{"jwt/", &orphans.JWTs},
+		{"creds/", &orphans.Creds},
+	}
+	for _, tree := range trees {
+		keys, err := collectKeys(ctx, storage, tree.prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			issue, ok := getIssuePathOf(key)
+			if ok && !isLiveIssue(existing, issue) {
+				*tree.orphans = append(*tree.orphans, key)
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// purgeOrphans deletes the orphaned entries
+func purgeOrphans(ctx context.Context, storage logical.Storage, orphans *GarbageCollectData) error {
+	for _, keys := range [][]string{orphans.Creds, orphans.JWTs, orphans.Nkeys, orphans.Issues} {
+		for _, key := range keys {
+			log.Info().Str("path", key).Msg("purge orphaned entry")
+			err := deleteFromStorage(ctx, storage, key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	orphans.Purged = true
+	return nil
+}
+
+// collectKeys returns all keys below the prefix in sorted order
+func collectKeys(ctx context.Context, storage logical.Storage, prefix string) ([]string, error) {
+	entries, err := storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry, "/") {
+			sub, err := collectKeys(ctx, storage, prefix+entry)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, sub...)
+		} else {
+			keys = append(keys, prefix+entry)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// isLiveIssue returns if the issue and all of its parent issues exist
+func isLiveIssue(existing map[string]bool, issue string) bool {
+	for issue != "" {
+		if !existing[issue] {
+			return false
+		}
+		parent, ok := getParentIssuePath(issue)
+		if !ok {
+			return false
+		}
+		issue = parent
+	}
+	return true
+}
+
+// getParentIssuePath returns the issue an issue belongs to, an empty
+// string for operator issues. Unknown paths are reported as not ok.
+func getParentIssuePath(issue string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(issue, "issue/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "operator":
+		return "", true
+	case len(parts) == 4 && parts[0] == "operator" && parts[2] == "account":
+		return getOperatorIssuePath(parts[1]), true
+	case len(parts) == 6 && parts[0] == "operator" && parts[2] == "account":
+		switch parts[4] {
+		case "user", "activation", "signed":
+			return getAccountIssuePath(parts[1], parts[3]), true
+		}
+	}
+	return "", false
+}
+
+// getIssuePathOf returns the issue an nkey, jwt or creds entry belongs to.
+// Signing keys and xkeys belong to the issue of their operator or account.
+// Unknown paths are reported as not ok.
+func getIssuePathOf(key string) (string, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) < 3 || parts[1] != "operator" {
+		return "", false
+	}
+	parts = parts[1:]
+	switch {
+	case len(parts) == 2:
+		return getOperatorIssuePath(parts[1]), true
+	case len(parts) == 4 && parts[2] == "signing":
+		return getOperatorIssuePath(parts[1]), true
+	case len(parts) == 4 && parts[2] == "account":
+		return getAccountIssuePath(parts[1], parts[3]), true
+	case len(parts) == 6 && parts[2] == "account" && (parts[4] == "signing" || parts[4] == "xkey"):
+		return getAccountIssuePath(parts[1], parts[3]), true
+	case len(parts) == 6 && parts[2] == "account" && parts[4] == "user":
+		return getUserIssuePath(parts[1], parts[3], parts[5]), true
+	}
+	return "", false
+}
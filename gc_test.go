@@ -0,0 +1,82 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGarbageCollect(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1/user/u1", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac2", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+
+	t.Run("Test nothing is orphaned", func(t *testing.T) {
+		resp := request(logical.ReadOperation, "gc", nil)
+		assert.False(t, resp.IsError())
+		for _, key := range []string{"issues", "nkeys", "jwts", "creds"} {
+			assert.Empty(t, resp.Data[key], key)
+		}
+	})
+
+	t.Run("Test orphans of a deleted account are found", func(t *testing.T) {
+		resp := request(logical.DeleteOperation, "issue/operator/op1/account/ac1", nil)
+		assert.Nil(t, resp)
+		// an nkey and user issue of a missing operator
+		assert.NoError(t, addUserNkey(context.Background(), reqStorage, NkeyParameters{Operator: "op2", Account: "ac1", User: "u1"}))
+
+		resp = request(logical.ReadOperation, "gc", nil)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, []interface{}{getUserIssuePath("op1", "ac1", "u1"), getUserIssuePath("op2", "ac1", "u1")}, resp.Data["issues"])
+		assert.Equal(t, []interface{}{getUserNkeyPath("op1", "ac1", "u1"), getUserNkeyPath("op2", "ac1", "u1")}, resp.Data["nkeys"])
+		assert.Equal(t, []interface{}{getUserJWTPath("op1", "ac1", "u1")}, resp.Data["jwts"])
+		assert.Equal(t, []interface{}{getUserCredsPath("op1", "ac1", "u1")}, resp.Data["creds"])
+		assert.Equal(t, false, resp.Data["purged"])
+
+		// reading never purges
+		resp = request(logical.ReadOperation, "gc", map[string]interface{}{"purge": true})
+		assert.False(t, resp.IsError())
+		assert.Equal(t, false, resp.Data["purged"])
+	})
+
+	t.Run("Test orphans are purged", func(t *testing.T) {
+		resp := request(logical.UpdateOperation, "gc", map[string]interface{}{"purge": true})
+		assert.False(t, resp.IsError())
+		assert.Equal(t, true, resp.Data["purged"])
+		assert.Len(t, resp.Data["nkeys"], 2)
+
+		resp = request(logical.ReadOperation, "gc", nil)
+		assert.False(t, resp.IsError())
+		for _, key := range []string{"issues", "nkeys", "jwts", "creds"} {
+			assert.Empty(t, resp.Data[key], key)
+		}
+
+		// entries of existing issues are kept
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{Operator: "op1", Account: "ac2"})
+		assert.NoError(t, err)
+		assert.NotNil(t, issue)
+		token, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{Operator: "op1", Account: "ac2"})
+		assert.NoError(t, err)
+		assert.NotNil(t, token)
+	})
+}
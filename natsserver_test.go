@@ -0,0 +1,227 @@
+package natsbackend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNatsServer is an in-process nats-server trusting an operator of the backend.
+// Accounts are stored by a full resolver that accepts pushes and deletes.
+type testNatsServer struct {
+	*server.Server
+	resolver *server.DirAccResolver
+}
+
+// startTestNatsServer starts a nats-server that trusts the operator JWT and
+// knows its system account. The operator must have been issued with
+// createSystemAccount.
+func startTestNatsServer(tb testing.TB, storage logical.Storage, operator string) *testNatsServer {
+	tb.Helper()
+	ctx := context.Background()
+
+	operatorJWT, err := readOperatorJWT(ctx, storage, JWTParameters{Operator: operator})
+	require.NoError(tb, err)
+	require.NotNil(tb, operatorJWT)
+	operatorClaims, err := jwt.DecodeOperatorClaims(operatorJWT.JWT)
+	require.NoError(tb, err)
+
+	sysJWT, err := readAccountJWT(ctx, storage, JWTParameters{
+		Operator: operator,
+		Account:  DefaultSysAccountName,
+	})
+	require.NoError(tb, err)
+	require.NotNil(tb, sysJWT)
+	sysClaims, err := jwt.DecodeAccountClaims(sysJWT.JWT)
+	require.NoError(tb, err)
+
+	resolver, err := server.NewDirAccResolver(tb.TempDir(), 0, 0, true)
+	require.NoError(tb, err)
+	require.NoError(tb, resolver.Store(sysClaims.Subject, sysJWT.JWT))
+
+	s, err := server.NewServer(&server.Options{
+		Host:             "127.0.0.1",
+		Port:             server.RANDOM_PORT,
+		NoLog:            true,
+		NoSigs:           true,
+		TrustedOperators: []*jwt.OperatorClaims{operatorClaims},
+		SystemAccount:    sysClaims.Subject,
+		AccountResolver:  resolver,
+	})
+	require.NoError(tb, err)
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		tb.Fatal("nats-server not ready for connections")
+	}
+	tb.Cleanup(s.Shutdown)
+
+	return &testNatsServer{
+		Server:   s,
+		resolver: resolver,
+	}
+}
+
+// accountJWT returns the account JWT the nats-server stores for the public key
+func (s *testNatsServer) accountJWT(publicKey string) string {
+	accountJWT, err := s.resolver.Fetch(publicKey)
+	if err != nil {
+		return ""
+	}
+	return accountJWT
+}
+
+// connect connects to the nats-server with the content of a creds file
+func (s *testNatsServer) connect(tb testing.TB, creds string) (*nats.Conn, error) {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "user.creds")
+	require.NoError(tb, os.WriteFile(path, []byte(creds), 0600))
+	return nats.Connect(s.ClientURL(), nats.UserCredentials(path), nats.NoReconnect())
+}
+
+func TestNatsServerAccountPush(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+	ctx := context.Background()
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"createSystemAccount": true,
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	s := startTestNatsServer(t, reqStorage, "op1")
+
+	// enable the sync once the server is running
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"createSystemAccount": true,
+			"syncAccountServer":   true,
+			"accountServerSync": map[string]interface{}{
+				"timeout": "100ms",
+			},
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"accountServerUrl": s.ClientURL(),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"limits": map[string]interface{}{
+						"subs":    -1,
+						"data":    -1,
+						"payload": -1,
+						"conn":    -1,
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1/user/u1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	readAccountJWTClaims := func() *jwt.AccountClaims {
+		accountJWT, err := readAccountJWT(ctx, reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		require.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(accountJWT.JWT)
+		require.NoError(t, err)
+		return claims
+	}
+	accountPublicKey := readAccountJWTClaims().Subject
+
+	t.Run("Test pushed account is known to the nats-server", func(t *testing.T) {
+		accountJWT, err := readAccountJWT(ctx, reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, accountJWT.JWT, s.accountJWT(accountPublicKey))
+
+		issue, err := readAccountIssue(ctx, reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		assert.True(t, issue.Status.AccountServer.Synced)
+		assert.Len(t, issue.Status.AccountServer.Result.Acknowledged, 1)
+	})
+
+	t.Run("Test user creds connect and are revoked on delete", func(t *testing.T) {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/operator/op1/account/ac1/user/u1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		creds := resp.Data["creds"].(string)
+
+		nc, err := s.connect(t, creds)
+		if assert.NoError(t, err) {
+			nc.Close()
+		}
+
+		resp, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "issue/operator/op1/account/ac1/user/u1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		revoked, err := jwt.DecodeAccountClaims(s.accountJWT(accountPublicKey))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, revoked.Revocations)
+
+		_, err = s.connect(t, creds)
+		assert.Error(t, err)
+	})
+
+	t.Run("Test deleted account is removed from the nats-server", func(t *testing.T) {
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "issue/operator/op1/account/ac1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Empty(t, s.accountJWT(accountPublicKey))
+	})
+}
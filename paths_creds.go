@@ -29,6 +29,7 @@ type CredsData struct {
 func pathCreds(b *NatsBackend) []*framework.Path {
 	paths := []*framework.Path{}
 	paths = append(paths, pathUserCreds(b)...)
+	paths = append(paths, pathRoleCreds(b)...)
 	return paths
 }
 
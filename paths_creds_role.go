@@ -0,0 +1,286 @@
+package natsbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+const (
+	// SecretUserCredsType is the type of the leased user credentials secret
+	SecretUserCredsType = "nats_user_creds"
+)
+
+// RoleCredsData represents the the data returned by a role creds operation
+type RoleCredsData struct {
+	Creds     string `json:"creds"`
+	PublicKey string `json:"publicKey"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+func pathRoleCreds(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "creds/role/" + framework.GenericNameRegex("role") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"role": {
+					Type:        framework.TypeString,
+					Description: "role identifier",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReadRoleCreds,
+				},
+			},
+			HelpSynopsis:    `Generates leased user creds for a role.`,
+			HelpDescription: `Each read creates a new user nkey and a user JWT signed by the role's account. The JWT expires together with the maximum lease. On lease revocation the user is added to the account's revocation list.`,
+		},
+	}
+}
+
+func (b *NatsBackend) natsUserCreds() *framework.Secret {
+	return &framework.Secret{
+		Type: SecretUserCredsType,
+		Fields: map[string]*framework.FieldSchema{
+			"creds": {
+				Type:        framework.TypeString,
+				Description: "User creds",
+			},
+			"publicKey": {
+				Type:        framework.TypeString,
+				Description: "User public key",
+			},
+		},
+		Renew:  b.userCredsRenew,
+		Revoke: b.userCredsRevoke,
+	}
+}
+
+func (b *NatsBackend) pathReadRoleCreds(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params RoleParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	role, err := readRole(ctx, req.Storage, params.Role)
+	if err != nil {
+		return logical.ErrorResponse(ReadingRoleFailedError), nil
+	}
+	if role == nil {
+		return logical.ErrorResponse(RoleNotFoundError), nil
+	}
+
+	ttl, maxTTL := b.roleLeaseTTLs(role)
+	creds, err := issueRoleCreds(ctx, req.Storage, role, time.Now().Add(maxTTL))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingCredsFailedError, err.Error())), nil
+	}
+
+	rval := map[string]interface{}{}
+	err = stm.StructToMap(creds, &rval)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := b.Secret(SecretUserCredsType).Response(rval, map[string]interface{}{
+		"role":      role.Role,
+		"operator":  role.Operator,
+		"account":   role.Account,
+		"publicKey": creds.PublicKey,
+		"expiresAt": creds.ExpiresAt,
+	})
+	resp.Secret.TTL = ttl
+	resp.Secret.MaxTTL = maxTTL
+	return resp, nil
+}
+
+// roleLeaseTTLs returns the effective lease ttl and max ttl for a role
+// falling back to the system defaults.
+func (b *NatsBackend) roleLeaseTTLs(role *RoleStorage) (time.Duration, time.Duration) {
+	ttl := role.TTL
+	if ttl == 0 {
+		ttl = b.System().DefaultLeaseTTL()
+	}
+	maxTTL := role.MaxTTL
+	if maxTTL == 0 {
+		maxTTL = b.System().MaxLeaseTTL()
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+	return ttl, maxTTL
+}
+
+func (b *NatsBackend) userCredsRenew(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName, ok := req.Secret.InternalData["role"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing role internal data")
+	}
+
+	role, err := readRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %q does not exist anymore", roleName)
+	}
+
+	// the user JWT expires at the end of the max ttl of the role at
+	// issuance, so the lease is never extended beyond the JWT
+	ttl, maxTTL := b.roleLeaseTTLs(role)
+	if expiresAt := secretExpiresAt(req.Secret); expiresAt > 0 {
+		expires := time.Unix(expiresAt, 0)
+		if !req.Secret.IssueTime.IsZero() && expires.Sub(req.Secret.IssueTime) < maxTTL {
+			maxTTL = expires.Sub(req.Secret.IssueTime)
+		}
+		if remaining := time.Until(expires); remaining < ttl {
+			ttl = remaining
+		}
+	}
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL = ttl
+	resp.Secret.MaxTTL = maxTTL
+	return resp, nil
+}
+
+// secretExpiresAt returns the expiry of the user JWT of a lease,
+// 0 for leases issued before the expiry was recorded
+func secretExpiresAt(secret *logical.Secret) int64 {
+	switch expiresAt := secret.InternalData["expiresAt"].(type) {
+	case int64:
+		return expiresAt
+	case int:
+		return int64(expiresAt)
+	case float64:
+		return int64(expiresAt)
+	case json.Number:
+		v, _ := expiresAt.Int64()
+		return v
+	}
+	return 0
+}
+
+func (b *NatsBackend) userCredsRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	operator, _ := req.Secret.InternalData["operator"].(string)
+	account, _ := req.Secret.InternalData["account"].(string)
+	publicKey, _ := req.Secret.InternalData["publicKey"].(string)
+	if operator == "" || account == "" || publicKey == "" {
+		return nil, fmt.Errorf("secret is missing internal data")
+	}
+
+	// Vault revokes expired leases as well. Their JWT can't be used
+	// anymore, so there is nothing to add to the revocation list.
+	expiresAt := secretExpiresAt(req.Secret)
+	if expiresAt > 0 && expiresAt <= time.Now().Unix() {
+		log.Debug().Str("operator", operator).Str("account", account).
+			Msg("leased user jwt already expired - not revoked")
+		return nil, nil
+	}
+
+	issue, err := readAccountIssue(ctx, req.Storage, IssueAccountParameters{
+		Operator: operator,
+		Account:  account,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if issue == nil {
+		// nothing to revoke at, the account is gone
+		log.Warn().Str("operator", operator).Str("account", account).
+			Msg("cannot revoke leased user: account issue does not exist")
+		return nil, nil
+	}
+
+	err = addLeaseToRevocationList(ctx, req.Storage, issue, publicKey, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func issueRoleCreds(ctx context.Context, storage logical.Storage, role *RoleStorage, expires time.Time) (*RoleCredsData, error) {
+	useSigningKey, err := resolveUserSigningKey(ctx, storage, role.Operator, role.Account, role.UseSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	signingKeyPair, accountPublicKey, err := readUserSigningKeyPair(ctx, storage, role.Operator, role.Account, useSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if signingKeyPair == nil {
+		return nil, fmt.Errorf("account nkey does not exist: %s", role.Account)
+	}
+	signingPublicKey, err := signingKeyPair.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// the user nkey is not stored, it is only handed out
+	// with the creds of the lease
+	userKeyPair, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, err
+	}
+	userPublicKey, err := userKeyPair.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	seed, err := userKeyPair.Seed()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := *role.Claims.DeepCopy()
+	if useSigningKey != "" {
+		claims.IssuerAccount = accountPublicKey
+	}
+	claims.ClaimsData.Subject = userPublicKey
+	claims.ClaimsData.Issuer = signingPublicKey
+	claims.ClaimsData.Name = role.Role
+	claims.ClaimsData.Expires = expires.Unix()
+	natsJwt, err := v1alpha1.Convert(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert claims to nats jwt: %s", err)
+	}
+	err = applySigningKeyScope(ctx, storage, role.Operator, role.Account, useSigningKey, natsJwt)
+	if err != nil {
+		return nil, err
+	}
+	token, err := natsJwt.Encode(signingKeyPair)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode jwt: %s", err)
+	}
+
+	creds, err := jwt.FormatUserConfig(token, seed)
+	if err != nil {
+		return nil, fmt.Errorf("could not format user creds: %s", err)
+	}
+
+	log.Info().
+		Str("role", role.Role).Str("operator", role.Operator).Str("account", role.Account).
+		Msg("leased user creds created")
+
+	return &RoleCredsData{
+		Creds:     string(creds),
+		PublicKey: userPublicKey,
+		ExpiresAt: expires.Unix(),
+	}, nil
+}
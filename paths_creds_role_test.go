@@ -0,0 +1,209 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCreds(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	t.Run("Test leased creds for a role", func(t *testing.T) {
+
+		// reading creds of an unknown role fails
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/role/r1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+
+		// create operator and account issue the role refers to
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1",
+			Storage:   reqStorage,
+			Data:      map[string]interface{}{},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/ac1",
+			Storage:   reqStorage,
+			Data:      map[string]interface{}{},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "role/r1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"operator": "op1",
+				"account":  "ac1",
+				"ttl":      "1h",
+				"maxTtl":   "2h",
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		// read the leased creds
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/role/r1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.NotNil(t, resp.Secret)
+		assert.Equal(t, time.Hour, resp.Secret.TTL)
+		assert.Equal(t, 2*time.Hour, resp.Secret.MaxTTL)
+
+		// the user jwt is signed by the account and expires with the max ttl
+		userJWT, err := jwt.ParseDecoratedJWT([]byte(resp.Data["creds"].(string)))
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeUserClaims(userJWT)
+		assert.NoError(t, err)
+		assert.Equal(t, resp.Data["publicKey"], claims.Subject)
+		assert.Equal(t, int64(resp.Data["expiresAt"].(float64)), claims.Expires)
+		assert.InDelta(t, time.Now().Add(2*time.Hour).Unix(), claims.Expires, 5)
+
+		account, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		accountJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		accountClaims, err := jwt.DecodeAccountClaims(accountJWT.JWT)
+		assert.NoError(t, err)
+		assert.Equal(t, accountClaims.Subject, claims.Issuer)
+		assert.Empty(t, account.Claims.Revocations)
+
+		// renew the lease
+		secret := resp.Secret
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RenewOperation,
+			Storage:   reqStorage,
+			Secret:    secret,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, time.Hour, resp.Secret.TTL)
+
+		// revoking the lease adds the user to the account's revocation list
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   reqStorage,
+			Secret:    secret,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		account, err = readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		assert.Contains(t, account.Claims.Revocations, claims.Subject)
+
+		accountJWT, err = readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		accountClaims, err = jwt.DecodeAccountClaims(accountJWT.JWT)
+		assert.NoError(t, err)
+		assert.True(t, accountClaims.Revocations.IsRevoked(claims.Subject, time.Now()))
+	})
+}
+
+func TestRoleCredsLeaseExpiry(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	request := func(req *logical.Request) *logical.Response {
+		req.Storage = reqStorage
+		resp, err := b.HandleRequest(context.Background(), req)
+		assert.NoError(t, err)
+		return resp
+	}
+	readAccount := func() *IssueAccountStorage {
+		account, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{Operator: "op1", Account: "ac1"})
+		assert.NoError(t, err)
+		return account
+	}
+
+	resp := request(&logical.Request{Operation: logical.CreateOperation, Path: "issue/operator/op1", Data: map[string]interface{}{}})
+	assert.False(t, resp.IsError())
+	resp = request(&logical.Request{Operation: logical.CreateOperation, Path: "issue/operator/op1/account/ac1", Data: map[string]interface{}{}})
+	assert.False(t, resp.IsError())
+	resp = request(&logical.Request{Operation: logical.CreateOperation, Path: "role/r1", Data: map[string]interface{}{
+		"operator": "op1",
+		"account":  "ac1",
+		"ttl":      "1h",
+		"maxTtl":   "2h",
+	}})
+	assert.False(t, resp.IsError())
+
+	t.Run("Test renewal is capped by the jwt expiry", func(t *testing.T) {
+		resp := request(&logical.Request{Operation: logical.ReadOperation, Path: "creds/role/r1"})
+		assert.False(t, resp.IsError())
+		secret := resp.Secret
+		secret.IssueTime = time.Now()
+
+		// raising the max ttl of the role doesn't extend the lease
+		resp = request(&logical.Request{Operation: logical.UpdateOperation, Path: "role/r1", Data: map[string]interface{}{
+			"operator": "op1",
+			"account":  "ac1",
+			"ttl":      "1h",
+			"maxTtl":   "10h",
+		}})
+		assert.False(t, resp.IsError())
+
+		resp = request(&logical.Request{Operation: logical.RenewOperation, Secret: secret})
+		assert.False(t, resp.IsError())
+		assert.InDelta(t, (2 * time.Hour).Seconds(), resp.Secret.MaxTTL.Seconds(), 5)
+	})
+
+	t.Run("Test expired leases are not revoked", func(t *testing.T) {
+		resp := request(&logical.Request{Operation: logical.ReadOperation, Path: "creds/role/r1"})
+		assert.False(t, resp.IsError())
+		secret := resp.Secret
+		secret.InternalData["expiresAt"] = time.Now().Add(-time.Minute).Unix()
+
+		resp = request(&logical.Request{Operation: logical.RevokeOperation, Secret: secret})
+		assert.False(t, resp.IsError())
+		assert.Empty(t, readAccount().Claims.Revocations)
+	})
+
+	t.Run("Test revocations of expired leases are pruned", func(t *testing.T) {
+		resp := request(&logical.Request{Operation: logical.ReadOperation, Path: "creds/role/r1"})
+		assert.False(t, resp.IsError())
+		publicKey := resp.Data["publicKey"].(string)
+		resp = request(&logical.Request{Operation: logical.RevokeOperation, Secret: resp.Secret})
+		assert.False(t, resp.IsError())
+		account := readAccount()
+		assert.Contains(t, account.Claims.Revocations, publicKey)
+		assert.Contains(t, account.LeaseRevocations, publicKey)
+
+		// the jwt has expired by the next re-issue
+		account.LeaseRevocations[publicKey] = time.Now().Add(-time.Minute).Unix()
+		assert.NoError(t, refreshAccount(context.Background(), reqStorage, account))
+		account = readAccount()
+		assert.Empty(t, account.Claims.Revocations)
+		assert.Empty(t, account.LeaseRevocations)
+	})
+}
@@ -0,0 +1,279 @@
+package natsbackend
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// The export writes an operator in the layout of an nsc store and keystore:
+//
+//	stores/<operator>/.nsc
+//	stores/<operator>/<operator>.jwt
+//	stores/<operator>/accounts/<account>/<account>.jwt
+//	stores/<operator>/accounts/<account>/users/<user>.jwt
+//	keys/keys/<kind>/<public key[1:3]>/<public key>.nk
+//	keys/creds/<operator>/<account>/<user>.creds
+//
+// The keystore is only part of the archive if the seeds are included.
+
+// ExportNscParameters is the user facing interface for exporting an operator.
+// Using pascal case on purpose.
+type ExportNscParameters struct {
+	Operator string `json:"operator"`
+	// IncludeSeeds adds the seeds and creds to the archive
+	IncludeSeeds bool `json:"includeSeeds,omitempty"`
+}
+
+// ExportNscData represents the data returned by an nsc export
+type ExportNscData struct {
+	// Archive is the base64 encoded tar.gz archive
+	Archive string `json:"archive"`
+}
+
+// nscInfo is the content of the .nsc file that marks an operator directory
+type nscInfo struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Version int    `json:"version"`
+}
+
+func pathExportNsc(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "export/nsc/operator/" + framework.GenericNameRegex("operator") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"includeSeeds": {
+					Type:        framework.TypeBool,
+					Description: "Add the seeds and creds to the archive",
+					Required:    false,
+					Default:     false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathExportNsc,
+				},
+			},
+			HelpSynopsis:    `Exports an operator in the layout of an nsc store.`,
+			HelpDescription: `Returns a tar.gz archive with the JWTs of the operator, its accounts and users in the layout of an nsc store. If includeSeeds is set, the archive also contains the nkeys and creds in the layout of the nsc keystore.`,
+		},
+	}
+}
+
+func (b *NatsBackend) pathExportNsc(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params ExportNscParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	issue, err := readOperatorIssue(ctx, req.Storage, IssueOperatorParameters{Operator: params.Operator})
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", ExportingNscStoreFailedError, err)), nil
+	}
+	if issue == nil {
+		return logical.ErrorResponse(IssueNotFoundError), nil
+	}
+
+	files, err := exportNscStore(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", ExportingNscStoreFailedError, err)), nil
+	}
+	archive, err := writeNscArchive(files)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", ExportingNscStoreFailedError, err)), nil
+	}
+
+	rval := map[string]interface{}{}
+	err = stm.StructToMap(&ExportNscData{
+		Archive: base64.StdEncoding.EncodeToString(archive),
+	}, &rval)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: rval,
+	}, nil
+}
+
+// exportNscStore returns the files of the archive indexed by their names
+func exportNscStore(ctx context.Context, storage logical.Storage, params ExportNscParameters) (map[string][]byte, error) {
+	operator := params.Operator
+	files := map[string][]byte{}
+	storeDir := "stores/" + operator + "/"
+
+	info, err := json.Marshal(nscInfo{Name: operator, Kind: jwt.OperatorClaim, Version: 1})
+	if err != nil {
+		return nil, err
+	}
+	files[storeDir+".nsc"] = info
+
+	token, err := readOperatorJWT(ctx, storage, JWTParameters{Operator: operator})
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, fmt.Errorf("operator jwt does not exist")
+	}
+	files[storeDir+operator+".jwt"] = []byte(token.JWT)
+
+	seeds := []string{getOperatorNkeyPath(operator)}
+	signing, err := listNkeys(ctx, storage, getOperatorSigningNkeyPath(operator, ""))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range signing {
+		seeds = append(seeds, getOperatorSigningNkeyPath(operator, name))
+	}
+
+	accounts, err := listAccountIssues(ctx, storage, operator)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		token, err := readAccountJWT(ctx, storage, JWTParameters{Operator: operator, Account: account})
+		if err != nil {
+			return nil, err
+		}
+		if token == nil {
+			// issues whose jwt could not be created yet are skipped
+			continue
+		}
+		accountDir := storeDir + "accounts/" + account + "/"
+		files[accountDir+account+".jwt"] = []byte(token.JWT)
+
+		seeds = append(seeds, getAccountNkeyPath(operator, account))
+		signing, err := listNkeys(ctx, storage, getAccountSigningNkeyPath(operator, account, ""))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range signing {
+			seeds = append(seeds, getAccountSigningNkeyPath(operator, account, name))
+		}
+		xkeys, err := listNkeys(ctx, storage, getAccountXKeyPath(operator, account, ""))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range xkeys {
+			seeds = append(seeds, getAccountXKeyPath(operator, account, name))
+		}
+
+		users, err := listUserIssues(ctx, storage, IssueUserParameters{Operator: operator, Account: account})
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			token, err := readUserJWT(ctx, storage, JWTParameters{Operator: operator, Account: account, User: user})
+			if err != nil {
+				return nil, err
+			}
+			if token == nil {
+				continue
+			}
+			files[accountDir+"users/"+user+".jwt"] = []byte(token.JWT)
+			seeds = append(seeds, getUserNkeyPath(operator, account, user))
+
+			if !params.IncludeSeeds {
+				continue
+			}
+			creds, err := readUserCreds(ctx, storage, CredsParameters{Operator: operator, Account: account, User: user})
+			if err != nil {
+				return nil, err
+			}
+			if creds != nil {
+				files["keys/creds/"+operator+"/"+account+"/"+user+".creds"] = []byte(creds.Creds)
+			}
+		}
+	}
+
+	if !params.IncludeSeeds {
+		return files, nil
+	}
+	for _, path := range seeds {
+		nkey, err := readNkey(ctx, storage, path)
+		if err != nil {
+			return nil, err
+		}
+		if nkey == nil {
+			continue
+		}
+		keyPair, err := nkeys.FromSeed(nkey.Seed)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := keyPair.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		files[getNscKeystorePath(publicKey)] = nkey.Seed
+	}
+	return files, nil
+}
+
+// getNscKeystorePath returns the path of a seed in the nsc keystore
+func getNscKeystorePath(publicKey string) string {
+	return "keys/keys/" + publicKey[0:1] + "/" + publicKey[1:3] + "/" + publicKey + ".nk"
+}
+
+func writeNscArchive(files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	for _, name := range names {
+		err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0600,
+			Size:     int64(len(files[name])),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = tw.Write(files[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := tw.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
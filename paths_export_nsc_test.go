@@ -0,0 +1,143 @@
+package natsbackend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+func TestExportNsc(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	export := func(data map[string]interface{}) map[string][]byte {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "export/nsc/operator/op1",
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		archive, err := base64.StdEncoding.DecodeString(resp.Data["archive"].(string))
+		assert.NoError(t, err)
+		gz, err := gzip.NewReader(bytes.NewReader(archive))
+		assert.NoError(t, err)
+		files, err := readNscTar(gz, func(string) bool { return true })
+		assert.NoError(t, err)
+		return files
+	}
+
+	resp := write("issue/operator/op1", map[string]interface{}{
+		"createSystemAccount": true,
+		"claims": map[string]interface{}{
+			"operator": map[string]interface{}{
+				"signingKeys": []interface{}{"opsk1"},
+			},
+		},
+	})
+	assert.False(t, resp.IsError())
+	resp = write("issue/operator/op1/account/ac1", map[string]interface{}{
+		"useSigningKey": "opsk1",
+		"claims": map[string]interface{}{
+			"account": map[string]interface{}{
+				"signingKeys": []interface{}{"acsk1"},
+			},
+		},
+	})
+	assert.False(t, resp.IsError())
+	resp = write("issue/operator/op1/account/ac1/user/u1", map[string]interface{}{
+		"useSigningKey": "acsk1",
+	})
+	assert.False(t, resp.IsError())
+
+	t.Run("Test export without seeds", func(t *testing.T) {
+		files := export(nil)
+		assert.Contains(t, files, "stores/op1/.nsc")
+		assert.Contains(t, files, "stores/op1/op1.jwt")
+		assert.Contains(t, files, "stores/op1/accounts/sys/sys.jwt")
+		assert.Contains(t, files, "stores/op1/accounts/ac1/ac1.jwt")
+		assert.Contains(t, files, "stores/op1/accounts/ac1/users/u1.jwt")
+		// neither seeds nor creds
+		for name := range files {
+			assert.True(t, strings.HasPrefix(name, "stores/"), name)
+		}
+	})
+
+	t.Run("Test export with seeds", func(t *testing.T) {
+		files := export(map[string]interface{}{"includeSeeds": true})
+
+		var seeds int
+		for name := range files {
+			if strings.HasPrefix(name, "keys/keys/") {
+				seeds++
+			}
+		}
+		// operator, opsk1, sys, its push user, ac1, acsk1 and u1
+		assert.Equal(t, 7, seeds)
+		assert.Contains(t, files, "keys/creds/op1/ac1/u1.creds")
+
+		operatorNkey, err := readOperatorNkey(context.Background(), reqStorage, NkeyParameters{Operator: "op1"})
+		assert.NoError(t, err)
+		data, err := toNkeyData(operatorNkey)
+		assert.NoError(t, err)
+		assert.Equal(t, operatorNkey.Seed, files[getNscKeystorePath(data.PublicKey)])
+	})
+
+	t.Run("Test exported store can be imported", func(t *testing.T) {
+		files := export(map[string]interface{}{"includeSeeds": true})
+		archive, err := writeNscArchive(files)
+		assert.NoError(t, err)
+
+		other, otherStorage := getTestBackend(t)
+		resp, err := other.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "import/nsc",
+			Storage:   otherStorage,
+			Data: map[string]interface{}{
+				"archive": base64.StdEncoding.EncodeToString(archive),
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		var data ImportNscData
+		assert.NoError(t, stm.MapToStruct(resp.Data, &data))
+		assert.ElementsMatch(t, []string{
+			"operator/op1",
+			"operator/op1/account/ac1",
+			"operator/op1/account/ac1/user/u1",
+			"operator/op1/account/sys",
+			"operator/op1/account/sys/user/" + DefaultPushUser,
+		}, data.Imported)
+		assert.Empty(t, data.Missing)
+		assert.Empty(t, data.Errors)
+	})
+
+	t.Run("Test export of unknown operator", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "export/nsc/operator/unknown",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+	})
+}
@@ -0,0 +1,599 @@
+package natsbackend
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// An nsc store keeps the JWTs in operator directories:
+//
+//	<operator>/<operator>.jwt
+//	<operator>/accounts/<account>/<account>.jwt
+//	<operator>/accounts/<account>/users/<user>.jwt
+//
+// The seeds are kept in a keystore of .nk files named after their public keys.
+// Both may be part of the same archive. The entities are imported by storing
+// their nkeys and JWTs and adopting the issues.
+
+// ImportNscParameters is the user facing interface for importing an nsc store.
+// Using pascal case on purpose.
+type ImportNscParameters struct {
+	// Archive is the base64 encoded tar, tar.gz or zip archive
+	Archive string `json:"archive"`
+}
+
+// ImportNscData represents the data returned by an nsc store import
+type ImportNscData struct {
+	// Imported lists the adopted issues, e.g. "operator/op1/account/ac1"
+	Imported []string `json:"imported"`
+	// Conflicts lists the entities that are skipped because of existing issues or nkeys
+	Conflicts []string `json:"conflicts"`
+	// Missing lists the keys that are referenced by JWTs but missing from the archive
+	Missing []string `json:"missing"`
+	// Errors lists the entities that could not be imported
+	Errors []string `json:"errors"`
+}
+
+type nscStore struct {
+	operators map[string]*nscOperator
+	// seeds of the keystore indexed by their public keys
+	seeds map[string][]byte
+}
+
+type nscOperator struct {
+	name     string
+	token    string
+	accounts map[string]*nscAccount
+}
+
+type nscAccount struct {
+	name  string
+	token string
+	users map[string]*nscUser
+}
+
+type nscUser struct {
+	name  string
+	token string
+}
+
+// names of issues, see framework.GenericNameRegex
+var nscNameRegex = regexp.MustCompile(`^\w(([\w-.]+)?\w)?$`)
+
+func pathImportNsc(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "import/nsc$",
+			Fields: map[string]*framework.FieldSchema{
+				"archive": {
+					Type:        framework.TypeString,
+					Description: "Base64 encoded tar, tar.gz or zip archive of the nsc store and keystore",
+					Required:    true,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathImportNsc,
+				},
+			},
+			HelpSynopsis:    `Imports an nsc store.`,
+			HelpDescription: `Creates the operator, account and user issues of an nsc store archive together with their nkeys, signing nkeys and JWTs. Existing issues are not changed.`,
+		},
+	}
+}
+
+func (b *NatsBackend) pathImportNsc(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params ImportNscParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	archive, err := base64.StdEncoding.DecodeString(params.Archive)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: archive is not base64 encoded: %s", ImportingNscStoreFailedError, err)), nil
+	}
+	files, err := readNscArchive(archive)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", ImportingNscStoreFailedError, err)), nil
+	}
+
+	report := &ImportNscData{
+		Imported:  []string{},
+		Conflicts: []string{},
+		Missing:   []string{},
+		Errors:    []string{},
+	}
+	store := parseNscStore(files, report)
+	if len(store.operators) == 0 {
+		return logical.ErrorResponse(fmt.Sprintf("%s: the archive contains no operator", ImportingNscStoreFailedError)), nil
+	}
+	err = importNscStore(ctx, req.Storage, store, report)
+	if err != nil {
+		return nil, err
+	}
+
+	rval := map[string]interface{}{}
+	err = stm.StructToMap(report, &rval)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: rval,
+	}, nil
+}
+
+// limits of the uncompressed content of an nsc store archive,
+// so a small compressed archive can't exhaust the memory of the plugin
+const (
+	maxNscFileSize    = 1 << 20
+	maxNscArchiveSize = 64 << 20
+)
+
+// readNscFile reads a file of an archive enforcing the size limits.
+// total is the size of the files read so far.
+func readNscFile(r io.Reader, name string, total *int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxNscFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %s", name, err)
+	}
+	if len(content) > maxNscFileSize {
+		return nil, fmt.Errorf("%s exceeds the maximum file size of %d bytes", name, maxNscFileSize)
+	}
+	*total += int64(len(content))
+	if *total > maxNscArchiveSize {
+		return nil, fmt.Errorf("archive exceeds the maximum size of %d bytes", maxNscArchiveSize)
+	}
+	return content, nil
+}
+
+// readNscArchive returns the .jwt and .nk files of a tar, tar.gz or zip archive
+func readNscArchive(archive []byte) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	var total int64
+	wanted := func(name string) bool {
+		return strings.HasSuffix(name, ".jwt") || strings.HasSuffix(name, ".nk")
+	}
+
+	switch {
+	case bytes.HasPrefix(archive, []byte("PK\x03\x04")):
+		r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, fmt.Errorf("could not read zip archive: %s", err)
+		}
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() || !wanted(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("could not read %s: %s", f.Name, err)
+			}
+			content, err := readNscFile(rc, f.Name, &total)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[f.Name] = content
+		}
+		return files, nil
+	case bytes.HasPrefix(archive, []byte("\x1f\x8b")):
+		gz, err := gzip.NewReader(bytes.NewReader(archive))
+		if err != nil {
+			return nil, fmt.Errorf("could not read gzip archive: %s", err)
+		}
+		defer gz.Close()
+		return readNscTar(gz, wanted)
+	default:
+		return readNscTar(bytes.NewReader(archive), wanted)
+	}
+}
+
+func readNscTar(r io.Reader, wanted func(string) bool) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read tar archive: %s", err)
+		}
+		if header.Typeflag != tar.TypeReg || !wanted(header.Name) {
+			continue
+		}
+		content, err := readNscFile(tr, header.Name, &total)
+		if err != nil {
+			return nil, err
+		}
+		files[header.Name] = content
+	}
+}
+
+// parseNscStore sorts the files of an archive into operators, accounts, users and seeds.
+// Files that can't be decoded are reported as errors.
+func parseNscStore(files map[string][]byte, report *ImportNscData) *nscStore {
+	store := &nscStore{
+		operators: map[string]*nscOperator{},
+		seeds:     map[string][]byte{},
+	}
+	operator := func(name string) *nscOperator {
+		if store.operators[name] == nil {
+			store.operators[name] = &nscOperator{name: name, accounts: map[string]*nscAccount{}}
+		}
+		return store.operators[name]
+	}
+	account := func(op string, name string) *nscAccount {
+		accounts := operator(op).accounts
+		if accounts[name] == nil {
+			accounts[name] = &nscAccount{name: name, users: map[string]*nscUser{}}
+		}
+		return accounts[name]
+	}
+
+	for name, content := range files {
+		if strings.HasSuffix(name, ".nk") {
+			seed := bytes.TrimSpace(content)
+			keyPair, err := nkeys.FromSeed(seed)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid seed", name))
+				continue
+			}
+			publicKey, err := keyPair.PublicKey()
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid seed", name))
+				continue
+			}
+			store.seeds[publicKey] = seed
+			continue
+		}
+
+		token := string(bytes.TrimSpace(content))
+		segs := strings.Split(path.Clean(name), "/")
+		n := len(segs)
+		file := strings.TrimSuffix(segs[n-1], ".jwt")
+		switch {
+		case n >= 5 && segs[n-2] == "users" && segs[n-4] == "accounts":
+			account(segs[n-5], segs[n-3]).users[file] = &nscUser{name: file, token: token}
+		case n >= 4 && segs[n-3] == "accounts" && segs[n-2] == file:
+			account(segs[n-4], file).token = token
+		case n >= 2 && segs[n-2] == file:
+			operator(file).token = token
+		}
+	}
+	return store
+}
+
+func importNscStore(ctx context.Context, storage logical.Storage, store *nscStore, report *ImportNscData) error {
+	for _, opName := range sortedKeys(store.operators) {
+		err := importNscOperator(ctx, storage, store, store.operators[opName], report)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importNscOperator(ctx context.Context, storage logical.Storage, store *nscStore, op *nscOperator, report *ImportNscData) error {
+	opPath := "operator/" + op.name
+	if !nscNameRegex.MatchString(op.name) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid name", opPath))
+		return nil
+	}
+	if op.token == "" {
+		report.Missing = append(report.Missing, fmt.Sprintf("%s: operator jwt", opPath))
+		return nil
+	}
+	claims, err := jwt.DecodeOperatorClaims(op.token)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid jwt: %s", opPath, err))
+		return nil
+	}
+
+	// the system account is stored under the default name
+	// that the operator issue takes it from
+	accountNames := map[string]string{}
+	for _, accName := range sortedKeys(op.accounts) {
+		accountNames[accName] = accName
+		acc := op.accounts[accName]
+		if claims.SystemAccount != "" && acc.token != "" {
+			accClaims, err := jwt.DecodeAccountClaims(acc.token)
+			if err == nil && accClaims.Subject == claims.SystemAccount {
+				accountNames[accName] = DefaultSysAccountName
+				continue
+			}
+		}
+		if accName == DefaultSysAccountName {
+			accountNames[accName] = ""
+		}
+	}
+
+	ok, err := checkNscConflict(ctx, storage, report, opPath, claims.Subject, getOperatorNkeyPath(op.name), getOperatorIssuePath(op.name))
+	if err != nil || !ok {
+		return err
+	}
+
+	issue, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{Operator: op.name})
+	if err != nil {
+		return err
+	}
+	if issue == nil {
+		var written []string
+		seed, found := store.seeds[claims.Subject]
+		if !found {
+			report.Missing = append(report.Missing, fmt.Sprintf("%s: seed of %s", opPath, claims.Subject))
+			return nil
+		}
+		written = append(written, getOperatorNkeyPath(op.name))
+		err = storeInStorage(ctx, storage, getOperatorNkeyPath(op.name), &NKeyStorage{Seed: seed})
+		if err != nil {
+			return err
+		}
+		paths, err := storeNscSigningKeys(ctx, storage, store, report, opPath, claims.SigningKeys, func(name string) string {
+			return getOperatorSigningNkeyPath(op.name, name)
+		})
+		written = append(written, paths...)
+		if err != nil {
+			return err
+		}
+		written = append(written, getOperatorJWTPath(op.name))
+		err = storeInStorage(ctx, storage, getOperatorJWTPath(op.name), &JWTStorage{JWT: op.token})
+		if err != nil {
+			return err
+		}
+
+		// the operator jwt is checked against the system account nkey
+		for accName, vaultName := range accountNames {
+			if vaultName != DefaultSysAccountName {
+				continue
+			}
+			sysPath := getAccountNkeyPath(op.name, DefaultSysAccountName)
+			existing, err := readNkey(ctx, storage, sysPath)
+			if err != nil {
+				return err
+			}
+			if seed, found := store.seeds[claims.SystemAccount]; found && existing == nil {
+				written = append(written, sysPath)
+				err = storeInStorage(ctx, storage, sysPath, &NKeyStorage{Seed: seed})
+				if err != nil {
+					return err
+				}
+			} else if !found {
+				report.Missing = append(report.Missing, fmt.Sprintf("%s/account/%s: seed of %s", opPath, accName, claims.SystemAccount))
+			}
+		}
+
+		_, err = adoptOperatorIssue(ctx, storage, AdoptIssueParameters{Operator: op.name})
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", opPath, err))
+			return deleteNscEntity(ctx, storage, append(written, getOperatorIssuePath(op.name)))
+		}
+		report.Imported = append(report.Imported, opPath)
+	}
+
+	for _, accName := range sortedKeys(op.accounts) {
+		if accountNames[accName] == "" {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s/account/%s: the name is reserved for the system account", opPath, accName))
+			continue
+		}
+		err := importNscAccount(ctx, storage, store, op.name, accountNames[accName], op.accounts[accName], report)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importNscAccount(ctx context.Context, storage logical.Storage, store *nscStore, operator string, name string, acc *nscAccount, report *ImportNscData) error {
+	accPath := "operator/" + operator + "/account/" + name
+	if !nscNameRegex.MatchString(name) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid name", accPath))
+		return nil
+	}
+	if acc.name != name {
+		log.Info().Str("operator", operator).Str("account", name).Msgf("system account %s is imported as %s", acc.name, name)
+	}
+	if acc.token == "" {
+		report.Missing = append(report.Missing, fmt.Sprintf("%s: account jwt", accPath))
+		return nil
+	}
+	claims, err := jwt.DecodeAccountClaims(acc.token)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid jwt: %s", accPath, err))
+		return nil
+	}
+
+	ok, err := checkNscConflict(ctx, storage, report, accPath, claims.Subject, getAccountNkeyPath(operator, name), getAccountIssuePath(operator, name))
+	if err != nil || !ok {
+		return err
+	}
+
+	issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{Operator: operator, Account: name})
+	if err != nil {
+		return err
+	}
+	if issue == nil {
+		var written []string
+		seed, found := store.seeds[claims.Subject]
+		if !found {
+			report.Missing = append(report.Missing, fmt.Sprintf("%s: seed of %s", accPath, claims.Subject))
+			return nil
+		}
+		written = append(written, getAccountNkeyPath(operator, name))
+		err = storeInStorage(ctx, storage, getAccountNkeyPath(operator, name), &NKeyStorage{Seed: seed})
+		if err != nil {
+			return err
+		}
+		paths, err := storeNscSigningKeys(ctx, storage, store, report, accPath, claims.SigningKeys.Keys(), func(signing string) string {
+			return getAccountSigningNkeyPath(operator, name, signing)
+		})
+		written = append(written, paths...)
+		if err != nil {
+			return err
+		}
+		written = append(written, getAccountJWTPath(operator, name))
+		err = storeInStorage(ctx, storage, getAccountJWTPath(operator, name), &JWTStorage{JWT: acc.token})
+		if err != nil {
+			return err
+		}
+
+		_, err = adoptAccountIssue(ctx, storage, AdoptIssueParameters{Operator: operator, Account: name})
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", accPath, err))
+			return deleteNscEntity(ctx, storage, append(written, getAccountIssuePath(operator, name)))
+		}
+		report.Imported = append(report.Imported, accPath)
+	}
+
+	for _, userName := range sortedKeys(acc.users) {
+		err := importNscUser(ctx, storage, store, operator, name, acc.users[userName], report)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importNscUser(ctx context.Context, storage logical.Storage, store *nscStore, operator string, account string, user *nscUser, report *ImportNscData) error {
+	userPath := "operator/" + operator + "/account/" + account + "/user/" + user.name
+	if !nscNameRegex.MatchString(user.name) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid name", userPath))
+		return nil
+	}
+	claims, err := jwt.DecodeUserClaims(user.token)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: invalid jwt: %s", userPath, err))
+		return nil
+	}
+
+	ok, err := checkNscConflict(ctx, storage, report, userPath, claims.Subject, getUserNkeyPath(operator, account, user.name), getUserIssuePath(operator, account, user.name))
+	if err != nil || !ok {
+		return err
+	}
+	issue, err := readUserIssue(ctx, storage, IssueUserParameters{Operator: operator, Account: account, User: user.name})
+	if err != nil || issue != nil {
+		return err
+	}
+
+	seed, found := store.seeds[claims.Subject]
+	if !found {
+		report.Missing = append(report.Missing, fmt.Sprintf("%s: seed of %s", userPath, claims.Subject))
+		return nil
+	}
+	written := []string{getUserNkeyPath(operator, account, user.name), getUserJWTPath(operator, account, user.name)}
+	err = storeInStorage(ctx, storage, written[0], &NKeyStorage{Seed: seed})
+	if err != nil {
+		return err
+	}
+	err = storeInStorage(ctx, storage, written[1], &JWTStorage{JWT: user.token})
+	if err != nil {
+		return err
+	}
+
+	_, err = adoptUserIssue(ctx, storage, AdoptIssueParameters{Operator: operator, Account: account, User: user.name})
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", userPath, err))
+		return deleteNscEntity(ctx, storage, append(written, getUserIssuePath(operator, account, user.name), getUserCredsPath(operator, account, user.name)))
+	}
+	report.Imported = append(report.Imported, userPath)
+	return nil
+}
+
+// checkNscConflict reports existing issues and nkeys. The entities below an
+// existing issue are imported if its nkey is the one of the archive.
+func checkNscConflict(ctx context.Context, storage logical.Storage, report *ImportNscData, entity string, publicKey string, nkeyPath string, issuePath string) (bool, error) {
+	existing, err := readNkey(ctx, storage, nkeyPath)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil {
+		keyPair, err := nkeys.FromSeed(existing.Seed)
+		if err != nil {
+			return false, err
+		}
+		existingPublicKey, err := keyPair.PublicKey()
+		if err != nil {
+			return false, err
+		}
+		if existingPublicKey != publicKey {
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: existing nkey %s differs from %s", entity, existingPublicKey, publicKey))
+			return false, nil
+		}
+	}
+	issue, err := storage.Get(ctx, issuePath)
+	if err != nil {
+		return false, err
+	}
+	if issue != nil {
+		report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: issue exists", entity))
+	}
+	return true, nil
+}
+
+// storeNscSigningKeys stores the seeds of the signing keys under the names sk1, sk2, ...
+// in the order of their public keys. Signing keys without seed are reported as missing.
+func storeNscSigningKeys(ctx context.Context, storage logical.Storage, store *nscStore, report *ImportNscData, entity string, publicKeys []string, path func(string) string) ([]string, error) {
+	sorted := append([]string{}, publicKeys...)
+	sort.Strings(sorted)
+
+	var written []string
+	for _, publicKey := range sorted {
+		seed, found := store.seeds[publicKey]
+		if !found {
+			report.Missing = append(report.Missing, fmt.Sprintf("%s: seed of signing key %s", entity, publicKey))
+			continue
+		}
+		p := path(fmt.Sprintf("sk%d", len(written)+1))
+		written = append(written, p)
+		err := storeInStorage(ctx, storage, p, &NKeyStorage{Seed: seed})
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// deleteNscEntity removes what has been stored for an entity that could not be adopted
+func deleteNscEntity(ctx context.Context, storage logical.Storage, paths []string) error {
+	for _, p := range paths {
+		err := deleteFromStorage(ctx, storage, p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
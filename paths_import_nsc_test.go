@@ -0,0 +1,254 @@
+package natsbackend
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+func TestImportNsc(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	files := map[string]string{}
+	createPair := func(prefix nkeys.PrefixByte, keystore bool) (nkeys.KeyPair, string) {
+		kp, err := nkeys.CreatePair(prefix)
+		assert.NoError(t, err)
+		pub, err := kp.PublicKey()
+		assert.NoError(t, err)
+		if keystore {
+			seed, err := kp.Seed()
+			assert.NoError(t, err)
+			files["keys/"+pub+".nk"] = string(seed)
+		}
+		return kp, pub
+	}
+	importNsc := func(archive []byte) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "import/nsc",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"archive": base64.StdEncoding.EncodeToString(archive),
+			},
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	tarGz := func() []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, content := range files {
+			err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg})
+			assert.NoError(t, err)
+			_, err = tw.Write([]byte(content))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, tw.Close())
+		assert.NoError(t, gz.Close())
+		return buf.Bytes()
+	}
+
+	// nsc store with a system account, an account with a signing key
+	// and a user signed by it
+	operatorKp, operatorPub := createPair(nkeys.PrefixByteOperator, true)
+	_, sysPub := createPair(nkeys.PrefixByteAccount, true)
+	_, accountPub := createPair(nkeys.PrefixByteAccount, true)
+	accountSigningKp, accountSigningPub := createPair(nkeys.PrefixByteAccount, true)
+	_, missingSigningPub := createPair(nkeys.PrefixByteAccount, false)
+	_, userPub := createPair(nkeys.PrefixByteUser, true)
+
+	operatorClaims := jwt.NewOperatorClaims(operatorPub)
+	operatorClaims.Name = "myop"
+	operatorClaims.SystemAccount = sysPub
+	token, err := operatorClaims.Encode(operatorKp)
+	assert.NoError(t, err)
+	files["nats/myop/myop.jwt"] = token
+
+	sysClaims := jwt.NewAccountClaims(sysPub)
+	sysClaims.Name = "SYS"
+	sysClaims.Limits.Exports = -1
+	sysClaims.Limits.WildcardExports = true
+	token, err = sysClaims.Encode(operatorKp)
+	assert.NoError(t, err)
+	files["nats/myop/accounts/SYS/SYS.jwt"] = token
+
+	accountClaims := jwt.NewAccountClaims(accountPub)
+	accountClaims.Name = "myaccount"
+	accountClaims.Limits.Exports = -1
+	accountClaims.Limits.WildcardExports = true
+	accountClaims.SigningKeys.Add(accountSigningPub, missingSigningPub)
+	token, err = accountClaims.Encode(operatorKp)
+	assert.NoError(t, err)
+	files["nats/myop/accounts/myaccount/myaccount.jwt"] = token
+
+	userClaims := jwt.NewUserClaims(userPub)
+	userClaims.Name = "myuser"
+	userClaims.IssuerAccount = accountPub
+	userClaims.Pub.Allow.Add("foo.>")
+	token, err = userClaims.Encode(accountSigningKp)
+	assert.NoError(t, err)
+	files["nats/myop/accounts/myaccount/users/myuser.jwt"] = token
+
+	t.Run("Test import nsc store", func(t *testing.T) {
+		resp := importNsc(tarGz())
+		assert.False(t, resp.IsError())
+
+		var data ImportNscData
+		assert.NoError(t, stm.MapToStruct(resp.Data, &data))
+		assert.ElementsMatch(t, []string{
+			"operator/myop",
+			"operator/myop/account/sys",
+			"operator/myop/account/myaccount",
+			"operator/myop/account/myaccount/user/myuser",
+		}, data.Imported)
+		assert.Empty(t, data.Conflicts)
+		assert.Empty(t, data.Errors)
+		assert.Equal(t, []string{"operator/myop/account/myaccount: seed of signing key " + missingSigningPub}, data.Missing)
+
+		// the signing key with seed is named after its position
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "myop",
+			Account:  "myaccount",
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, issue)
+		assert.ElementsMatch(t, []string{"sk1", missingSigningPub}, issue.Claims.SigningKeys)
+
+		user, err := readUserIssue(context.Background(), reqStorage, IssueUserParameters{
+			Operator: "myop",
+			Account:  "myaccount",
+			User:     "myuser",
+		})
+		assert.NoError(t, err)
+		assert.NotNil(t, user)
+		assert.Equal(t, []string{"foo.>"}, user.Claims.Pub.Allow)
+
+		stored, err := readUserJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "myop",
+			Account:  "myaccount",
+			User:     "myuser",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeUserClaims(stored.JWT)
+		assert.NoError(t, err)
+		assert.Equal(t, userPub, claims.Subject)
+		assert.Equal(t, accountSigningPub, claims.Issuer)
+		assert.Equal(t, accountPub, claims.IssuerAccount)
+
+		// the operator references the imported system account
+		operator, err := readOperatorJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "myop",
+		})
+		assert.NoError(t, err)
+		opClaims, err := jwt.DecodeOperatorClaims(operator.JWT)
+		assert.NoError(t, err)
+		assert.Equal(t, sysPub, opClaims.SystemAccount)
+	})
+
+	t.Run("Test existing issues are reported as conflicts", func(t *testing.T) {
+		resp := importNsc(tarGz())
+		assert.False(t, resp.IsError())
+
+		var data ImportNscData
+		assert.NoError(t, stm.MapToStruct(resp.Data, &data))
+		assert.Empty(t, data.Imported)
+		assert.ElementsMatch(t, []string{
+			"operator/myop: issue exists",
+			"operator/myop/account/sys: issue exists",
+			"operator/myop/account/myaccount: issue exists",
+			"operator/myop/account/myaccount/user/myuser: issue exists",
+		}, data.Conflicts)
+	})
+
+	t.Run("Test existing nkeys of other keys are reported as conflicts", func(t *testing.T) {
+		files = map[string]string{}
+		otherKp, otherPub := createPair(nkeys.PrefixByteOperator, true)
+		claims := jwt.NewOperatorClaims(otherPub)
+		token, err := claims.Encode(otherKp)
+		assert.NoError(t, err)
+		files["op2/op2.jwt"] = token
+
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "nkey/operator/op2",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			w, err := zw.Create(name)
+			assert.NoError(t, err)
+			_, err = w.Write([]byte(content))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, zw.Close())
+
+		resp := importNsc(buf.Bytes())
+		assert.False(t, resp.IsError())
+
+		var data ImportNscData
+		assert.NoError(t, stm.MapToStruct(resp.Data, &data))
+		assert.Empty(t, data.Imported)
+		assert.Len(t, data.Conflicts, 1)
+		assert.Contains(t, data.Conflicts[0], "operator/op2: existing nkey")
+	})
+
+	t.Run("Test archive without operator is refused", func(t *testing.T) {
+		files = map[string]string{}
+		resp := importNsc(tarGz())
+		assert.True(t, resp.IsError())
+	})
+}
+
+func TestReadNscArchiveLimits(t *testing.T) {
+	zeros := make([]byte, maxNscFileSize+1)
+	tarGz := func(n int, size int) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for i := 0; i < n; i++ {
+			err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("op/accounts/ac%d/ac%d.jwt", i, i), Mode: 0600, Size: int64(size), Typeflag: tar.TypeReg})
+			assert.NoError(t, err)
+			_, err = tw.Write(zeros[:size])
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, tw.Close())
+		assert.NoError(t, gz.Close())
+		return buf.Bytes()
+	}
+
+	t.Run("Test oversized files are refused", func(t *testing.T) {
+		_, err := readNscArchive(tarGz(1, maxNscFileSize+1))
+		assert.ErrorContains(t, err, "maximum file size")
+
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create("op/op.jwt")
+		assert.NoError(t, err)
+		_, err = w.Write(zeros)
+		assert.NoError(t, err)
+		assert.NoError(t, zw.Close())
+		_, err = readNscArchive(buf.Bytes())
+		assert.ErrorContains(t, err, "maximum file size")
+	})
+
+	t.Run("Test oversized archives are refused", func(t *testing.T) {
+		_, err := readNscArchive(tarGz(maxNscArchiveSize/maxNscFileSize+1, maxNscFileSize))
+		assert.ErrorContains(t, err, "maximum size")
+	})
+}
@@ -11,11 +11,28 @@ import (
 func pathIssue(b *NatsBackend) []*framework.Path {
 	paths := []*framework.Path{}
 	paths = append(paths, pathOperatorIssue(b)...)
+	paths = append(paths, pathOfflineOperator(b)...)
 	paths = append(paths, pathAccountIssue(b)...)
 	paths = append(paths, pathUserIssue(b)...)
+	paths = append(paths, pathActivationIssue(b)...)
+	paths = append(paths, pathSignUser(b)...)
+	paths = append(paths, pathRotateSigningKey(b)...)
+	paths = append(paths, pathAdoptIssue(b)...)
+	paths = append(paths, pathServerConfig(b)...)
 	return paths
 }
 
+// createResponseWarnings returns the validation warnings of an issue write.
+// No response is returned if there are no warnings.
+func createResponseWarnings(warnings []string) (*logical.Response, error) {
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+	return &logical.Response{
+		Warnings: warnings,
+	}, nil
+}
+
 func listIssues(ctx context.Context, storage logical.Storage, path string) ([]string, error) {
 	l, err := storage.List(ctx, path)
 	if err != nil {
@@ -18,39 +18,58 @@ import (
 )
 
 type IssueAccountStorage struct {
-	Operator      string                 `json:"operator"`
-	Account       string                 `json:"account"`
-	UseSigningKey string                 `json:"useSigningKey"`
-	Claims        v1alpha1.AccountClaims `json:"claims"`
-	Status        IssueAccountStatus     `json:"status"`
+	Operator           string                 `json:"operator"`
+	Account            string                 `json:"account"`
+	UseSigningKey      string                 `json:"useSigningKey"`
+	DefaultSigningKey  string                 `json:"defaultSigningKey,omitempty"`
+	Claims             v1alpha1.AccountClaims `json:"claims"`
+	AuthCallout        *AuthCalloutConfig     `json:"authCallout,omitempty"`
+	RetiredSigningKeys []RetiredSigningKey    `json:"retiredSigningKeys,omitempty"`
+	// LeaseRevocations holds the expiry of the JWTs of revoked leased
+	// creds. Their revocations are dropped once the JWTs have expired.
+	LeaseRevocations map[string]int64   `json:"leaseRevocations,omitempty"`
+	Status           IssueAccountStatus `json:"status"`
 }
 
 // IssueAccountParameters is the user facing interface for configuring an account issue.
 // Using pascal case on purpose.
 // +k8s:deepcopy-gen=true
 type IssueAccountParameters struct {
-	Operator      string                 `json:"operator"`
-	Account       string                 `json:"account"`
-	UseSigningKey string                 `json:"useSigningKey,omitempty"`
-	Claims        v1alpha1.AccountClaims `json:"claims,omitempty"`
+	Operator      string `json:"operator"`
+	Account       string `json:"account"`
+	UseSigningKey string `json:"useSigningKey,omitempty"`
+	// DefaultSigningKey signs the users that don't name a signing key
+	// if the operator enforces strict signing key usage
+	DefaultSigningKey string                 `json:"defaultSigningKey,omitempty"`
+	Claims            v1alpha1.AccountClaims `json:"claims,omitempty"`
+	AuthCallout       *AuthCalloutConfig     `json:"authCallout,omitempty"`
 }
 
 type IssueAccountData struct {
-	Operator      string                 `json:"operator"`
-	Account       string                 `json:"account"`
-	UseSigningKey string                 `json:"useSigningKey"`
-	Claims        v1alpha1.AccountClaims `json:"claims"`
-	Status        IssueAccountStatus     `json:"status"`
+	Operator           string                 `json:"operator"`
+	Account            string                 `json:"account"`
+	UseSigningKey      string                 `json:"useSigningKey"`
+	DefaultSigningKey  string                 `json:"defaultSigningKey,omitempty"`
+	Claims             v1alpha1.AccountClaims `json:"claims"`
+	AuthCallout        *AuthCalloutConfig     `json:"authCallout,omitempty"`
+	RetiredSigningKeys []RetiredSigningKey    `json:"retiredSigningKeys,omitempty"`
+	Status             IssueAccountStatus     `json:"status"`
 }
 
 type IssueAccountStatus struct {
 	Account       IssueStatus         `json:"account"`
 	AccountServer AccountServerStatus `json:"accountServer"`
+	// IdentityKeySigned is set if the JWT is signed with the operator
+	// identity key although the operator requires signing keys
+	IdentityKeySigned bool `json:"identityKeySigned,omitempty"`
 }
 
 type AccountServerStatus struct {
 	Synced   bool  `json:"synced"`
 	LastSync int64 `json:"lastSync"`
+	// Result of the last push to the account server
+	Result *resolver.Result `json:"result,omitempty"`
+	Error  string           `json:"error,omitempty"`
 }
 
 func pathAccountIssue(b *NatsBackend) []*framework.Path {
@@ -73,11 +92,33 @@ func pathAccountIssue(b *NatsBackend) []*framework.Path {
 					Description: "Explicitly specified operator signing key to sign the account",
 					Required:    false,
 				},
+				"defaultSigningKey": {
+					Type:        framework.TypeString,
+					Description: "Account signing key that signs users without useSigningKey if the operator enforces strict signing key usage",
+					Required:    false,
+				},
 				"claims": {
 					Type:        framework.TypeMap,
 					Description: "Account claims (jwt.AccountClaims from github.com/nats-io/jwt/v2)",
 					Required:    false,
 				},
+				"authCallout": {
+					Type:        framework.TypeMap,
+					Description: "Names of the user issues (authUsers) and the account xkey (xkey) of the authorization callout",
+					Required:    false,
+				},
+				"dryRun": {
+					Type:        framework.TypeBool,
+					Description: "Return the changes of the write without storing or pushing anything",
+					Required:    false,
+					Default:     false,
+				},
+				"cascade": {
+					Type:        framework.TypeBool,
+					Description: "Delete the users of the account together with the account",
+					Required:    false,
+					Default:     false,
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.CreateOperation: &framework.PathOperation{
@@ -128,11 +169,23 @@ func (b *NatsBackend) pathAddAccountIssue(ctx context.Context, req *logical.Requ
 	}
 	params := IssueAccountParameters{}
 	json.Unmarshal(jsonString, &params)
+
+	warnings, err := validateAccountIssue(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingIssueFailedError, err.Error())), nil
+	}
+
+	if data.Get("dryRun").(bool) {
+		return dryRunIssue(ctx, req.Storage, getAccountJWTPath(params.Operator, params.Account), warnings, func(ctx context.Context, storage logical.Storage) error {
+			return addAccountIssue(ctx, storage, params)
+		})
+	}
+
 	err = addAccountIssue(ctx, req.Storage, params)
 	if err != nil {
 		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingIssueFailedError, err.Error())), nil
 	}
-	return nil, nil
+	return createResponseWarnings(warnings)
 }
 
 func (b *NatsBackend) pathReadAccountIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -157,6 +210,15 @@ func (b *NatsBackend) pathReadAccountIssue(ctx context.Context, req *logical.Req
 		return logical.ErrorResponse(IssueNotFoundError), nil
 	}
 
+	op, err := readOperatorIssue(ctx, req.Storage, IssueOperatorParameters{Operator: issue.Operator})
+	if err != nil {
+		return logical.ErrorResponse(ReadingIssueFailedError), nil
+	}
+	issue.Status.IdentityKeySigned, err = isAccountIdentityKeySigned(ctx, req.Storage, op, issue.Account)
+	if err != nil {
+		return logical.ErrorResponse(ReadingIssueFailedError), nil
+	}
+
 	return createResponseIssueAccountData(issue)
 }
 
@@ -195,7 +257,11 @@ func (b *NatsBackend) pathDeleteAccountIssue(ctx context.Context, req *logical.R
 	json.Unmarshal(jsonString, &params)
 
 	// delete issue and all related nkeys and jwt
-	err = deleteAccountIssue(ctx, req.Storage, params)
+	if data.Get("cascade").(bool) {
+		err = deleteAccountIssueCascade(ctx, req.Storage, params)
+	} else {
+		err = deleteAccountIssue(ctx, req.Storage, params)
+	}
 	if err != nil {
 		return logical.ErrorResponse(DeleteIssueFailedError), nil
 	}
@@ -208,6 +274,20 @@ func addAccountIssue(ctx context.Context, storage logical.Storage, params IssueA
 		Str("operator", params.Operator).Str("account", params.Account).
 		Msgf("issue account")
 
+	// refuse claims that can't be converted before storing them
+	_, err := v1alpha1.Convert(&params.Claims)
+	if err != nil {
+		return fmt.Errorf("invalid claims: %s", err)
+	}
+	err = checkAccountDefaultSigningKey(params)
+	if err != nil {
+		return err
+	}
+	_, err = resolveAccountSigningKey(ctx, storage, params.Operator, params.UseSigningKey)
+	if err != nil {
+		return err
+	}
+
 	// store issue
 	issue, err := storeAccountIssue(ctx, storage, params)
 	if err != nil {
@@ -218,8 +298,22 @@ func addAccountIssue(ctx context.Context, storage logical.Storage, params IssueA
 }
 
 func refreshAccount(ctx context.Context, storage logical.Storage, issue *IssueAccountStorage) error {
+	ctx = withRefreshedAccounts(ctx)
+	markAccountRefreshed(ctx, issue.Operator, issue.Account)
+
+	pruneLeaseRevocations(issue, time.Now())
+
+	// remember the jwt to find out if the importers are affected
+	previous, err := readAccountJWT(ctx, storage, JWTParameters{
+		Operator: issue.Operator,
+		Account:  issue.Account,
+	})
+	if err != nil {
+		return err
+	}
+
 	// create nkey and signing nkeys
-	err := issueAccountNKeys(ctx, storage, *issue)
+	err = issueAccountNKeys(ctx, storage, *issue)
 	if err != nil {
 		return err
 	}
@@ -245,7 +339,22 @@ func refreshAccount(ctx context.Context, storage logical.Storage, issue *IssueAc
 		return err
 	}
 
-	return nil
+	// importers have to pick up the current public key and exports
+	current, err := readAccountJWT(ctx, storage, JWTParameters{
+		Operator: issue.Operator,
+		Account:  issue.Account,
+	})
+	if err != nil {
+		return err
+	}
+	if !isExportingAccountChanged(previous, current) {
+		return nil
+	}
+	accountPublicKey, err := readAccountPublicKey(ctx, storage, issue.Operator, issue.Account)
+	if err != nil {
+		return err
+	}
+	return refreshImportingAccounts(ctx, storage, issue.Operator, issue.Account, accountPublicKey)
 }
 
 func readAccountIssue(ctx context.Context, storage logical.Storage, params IssueAccountParameters) (*IssueAccountStorage, error) {
@@ -275,6 +384,12 @@ func deleteAccountIssue(ctx context.Context, storage logical.Storage, params Iss
 		return err
 	}
 
+	// remember the public key to update the importers afterwards
+	accountPublicKey, err := readAccountPublicKey(ctx, storage, issue.Operator, issue.Account)
+	if err != nil {
+		return err
+	}
+
 	// delete account nkey
 	nkey := NkeyParameters{
 		Operator: issue.Operator,
@@ -286,7 +401,7 @@ func deleteAccountIssue(ctx context.Context, storage logical.Storage, params Iss
 	}
 
 	// delete account siginig nkeys
-	for _, signingKey := range issue.Claims.SigningKeys {
+	for _, signingKey := range getAccountSigningKeyNames(&issue.Claims) {
 		nkey := NkeyParameters{
 			Operator: issue.Operator,
 			Account:  issue.Account,
@@ -298,6 +413,42 @@ func deleteAccountIssue(ctx context.Context, storage logical.Storage, params Iss
 		}
 	}
 
+	// delete retired account signing nkeys
+	for _, retired := range issue.RetiredSigningKeys {
+		err := deleteAccountSigningNkey(ctx, storage, NkeyParameters{
+			Operator: issue.Operator,
+			Account:  issue.Account,
+			Signing:  retired.Name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// delete the xkey of the authorization callout
+	if issue.AuthCallout != nil && issue.AuthCallout.XKey != "" {
+		err := deleteAccountXKey(ctx, storage, NkeyParameters{
+			Operator: issue.Operator,
+			Account:  issue.Account,
+			XKey:     issue.AuthCallout.XKey,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// delete activations issued by the account
+	err = deleteActivationIssues(ctx, storage, issue.Operator, issue.Account)
+	if err != nil {
+		return err
+	}
+
+	// delete users signed for public keys of the callers
+	err = deleteSignedUsers(ctx, storage, issue.Operator, issue.Account)
+	if err != nil {
+		return err
+	}
+
 	// delete account jwt
 	jwt := JWTParameters{
 		Operator: issue.Operator,
@@ -310,7 +461,28 @@ func deleteAccountIssue(ctx context.Context, storage logical.Storage, params Iss
 
 	// delete account issue
 	path := getAccountIssuePath(issue.Operator, issue.Account)
-	return deleteFromStorage(ctx, storage, path)
+	err = deleteFromStorage(ctx, storage, path)
+	if err != nil {
+		return err
+	}
+
+	// imports from the account are left out from now on
+	return refreshImportingAccounts(ctx, storage, issue.Operator, issue.Account, accountPublicKey)
+}
+
+// deleteAccountIssueCascade deletes the account issue with all user issues
+// of the account and their nkeys, jwts and creds
+func deleteAccountIssueCascade(ctx context.Context, storage logical.Storage, params IssueAccountParameters) error {
+	log.Info().
+		Str("operator", params.Operator).Str("account", params.Account).
+		Msgf("delete account with all users")
+
+	// the users are gone with the account, no need to revoke them
+	err := deleteUserIssues(ctx, storage, params.Operator, params.Account)
+	if err != nil {
+		return err
+	}
+	return deleteAccountIssue(ctx, storage, params)
 }
 
 func storeAccountIssueUpdate(ctx context.Context, storage logical.Storage, issue *IssueAccountStorage) (*IssueAccountStorage, error) {
@@ -335,7 +507,7 @@ func storeAccountIssue(ctx context.Context, storage logical.Storage, params Issu
 	} else {
 		// diff current and incomming signing keys
 		// delete removed signing keys
-		for _, signingKey := range issue.Claims.SigningKeys {
+		for _, signingKey := range getAccountSigningKeyNames(&issue.Claims) {
 			contains := func(a []string, x string) bool {
 				for _, n := range a {
 					if x == n {
@@ -344,7 +516,7 @@ func storeAccountIssue(ctx context.Context, storage logical.Storage, params Issu
 				}
 				return false
 			}
-			if !contains(params.Claims.SigningKeys, signingKey) {
+			if !contains(getAccountSigningKeyNames(&params.Claims), signingKey) {
 				p := NkeyParameters{
 					Operator: params.Operator,
 					Account:  params.Account,
@@ -362,6 +534,8 @@ func storeAccountIssue(ctx context.Context, storage logical.Storage, params Issu
 	issue.Operator = params.Operator
 	issue.Account = params.Account
 	issue.UseSigningKey = params.UseSigningKey
+	issue.DefaultSigningKey = params.DefaultSigningKey
+	issue.AuthCallout = params.AuthCallout
 	err = storeInStorage(ctx, storage, path, issue)
 	if err != nil {
 		return nil, err
@@ -395,7 +569,10 @@ func issueAccountNKeys(ctx context.Context, storage logical.Storage, issue Issue
 	}
 
 	// issue account siginig nkeys
-	for _, signingKey := range issue.Claims.SigningKeys {
+	for _, signingKey := range getAccountSigningKeyNames(&issue.Claims) {
+		if isSigningPublicKey(signingKey, nkeys.PrefixByteAccount) {
+			continue
+		}
 		p := NkeyParameters{
 			Operator: issue.Operator,
 			Account:  issue.Account,
@@ -414,6 +591,25 @@ func issueAccountNKeys(ctx context.Context, storage logical.Storage, issue Issue
 		}
 	}
 
+	// issue the xkey of the authorization callout
+	if issue.AuthCallout != nil && issue.AuthCallout.XKey != "" {
+		p := NkeyParameters{
+			Operator: issue.Operator,
+			Account:  issue.Account,
+			XKey:     issue.AuthCallout.XKey,
+		}
+		stored, err := readAccountXKey(ctx, storage, p)
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			err := addAccountXKey(ctx, storage, p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	if refreshTheOperator {
 		// force update of operator
 		// so he gets updates from sys account
@@ -453,7 +649,10 @@ func issueAccountNKeys(ctx context.Context, storage logical.Storage, issue Issue
 func issueAccountJWT(ctx context.Context, storage logical.Storage, issue IssueAccountStorage) error {
 	// use either operator nkey or signing nkey to
 	// sign jwt and add issuer claim
-	useSigningKey := issue.UseSigningKey
+	useSigningKey, err := resolveAccountSigningKey(ctx, storage, issue.Operator, issue.UseSigningKey)
+	if err != nil {
+		return err
+	}
 	var seed []byte
 	if useSigningKey == "" {
 		data, err := readOperatorNkey(ctx, storage, NkeyParameters{
@@ -515,40 +714,66 @@ func issueAccountJWT(ctx context.Context, storage logical.Storage, issue IssueAc
 		return err
 	}
 
-	// receive public keys of signing keys
-	var signingPublicKeys []string
-	for _, signingKey := range issue.Claims.SigningKeys {
-		data, err := readAccountSigningNkey(ctx, storage, NkeyParameters{
-			Operator: issue.Operator,
-			Account:  issue.Account,
-			Signing:  signingKey,
-		})
-		if err != nil {
-			return fmt.Errorf("could not read signing key")
-		}
-		if data == nil {
-			log.Warn().
-				Str("operator", issue.Operator).Str("account", issue.Account).
-				Msgf("signing nkey does not exist: %s - Cannot create jwt.", signingKey)
+	// retired signing keys are published with their former scope
+	// until their overlap window closes
+	signingKeys := append([]string{}, issue.Claims.SigningKeys...)
+	scopes := append([]v1alpha1.ScopedSigningKey{}, issue.Claims.ScopedSigningKeys...)
+	for _, retired := range issue.RetiredSigningKeys {
+		scope := getAccountSigningKeyScope(&issue.Claims, retired.Key)
+		if scope == nil {
+			signingKeys = append(signingKeys, retired.Name)
 			continue
 		}
-		signingKeyPair, err := nkeys.FromSeed(data.Seed)
+		retiredScope := *scope.DeepCopy()
+		retiredScope.Key = retired.Name
+		scopes = append(scopes, retiredScope)
+	}
+
+	// receive public keys of signing keys
+	var signingPublicKeys []string
+	for _, signingKey := range signingKeys {
+		signingKey, err := readAccountSigningPublicKey(ctx, storage, issue, signingKey)
 		if err != nil {
 			return err
 		}
+		if signingKey != "" {
+			signingPublicKeys = append(signingPublicKeys, signingKey)
+		}
+	}
 
-		signingKey, err := signingKeyPair.PublicKey()
+	// receive public keys of scoped signing keys
+	var scopedSigningKeys []v1alpha1.ScopedSigningKey
+	for _, scope := range scopes {
+		signingKey, err := readAccountSigningPublicKey(ctx, storage, issue, scope.Key)
 		if err != nil {
 			return err
 		}
-		signingPublicKeys = append(signingPublicKeys, signingKey)
+		if signingKey != "" {
+			scoped := *scope.DeepCopy()
+			scoped.Key = signingKey
+			scopedSigningKeys = append(scopedSigningKeys, scoped)
+		}
+	}
+
+	// resolve the exporting accounts and activations of the imports
+	imports, err := resolveImports(ctx, storage, issue, accountPublicKey)
+	if err != nil {
+		return err
+	}
+
+	// receive public keys of the authorization callout
+	authorization, err := resolveAuthCallout(ctx, storage, issue)
+	if err != nil {
+		return err
 	}
 
 	issue.Claims.ClaimsData.Subject = accountPublicKey
 	issue.Claims.ClaimsData.Issuer = signingPublicKey
+	issue.Claims.Account.Authorization = authorization
 	issue.Claims.ClaimsData.IssuedAt = time.Now().Unix()
-	// TODO: dont know how to handle scopes of signing keys
 	issue.Claims.Account.SigningKeys = signingPublicKeys
+	issue.Claims.Account.ScopedSigningKeys = scopedSigningKeys
+	issue.Claims.Account.Imports = imports
 	natsJwt, err := v1alpha1.Convert(&issue.Claims)
 	if err != nil {
 		return fmt.Errorf("could not convert claims to nats jwt: %s", err)
@@ -575,6 +800,75 @@ func issueAccountJWT(ctx context.Context, storage logical.Storage, issue IssueAc
 	return nil
 }
 
+// readAccountSigningPublicKey returns the public key of the named account signing nkey.
+// Signing keys given as public keys are returned as they are.
+// An empty string is returned if the signing nkey does not exist.
+func readAccountSigningPublicKey(ctx context.Context, storage logical.Storage, issue IssueAccountStorage, signingKey string) (string, error) {
+	if isSigningPublicKey(signingKey, nkeys.PrefixByteAccount) {
+		return signingKey, nil
+	}
+	data, err := readAccountSigningNkey(ctx, storage, NkeyParameters{
+		Operator: issue.Operator,
+		Account:  issue.Account,
+		Signing:  signingKey,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not read signing key")
+	}
+	if data == nil {
+		log.Warn().
+			Str("operator", issue.Operator).Str("account", issue.Account).
+			Msgf("signing nkey does not exist: %s - Cannot create jwt.", signingKey)
+		return "", nil
+	}
+	signingKeyPair, err := nkeys.FromSeed(data.Seed)
+	if err != nil {
+		return "", err
+	}
+	return signingKeyPair.PublicKey()
+}
+
+// readAccountPublicKey returns the public key of the account nkey.
+// An empty string is returned if the account nkey does not exist.
+func readAccountPublicKey(ctx context.Context, storage logical.Storage, operator string, account string) (string, error) {
+	data, err := readAccountNkey(ctx, storage, NkeyParameters{
+		Operator: operator,
+		Account:  account,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not read account nkey: %s", err)
+	}
+	if data == nil {
+		return "", nil
+	}
+	keyPair, err := nkeys.FromSeed(data.Seed)
+	if err != nil {
+		return "", err
+	}
+	return keyPair.PublicKey()
+}
+
+// getAccountSigningKeyNames returns the names of all signing keys
+// of an account, scoped or not.
+func getAccountSigningKeyNames(claims *v1alpha1.AccountClaims) []string {
+	names := append([]string{}, claims.SigningKeys...)
+	for _, scope := range claims.ScopedSigningKeys {
+		names = append(names, scope.Key)
+	}
+	return names
+}
+
+// getAccountSigningKeyScope returns the scope of the named
+// account signing key or nil if the key is not scoped.
+func getAccountSigningKeyScope(claims *v1alpha1.AccountClaims, signingKey string) *v1alpha1.ScopedSigningKey {
+	for i := range claims.ScopedSigningKeys {
+		if claims.ScopedSigningKeys[i].Key == signingKey {
+			return &claims.ScopedSigningKeys[i]
+		}
+	}
+	return nil
+}
+
 func updateUserIssues(ctx context.Context, storage logical.Storage, issue IssueAccountStorage) error {
 
 	users, err := listUserIssues(ctx, storage, IssueUserParameters{
@@ -597,6 +891,14 @@ func updateUserIssues(ctx context.Context, storage logical.Storage, issue IssueA
 		if user == nil {
 			return err
 		}
+		// users that can't be signed anymore are left as they are
+		// and show up in their status
+		_, err = resolveUserSigningKey(ctx, storage, user.Operator, user.Account, user.UseSigningKey)
+		if err != nil {
+			log.Warn().Str("operator", issue.Operator).Str("account", issue.Account).Str("user", user.User).Err(err).
+				Msg("user is not updated")
+			continue
+		}
 		err = refreshUser(ctx, storage, user)
 		if err != nil {
 			return err
@@ -605,6 +907,54 @@ func updateUserIssues(ctx context.Context, storage logical.Storage, issue IssueA
 	return nil
 }
 
+// AccountServerSyncOptions configure how many nats-servers have
+// to acknowledge a push to the account server
+// +k8s:deepcopy-gen=true
+type AccountServerSyncOptions struct {
+	// Number of nats-servers that have to acknowledge a push
+	// for the account to be synced. Defaults to 1.
+	Quorum int `json:"quorum,omitempty"`
+	// Time to wait for the responses of the nats-servers, e.g. "2s". Defaults to 1s.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+func (o *AccountServerSyncOptions) quorum() int {
+	if o == nil || o.Quorum < 1 {
+		return 1
+	}
+	return o.Quorum
+}
+
+// checkQuorum returns an error if the request to the account server
+// failed or was not acknowledged by enough nats-servers
+func (o *AccountServerSyncOptions) checkQuorum(result *resolver.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if !result.QuorumMet(o.quorum()) {
+		return fmt.Errorf("%d of %d required nats-servers acknowledged", len(result.Acknowledged), o.quorum())
+	}
+	return nil
+}
+
+func (o *AccountServerSyncOptions) resolverOptions(tls *resolver.TLSConfig) (resolver.Options, error) {
+	opts := resolver.Options{
+		TLS: tls,
+	}
+	if o == nil || o.Timeout == "" {
+		return opts, nil
+	}
+	timeout, err := time.ParseDuration(o.Timeout)
+	if err != nil {
+		return opts, err
+	}
+	if timeout <= 0 {
+		return opts, fmt.Errorf("timeout must be positive")
+	}
+	opts.Timeout = timeout
+	return opts, nil
+}
+
 type AccountResolverAction string
 
 const (
@@ -655,83 +1005,44 @@ func refreshAccountResolver(ctx context.Context, storage logical.Storage, issue
 		return nil
 	}
 
-	// read system account user jwt
-	sysUserJWT, err := readUserJWT(ctx, storage, JWTParameters{
-		Operator: issue.Operator,
-		Account:  DefaultSysAccountName,
-		User:     DefaultPushUser,
-	})
-	if err != nil {
-		return err
-	} else if sysUserJWT == nil {
-		log.Warn().Str("operator", issue.Operator).
-			Str("account", issue.Account).
-			Msg("cannot sync account server: system account user jwt does not exist")
-		return nil
-	}
-
-	// read system account user nkey
-	sysUserNkey, err := readUserNkey(ctx, storage, NkeyParameters{
-		Operator: issue.Operator,
-		Account:  DefaultSysAccountName,
-		User:     DefaultPushUser,
-	})
-	if err != nil {
-		return err
-	} else if sysUserNkey == nil {
-		log.Error().Str("operator", issue.Operator).
-			Str("account", issue.Account).
-			Msg("cannot sync account server: system account user nkey does not exist")
-		return nil
-	}
-
-	sysUserKp, err := nkeys.FromSeed(sysUserNkey.Seed)
-	if err != nil {
-		return err
-	}
-
 	// connect to nats
-	resolver, err := resolver.NewResolver(op.Claims.AccountServerURL, []byte(sysUserJWT.JWT), sysUserKp)
+	resolver, err := openAccountResolver(ctx, storage, op)
 	if err != nil {
 		log.Warn().Str("operator", issue.Operator).
 			Str("account", issue.Account).
 			Err(err).
 			Msg("cannot create conection to account server")
-		resolver.CloseConnection()
+		issue.Status.AccountServer.Synced = false
+		issue.Status.AccountServer.Error = err.Error()
+		return nil
+	} else if resolver == nil {
 		return nil
 	}
 	defer resolver.CloseConnection()
 
 	switch {
 	case action == AccountResolverActionPush:
-		err = resolver.PushAccount(issue.Account, []byte(accJWT.JWT))
+		result, err := resolver.PushAccount(issue.Account, []byte(accJWT.JWT))
+		issue.Status.AccountServer.Result = result
+		err = op.AccountServerSync.checkQuorum(result, err)
 		if err != nil {
 			log.Error().Str("operator", issue.Operator).
 				Str("account", issue.Account).
 				Err(err).
 				Msg("cannot sync account server (add)")
-			resolver.CloseConnection()
+			issue.Status.AccountServer.Synced = false
+			issue.Status.AccountServer.Error = err.Error()
 			return nil
 		}
 	case action == AccountResolverActionDelete:
-		operatorNkey, err := readOperatorNkey(ctx, storage, NkeyParameters{
-			Operator: issue.Operator,
-		})
+		operatorKeypair, err := readOperatorOnlineKeyPair(ctx, storage, issue.Operator)
 		if err != nil {
 			return err
-		} else if operatorNkey == nil {
+		} else if operatorKeypair == nil {
 			log.Warn().Str("operator", issue.Operator).
 				Msg("cannot sync account server: operator nkey does not exist")
 			return nil
 		}
-		kp, err := toNkeyData(operatorNkey)
-		if err != nil {
-			return err
-		}
-		operatorKeypair, err := nkeys.FromSeed([]byte(kp.Seed))
-		if err != nil {
-			return err
-		}
 
 		// read account jwt
 		accNkey, err := readAccountNkey(ctx, storage, NkeyParameters{
@@ -746,7 +1057,7 @@ func refreshAccountResolver(ctx context.Context, storage logical.Storage, issue
 				Msg("cannot sync account server: account neky does not exist")
 			return nil
 		}
-		kp, err = toNkeyData(accNkey)
+		kp, err := toNkeyData(accNkey)
 		if err != nil {
 			return err
 		}
@@ -758,7 +1069,8 @@ func refreshAccountResolver(ctx context.Context, storage logical.Storage, issue
 		if err != nil {
 			return err
 		}
-		_, err = resolver.DeleteAccounts([]string{accountPubKey}, operatorKeypair)
+		result, err := resolver.DeleteAccounts([]string{accountPubKey}, operatorKeypair)
+		err = op.AccountServerSync.checkQuorum(result, err)
 		if err != nil {
 			log.Error().Str("operator", issue.Operator).
 				Str("account", issue.Account).
@@ -772,20 +1084,97 @@ func refreshAccountResolver(ctx context.Context, storage logical.Storage, issue
 	// update issue status
 	issue.Status.AccountServer.Synced = true
 	issue.Status.AccountServer.LastSync = time.Now().Unix()
+	issue.Status.AccountServer.Error = ""
 	return nil
 }
 
+// newAccountServerResolver connects to the account server of the operator.
+// The implementation is chosen by the scheme of the account server url:
+// http(s) account servers are reached via their REST API, nats and tls urls
+// using the system account's push user. nil is returned if the push user
+// has no jwt or nkey yet.
+func newAccountServerResolver(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) (resolver.AccountResolver, error) {
+	opts, err := op.AccountServerSync.resolverOptions(op.AccountServerTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolver.IsHTTPURL(op.Claims.AccountServerURL) {
+		httpResolver, err := resolver.NewHTTPResolver(op.Claims.AccountServerURL, opts)
+		if err != nil {
+			return nil, err
+		}
+		return httpResolver, nil
+	}
+
+	// read system account user jwt
+	sysUserJWT, err := readUserJWT(ctx, storage, JWTParameters{
+		Operator: op.Operator,
+		Account:  DefaultSysAccountName,
+		User:     DefaultPushUser,
+	})
+	if err != nil {
+		return nil, err
+	} else if sysUserJWT == nil {
+		log.Warn().Str("operator", op.Operator).
+			Msg("cannot sync account server: system account user jwt does not exist")
+		return nil, nil
+	}
+
+	// read system account user nkey
+	sysUserNkey, err := readUserNkey(ctx, storage, NkeyParameters{
+		Operator: op.Operator,
+		Account:  DefaultSysAccountName,
+		User:     DefaultPushUser,
+	})
+	if err != nil {
+		return nil, err
+	} else if sysUserNkey == nil {
+		log.Error().Str("operator", op.Operator).
+			Msg("cannot sync account server: system account user nkey does not exist")
+		return nil, nil
+	}
+
+	sysUserKp, err := nkeys.FromSeed(sysUserNkey.Seed)
+	if err != nil {
+		return nil, err
+	}
+
+	natsResolver, err := resolver.NewResolver(op.Claims.AccountServerURL, []byte(sysUserJWT.JWT), sysUserKp, opts)
+	if err != nil {
+		return nil, err
+	}
+	return natsResolver, nil
+}
+
+// readOperatorKeyPair returns the key pair of the operator nkey
+// or nil if the operator nkey does not exist.
+func readOperatorKeyPair(ctx context.Context, storage logical.Storage, operator string) (nkeys.KeyPair, error) {
+	operatorNkey, err := readOperatorNkey(ctx, storage, NkeyParameters{
+		Operator: operator,
+	})
+	if err != nil {
+		return nil, err
+	} else if operatorNkey == nil {
+		return nil, nil
+	}
+	return nkeys.FromSeed(operatorNkey.Seed)
+}
+
 func getAccountIssuePath(operator string, account string) string {
 	return "issue/operator/" + operator + "/account/" + account
 }
 
 func createResponseIssueAccountData(issue *IssueAccountStorage) (*logical.Response, error) {
 	data := &IssueAccountData{
-		Operator:      issue.Operator,
-		Account:       issue.Account,
-		UseSigningKey: issue.UseSigningKey,
-		Claims:        issue.Claims,
-		Status:        issue.Status,
+		Operator:           issue.Operator,
+		Account:            issue.Account,
+		UseSigningKey:      issue.UseSigningKey,
+		DefaultSigningKey:  issue.DefaultSigningKey,
+		Claims:             issue.Claims,
+		AuthCallout:        issue.AuthCallout,
+		RetiredSigningKeys: issue.RetiredSigningKeys,
+		Status:             issue.Status,
 	}
 
 	rval := map[string]interface{}{}
@@ -863,13 +1252,40 @@ func addUserToRevocationList(ctx context.Context, storage logical.Storage, accou
 	if err != nil {
 		return err
 	}
+	return addPublicKeyToRevocationList(ctx, storage, account, userPubKey)
+}
+
+// addLeaseToRevocationList revokes the user of a leased creds until its JWT expires
+func addLeaseToRevocationList(ctx context.Context, storage logical.Storage, account *IssueAccountStorage, userPubKey string, expiresAt int64) error {
+	if expiresAt > 0 {
+		if account.LeaseRevocations == nil {
+			account.LeaseRevocations = map[string]int64{}
+		}
+		account.LeaseRevocations[userPubKey] = expiresAt
+	}
+	return addPublicKeyToRevocationList(ctx, storage, account, userPubKey)
+}
+
+// pruneLeaseRevocations drops the revocations of leased creds whose JWTs
+// have expired, so the revocation list doesn't grow with every lease
+func pruneLeaseRevocations(account *IssueAccountStorage, now time.Time) {
+	for userPubKey, expiresAt := range account.LeaseRevocations {
+		if expiresAt > now.Unix() {
+			continue
+		}
+		delete(account.Claims.Revocations, userPubKey)
+		delete(account.LeaseRevocations, userPubKey)
+	}
+}
+
+func addPublicKeyToRevocationList(ctx context.Context, storage logical.Storage, account *IssueAccountStorage, userPubKey string) error {
 	// add user to revocation list and store
 	if account.Claims.Revocations == nil {
 		account.Claims.Revocations = map[string]int64{}
 	}
 	account.Claims.Revocations[userPubKey] = time.Now().Unix()
 	path := getAccountIssuePath(account.Operator, account.Account)
-	err = storeInStorage(ctx, storage, path, &account)
+	err := storeInStorage(ctx, storage, path, account)
 	if err != nil {
 		return err
 	}
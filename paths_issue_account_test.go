@@ -4,6 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	accountv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/account/v1alpha1"
@@ -767,3 +772,215 @@ func Test_UnmarshalIssueAccountParameters(t *testing.T) {
 	assert.Nil(err)
 	fmt.Printf("%+v\n", claims)
 }
+
+func TestAccountIssueHTTPAccountServer(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	var mu sync.Mutex
+	accounts := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		account := strings.TrimPrefix(r.URL.Path, "/jwt/v1/accounts/")
+		switch r.Method {
+		case http.MethodPost:
+			body, _ := io.ReadAll(r.Body)
+			accounts[account] = string(body)
+		case http.MethodDelete:
+			delete(accounts, account)
+		}
+	}))
+	defer srv.Close()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"syncAccountServer": true,
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"accountServerUrl": srv.URL + "/jwt/v1",
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	// the account jwt is posted to the account server
+	issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+		Operator: "op1",
+		Account:  "ac1",
+	})
+	assert.NoError(t, err)
+	assert.True(t, issue.Status.AccountServer.Synced)
+	assert.Empty(t, issue.Status.AccountServer.Error)
+
+	accountJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+		Operator: "op1",
+		Account:  "ac1",
+	})
+	assert.NoError(t, err)
+	claims, err := jwt.DecodeAccountClaims(accountJWT.JWT)
+	assert.NoError(t, err)
+	mu.Lock()
+	assert.Equal(t, accountJWT.JWT, accounts[claims.Subject])
+	mu.Unlock()
+
+	// and deleted with the account issue
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+	mu.Lock()
+	assert.NotContains(t, accounts, claims.Subject)
+	mu.Unlock()
+}
+
+func TestAccountIssueTieredLimits(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	t.Run("Test tiered limits are published in the account jwt", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/ac1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"claims": map[string]interface{}{
+					"account": map[string]interface{}{
+						"limits": map[string]interface{}{
+							"tieredLimits": map[string]interface{}{
+								"R1": map[string]interface{}{"diskStorage": 1024},
+								"R3": map[string]interface{}{"diskStorage": 512},
+							},
+						},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		accountJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(accountJWT.JWT)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1024), claims.Limits.JetStreamTieredLimits["R1"].DiskStorage)
+		assert.Equal(t, int64(512), claims.Limits.JetStreamTieredLimits["R3"].DiskStorage)
+	})
+
+	t.Run("Test invalid tiered limits are refused", func(t *testing.T) {
+		for name, limits := range map[string]map[string]interface{}{
+			"empty tier name": {
+				"tieredLimits": map[string]interface{}{
+					"": map[string]interface{}{"diskStorage": 1024},
+				},
+			},
+			"tiered and flat limits": {
+				"diskStorage": 1024,
+				"tieredLimits": map[string]interface{}{
+					"R1": map[string]interface{}{"diskStorage": 1024},
+				},
+			},
+		} {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "issue/operator/op1/account/ac2",
+				Storage:   reqStorage,
+				Data: map[string]interface{}{
+					"claims": map[string]interface{}{
+						"account": map[string]interface{}{
+							"limits": limits,
+						},
+					},
+				},
+			})
+			assert.NoError(t, err, name)
+			assert.True(t, resp.IsError(), name)
+		}
+
+		// the invalid issue is not stored
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "ac2",
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, issue)
+	})
+}
+
+func TestAccountIssueCascadeDelete(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	userExists := func(account string, user string) bool {
+		issue, err := readUserIssue(context.Background(), reqStorage, IssueUserParameters{Operator: "op1", Account: account, User: user})
+		assert.NoError(t, err)
+		nkey, err := readUserNkey(context.Background(), reqStorage, NkeyParameters{Operator: "op1", Account: account, User: user})
+		assert.NoError(t, err)
+		token, err := readUserJWT(context.Background(), reqStorage, JWTParameters{Operator: "op1", Account: account, User: user})
+		assert.NoError(t, err)
+		creds, err := readUserCreds(context.Background(), reqStorage, CredsParameters{Operator: "op1", Account: account, User: user})
+		assert.NoError(t, err)
+		return issue != nil || nkey != nil || token != nil || creds != nil
+	}
+
+	resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+	for _, account := range []string{"ac1", "ac2"} {
+		resp = request(logical.CreateOperation, "issue/operator/op1/account/"+account, map[string]interface{}{})
+		assert.False(t, resp.IsError())
+		resp = request(logical.CreateOperation, "issue/operator/op1/account/"+account+"/user/u1", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+	}
+
+	t.Run("Test delete keeps the users of the account", func(t *testing.T) {
+		resp := request(logical.DeleteOperation, "issue/operator/op1/account/ac1", nil)
+		assert.Nil(t, resp)
+		assert.True(t, userExists("ac1", "u1"))
+	})
+
+	t.Run("Test cascading delete removes the users of the account", func(t *testing.T) {
+		resp := request(logical.DeleteOperation, "issue/operator/op1/account/ac2", map[string]interface{}{"cascade": true})
+		assert.Nil(t, resp)
+		assert.False(t, userExists("ac2", "u1"))
+
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{Operator: "op1", Account: "ac2"})
+		assert.NoError(t, err)
+		assert.Nil(t, issue)
+	})
+}
@@ -0,0 +1,454 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	v1alpha1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/account/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// IssueActivationStorage is an activation token of a private export.
+// The token allows the target account to import the subject.
+type IssueActivationStorage struct {
+	Operator      string `json:"operator"`
+	Account       string `json:"account"`
+	Activation    string `json:"activation"`
+	Subject       string `json:"subject"`
+	Target        string `json:"target"`
+	UseSigningKey string `json:"useSigningKey"`
+	// TargetPublicKey is the public key of the importing account
+	TargetPublicKey string `json:"targetPublicKey"`
+	// Expires is the unix time the token expires, 0 if it never expires
+	Expires int64  `json:"expires"`
+	Token   string `json:"token"`
+}
+
+// IssueActivationParameters is the user facing interface for issuing an activation token.
+// Using pascal case on purpose.
+type IssueActivationParameters struct {
+	Operator      string        `json:"operator"`
+	Account       string        `json:"account"`
+	Activation    string        `json:"activation"`
+	Subject       string        `json:"subject"`
+	Target        string        `json:"target"`
+	UseSigningKey string        `json:"useSigningKey,omitempty"`
+	Expires       time.Duration `json:"-"`
+}
+
+// IssueActivationData represents the the data returned by an activation operation
+type IssueActivationData struct {
+	Operator        string `json:"operator"`
+	Account         string `json:"account"`
+	Activation      string `json:"activation"`
+	Subject         string `json:"subject"`
+	Target          string `json:"target"`
+	UseSigningKey   string `json:"useSigningKey"`
+	TargetPublicKey string `json:"targetPublicKey"`
+	Expires         int64  `json:"expires"`
+	Token           string `json:"token"`
+}
+
+func pathActivationIssue(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/activation/" + framework.GenericNameRegex("activation") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "identifier of the exporting account",
+					Required:    false,
+				},
+				"activation": {
+					Type:        framework.TypeString,
+					Description: "activation identifier",
+					Required:    false,
+				},
+				"subject": {
+					Type:        framework.TypeString,
+					Description: "Subject the target account may import. Must be covered by an export that requires a token.",
+					Required:    true,
+				},
+				"target": {
+					Type:        framework.TypeString,
+					Description: "Importing account, either the name of an account issue of the operator or an account public key",
+					Required:    true,
+				},
+				"useSigningKey": {
+					Type:        framework.TypeString,
+					Description: "Account signing key to sign the activation token",
+					Required:    false,
+				},
+				"expires": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Time the activation token is valid. If set to 0, the token never expires.",
+					Required:    false,
+					Default:     0,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathAddActivationIssue,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathAddActivationIssue,
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReadActivationIssue,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathDeleteActivationIssue,
+				},
+			},
+			HelpSynopsis:    `Manages activation tokens of private exports.`,
+			HelpDescription: `Issues an activation token that allows the target account to import a subject of an export that requires a token. Account issues importing the subject can reference the activation by name.`,
+		},
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/activation/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathListActivationIssues,
+				},
+			},
+			HelpSynopsis:    "Lists the activation tokens of an account.",
+			HelpDescription: "",
+		},
+	}
+}
+
+func (b *NatsBackend) pathAddActivationIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	params := IssueActivationParameters{
+		Operator:      data.Get("operator").(string),
+		Account:       data.Get("account").(string),
+		Activation:    data.Get("activation").(string),
+		Subject:       data.Get("subject").(string),
+		Target:        data.Get("target").(string),
+		UseSigningKey: data.Get("useSigningKey").(string),
+		Expires:       time.Duration(data.Get("expires").(int)) * time.Second,
+	}
+
+	issue, err := addActivationIssue(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", IssuingActivationFailedError, err.Error())), nil
+	}
+	return createResponseIssueActivationData(issue)
+}
+
+func (b *NatsBackend) pathReadActivationIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	issue, err := readActivationIssue(ctx, req.Storage, data.Get("operator").(string), data.Get("account").(string), data.Get("activation").(string))
+	if err != nil {
+		return logical.ErrorResponse(ReadingIssueFailedError), nil
+	}
+	if issue == nil {
+		return logical.ErrorResponse(IssueNotFoundError), nil
+	}
+	return createResponseIssueActivationData(issue)
+}
+
+func (b *NatsBackend) pathListActivationIssues(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	entries, err := listActivationIssues(ctx, req.Storage, data.Get("operator").(string), data.Get("account").(string))
+	if err != nil {
+		return logical.ErrorResponse(ListIssuesFailedError), nil
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *NatsBackend) pathDeleteActivationIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	err = deleteActivationIssue(ctx, req.Storage, data.Get("operator").(string), data.Get("account").(string), data.Get("activation").(string))
+	if err != nil {
+		return logical.ErrorResponse(DeleteIssueFailedError), nil
+	}
+	return nil, nil
+}
+
+// addActivationIssue signs an activation token for the target account
+// and re-issues the accounts that import it
+func addActivationIssue(ctx context.Context, storage logical.Storage, params IssueActivationParameters) (*IssueActivationStorage, error) {
+	log.Info().
+		Str("operator", params.Operator).Str("account", params.Account).
+		Msgf("issue activation %s", params.Activation)
+
+	if params.Subject == "" {
+		return nil, fmt.Errorf("subject is required")
+	}
+	if params.Target == "" {
+		return nil, fmt.Errorf("target is required")
+	}
+	if params.Expires < 0 {
+		return nil, fmt.Errorf("expires must not be negative")
+	}
+
+	account, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+	})
+	if err != nil {
+		return nil, err
+	} else if account == nil {
+		return nil, fmt.Errorf("account issue does not exist")
+	}
+
+	// the subject has to be covered by a private export
+	claims, err := v1alpha1.Convert(&account.Claims)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert account claims: %s", err)
+	}
+	var export *jwt.Export
+	for _, e := range claims.Exports {
+		if e.TokenReq && jwt.Subject(params.Subject).IsContainedIn(e.Subject) {
+			export = e
+			break
+		}
+	}
+	if export == nil {
+		return nil, fmt.Errorf("no export requiring a token matches subject %q", params.Subject)
+	}
+
+	targetPublicKey, err := resolveActivationTarget(ctx, storage, params.Operator, params.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeyPair, accountPublicKey, err := readUserSigningKeyPair(ctx, storage, params.Operator, params.Account, params.UseSigningKey)
+	if err != nil {
+		return nil, err
+	} else if signingKeyPair == nil {
+		return nil, fmt.Errorf("account nkey does not exist")
+	}
+
+	activation := jwt.NewActivationClaims(targetPublicKey)
+	activation.Name = params.Activation
+	activation.ImportSubject = jwt.Subject(params.Subject)
+	activation.ImportType = export.Type
+	if params.UseSigningKey != "" {
+		activation.IssuerAccount = accountPublicKey
+	}
+	if params.Expires > 0 {
+		activation.Expires = time.Now().Add(params.Expires).Unix()
+	}
+	token, err := activation.Encode(signingKeyPair)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode activation jwt: %s", err)
+	}
+
+	issue := &IssueActivationStorage{
+		Operator:        params.Operator,
+		Account:         params.Account,
+		Activation:      params.Activation,
+		Subject:         params.Subject,
+		Target:          params.Target,
+		UseSigningKey:   params.UseSigningKey,
+		TargetPublicKey: targetPublicKey,
+		Expires:         activation.Expires,
+		Token:           token,
+	}
+	err = storeInStorage(ctx, storage, getActivationIssuePath(params.Operator, params.Account, params.Activation), issue)
+	if err != nil {
+		return nil, err
+	}
+
+	err = refreshActivationImporters(ctx, storage, params.Operator, params.Account, accountPublicKey, params.Activation)
+	if err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// resolveActivationTarget returns the public key of the importing account.
+// The target is either an account public key or the name of an account issue.
+func resolveActivationTarget(ctx context.Context, storage logical.Storage, operator string, target string) (string, error) {
+	if nkeys.IsValidPublicAccountKey(target) {
+		return target, nil
+	}
+	publicKey, err := readAccountPublicKey(ctx, storage, operator, target)
+	if err != nil {
+		return "", err
+	}
+	if publicKey == "" {
+		return "", fmt.Errorf("target account %q does not exist", target)
+	}
+	return publicKey, nil
+}
+
+func readActivationIssue(ctx context.Context, storage logical.Storage, operator string, account string, activation string) (*IssueActivationStorage, error) {
+	path := getActivationIssuePath(operator, account, activation)
+	return getFromStorage[IssueActivationStorage](ctx, storage, path)
+}
+
+func listActivationIssues(ctx context.Context, storage logical.Storage, operator string, account string) ([]string, error) {
+	path := getActivationIssuePath(operator, account, "")
+	return listIssues(ctx, storage, path)
+}
+
+func deleteActivationIssue(ctx context.Context, storage logical.Storage, operator string, account string, activation string) error {
+	issue, err := readActivationIssue(ctx, storage, operator, account, activation)
+	if err != nil {
+		return err
+	}
+	if issue == nil {
+		// nothing to delete
+		return nil
+	}
+
+	err = deleteFromStorage(ctx, storage, getActivationIssuePath(operator, account, activation))
+	if err != nil {
+		return err
+	}
+
+	// importers drop the token of the deleted activation
+	accountPublicKey, err := readAccountPublicKey(ctx, storage, operator, account)
+	if err != nil {
+		return err
+	}
+	return refreshActivationImporters(ctx, storage, operator, account, accountPublicKey, activation)
+}
+
+// deleteActivationIssues deletes all activations of an account
+func deleteActivationIssues(ctx context.Context, storage logical.Storage, operator string, account string) error {
+	activations, err := listActivationIssues(ctx, storage, operator, account)
+	if err != nil {
+		return err
+	}
+	for _, activation := range activations {
+		err := deleteFromStorage(ctx, storage, getActivationIssuePath(operator, account, activation))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshActivationImporters re-issues all accounts of the operator
+// that import from the exporting account using the named activation
+func refreshActivationImporters(ctx context.Context, storage logical.Storage, operator string, exporter string, exporterPublicKey string, activation string) error {
+	accounts, err := listAccountIssues(ctx, storage, operator)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+			Operator: operator,
+			Account:  account,
+		})
+		if err != nil {
+			return err
+		}
+		if issue == nil {
+			continue
+		}
+		for _, imp := range issue.Claims.Imports {
+			if imp.Activation == activation && importsFrom(imp, exporter, exporterPublicKey) {
+				log.Info().
+					Str("operator", operator).Str("account", account).
+					Msgf("activation %s modified, account will be updated", activation)
+				err := refreshAccount(ctx, storage, issue)
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// resolveImportActivation returns the token of the activation the import references.
+// An empty token is returned if the activation does not exist or is issued for another account.
+func resolveImportActivation(ctx context.Context, storage logical.Storage, issue IssueAccountStorage, imp v1alpha1.Import, exporter string, accountPublicKey string) (string, error) {
+	if exporter == "" {
+		log.Warn().
+			Str("operator", issue.Operator).Str("account", issue.Account).
+			Msgf("import %q: exporting account %s is not managed by the operator", imp.Name, imp.Account)
+		return "", nil
+	}
+	activation, err := readActivationIssue(ctx, storage, issue.Operator, exporter, imp.Activation)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case activation == nil:
+		log.Warn().
+			Str("operator", issue.Operator).Str("account", issue.Account).
+			Msgf("import %q: activation %s of account %s does not exist", imp.Name, imp.Activation, exporter)
+		return "", nil
+	case activation.TargetPublicKey != accountPublicKey:
+		log.Warn().
+			Str("operator", issue.Operator).Str("account", issue.Account).
+			Msgf("import %q: activation %s of account %s is issued for account %s", imp.Name, imp.Activation, exporter, activation.TargetPublicKey)
+		return "", nil
+	}
+	return activation.Token, nil
+}
+
+func getActivationIssuePath(operator string, account string, activation string) string {
+	return getAccountIssuePath(operator, account) + "/activation/" + activation
+}
+
+func createResponseIssueActivationData(issue *IssueActivationStorage) (*logical.Response, error) {
+	data := &IssueActivationData{
+		Operator:        issue.Operator,
+		Account:         issue.Account,
+		Activation:      issue.Activation,
+		Subject:         issue.Subject,
+		Target:          issue.Target,
+		UseSigningKey:   issue.UseSigningKey,
+		TargetPublicKey: issue.TargetPublicKey,
+		Expires:         issue.Expires,
+		Token:           issue.Token,
+	}
+
+	rval := map[string]interface{}{}
+	err := stm.StructToMap(data, &rval)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: rval,
+	}
+	return resp, nil
+}
@@ -0,0 +1,237 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivationIssue(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/exporter",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"signingKeys": []interface{}{"acsk1"},
+					"limits": map[string]interface{}{
+						"exports":         -1,
+						"wildcardExports": true,
+					},
+					"exports": []interface{}{
+						map[string]interface{}{
+							"name":     "private",
+							"subject":  "private.>",
+							"type":     "Service",
+							"tokenReq": true,
+						},
+						map[string]interface{}{
+							"name":    "public",
+							"subject": "public.>",
+							"type":    "Stream",
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/importer",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	readAccountClaims := func(account string) *jwt.AccountClaims {
+		accountJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  account,
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(accountJWT.JWT)
+		assert.NoError(t, err)
+		return claims
+	}
+	exporterPublicKey := readAccountClaims("exporter").Subject
+	importerPublicKey := readAccountClaims("importer").Subject
+
+	t.Run("Test activation for an account issue", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/exporter/activation/act1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"subject": "private.foo",
+				"target":  "importer",
+				"expires": "1h",
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, importerPublicKey, resp.Data["targetPublicKey"])
+
+		activation, err := jwt.DecodeActivationClaims(resp.Data["token"].(string))
+		assert.NoError(t, err)
+		assert.Equal(t, importerPublicKey, activation.Subject)
+		assert.Equal(t, exporterPublicKey, activation.Issuer)
+		assert.Empty(t, activation.IssuerAccount)
+		assert.Equal(t, jwt.Subject("private.foo"), activation.ImportSubject)
+		assert.Equal(t, jwt.Service, activation.ImportType)
+		assert.NotZero(t, activation.Expires)
+		assert.EqualValues(t, activation.Expires, resp.Data["expires"])
+	})
+
+	t.Run("Test activation for a public key signed with a signing key", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/exporter/activation/act2",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"subject":       "private.>",
+				"target":        importerPublicKey,
+				"useSigningKey": "acsk1",
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		activation, err := jwt.DecodeActivationClaims(resp.Data["token"].(string))
+		assert.NoError(t, err)
+		assert.Equal(t, importerPublicKey, activation.Subject)
+		assert.NotEqual(t, exporterPublicKey, activation.Issuer)
+		assert.Equal(t, exporterPublicKey, activation.IssuerAccount)
+		assert.Zero(t, activation.Expires)
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ListOperation,
+			Path:      "issue/operator/op1/account/exporter/activation",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, []string{"act1", "act2"}, resp.Data["keys"])
+	})
+
+	t.Run("Test invalid activations are refused", func(t *testing.T) {
+		for name, data := range map[string]map[string]interface{}{
+			"public export":   {"subject": "public.foo", "target": "importer"},
+			"unknown subject": {"subject": "other.foo", "target": "importer"},
+			"unknown target":  {"subject": "private.foo", "target": "unknown"},
+			"no target":       {"subject": "private.foo"},
+		} {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "issue/operator/op1/account/exporter/activation/invalid",
+				Storage:   reqStorage,
+				Data:      data,
+			})
+			assert.NoError(t, err, name)
+			assert.True(t, resp.IsError(), name)
+		}
+	})
+
+	t.Run("Test importing account references the activation", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/importer",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"claims": map[string]interface{}{
+					"account": map[string]interface{}{
+						"limits": map[string]interface{}{
+							"imports": -1,
+						},
+						"imports": []interface{}{
+							map[string]interface{}{
+								"name":       "private",
+								"subject":    "private.foo",
+								"account":    exporterPublicKey,
+								"type":       "Service",
+								"activation": "act1",
+							},
+						},
+					},
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		activation, err := readActivationIssue(context.Background(), reqStorage, "op1", "exporter", "act1")
+		assert.NoError(t, err)
+		claims := readAccountClaims("importer")
+		assert.Len(t, claims.Imports, 1)
+		assert.Equal(t, activation.Token, claims.Imports[0].Token)
+		vr := jwt.CreateValidationResults()
+		claims.Validate(vr)
+		assert.Empty(t, vr.Errors())
+
+		// the token is not stored in the claims of the issue
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "importer",
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, issue.Claims.Imports[0].Token)
+
+		// re-issuing the activation updates the importer
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/exporter/activation/act1",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"subject": "private.foo",
+				"target":  "importer",
+				"expires": "2h",
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.NotEqual(t, activation.Token, resp.Data["token"])
+		assert.Equal(t, resp.Data["token"], readAccountClaims("importer").Imports[0].Token)
+
+		// deleting the activation removes the token
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "issue/operator/op1/account/exporter/activation/act1",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Empty(t, readAccountClaims("importer").Imports[0].Token)
+	})
+
+	t.Run("Test activations are deleted with the account", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "issue/operator/op1/account/exporter",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		activations, err := listActivationIssues(context.Background(), reqStorage, "op1", "exporter")
+		assert.NoError(t, err)
+		assert.Empty(t, activations)
+	})
+}
@@ -0,0 +1,517 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	accountv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/account/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/common"
+	operatorv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/operator/v1alpha1"
+	userv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// Adopting an issue takes over an entity whose nkey and JWT have been
+// written to the nkey and jwt paths. The claims of the issue are filled
+// from the stored JWT, public keys are replaced by the names of the stored
+// nkeys. Signing keys without a stored nkey are kept as public keys, they
+// are published but can't be used to sign.
+
+// AdoptIssueParameters is the user facing interface for adopting an issue.
+// Using pascal case on purpose.
+type AdoptIssueParameters struct {
+	Operator string `json:"operator"`
+	Account  string `json:"account,omitempty"`
+	User     string `json:"user,omitempty"`
+}
+
+func pathAdoptIssue(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/adopt$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathAdoptOperatorIssue,
+				},
+			},
+			HelpSynopsis:    `Adopts the stored operator nkey and JWT.`,
+			HelpDescription: `Fills the claims of the operator issue from the stored operator JWT. The JWT must belong to the stored operator nkey.`,
+		},
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/adopt$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathAdoptAccountIssue,
+				},
+			},
+			HelpSynopsis:    `Adopts the stored account nkey and JWT.`,
+			HelpDescription: `Fills the claims of the account issue from the stored account JWT. The JWT must belong to the stored account nkey and be signed by the operator nkey or one of its signing nkeys.`,
+		},
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/user/" + framework.GenericNameRegex("user") + "/adopt$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier",
+					Required:    false,
+				},
+				"user": {
+					Type:        framework.TypeString,
+					Description: "user identifier",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathAdoptUserIssue,
+				},
+			},
+			HelpSynopsis:    `Adopts the stored user nkey and JWT.`,
+			HelpDescription: `Fills the claims of the user issue from the stored user JWT. The JWT must belong to the stored user nkey and be signed by the account nkey or one of its signing nkeys.`,
+		},
+	}
+}
+
+func (b *NatsBackend) pathAdoptOperatorIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	params, resp, err := getAdoptIssueParameters(data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	issue, err := adoptOperatorIssue(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AdoptingIssueFailedError, err.Error())), nil
+	}
+	status := getIssueOperatorStatus(ctx, req.Storage, issue)
+	return createResponseIssueOperatorData(issue, status)
+}
+
+func (b *NatsBackend) pathAdoptAccountIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	params, resp, err := getAdoptIssueParameters(data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	issue, err := adoptAccountIssue(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AdoptingIssueFailedError, err.Error())), nil
+	}
+	return createResponseIssueAccountData(issue)
+}
+
+func (b *NatsBackend) pathAdoptUserIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	params, resp, err := getAdoptIssueParameters(data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	issue, err := adoptUserIssue(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AdoptingIssueFailedError, err.Error())), nil
+	}
+	return createResponseIssueUserData(issue)
+}
+
+func getAdoptIssueParameters(data *framework.FieldData) (AdoptIssueParameters, *logical.Response, error) {
+	params := AdoptIssueParameters{}
+	err := data.Validate()
+	if err != nil {
+		return params, logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return params, logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+	return params, nil, nil
+}
+
+func adoptOperatorIssue(ctx context.Context, storage logical.Storage, params AdoptIssueParameters) (*IssueOperatorStorage, error) {
+	log.Info().
+		Str("operator", params.Operator).
+		Msg("adopt operator")
+
+	stored, err := readOperatorJWT(ctx, storage, JWTParameters{
+		Operator: params.Operator,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("operator jwt does not exist")
+	}
+	natsJwt, err := jwt.DecodeOperatorClaims(stored.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode operator jwt: %s", err)
+	}
+
+	operatorPublicKey, err := readOperatorPublicKey(ctx, storage, params.Operator)
+	if err != nil {
+		return nil, err
+	}
+	if operatorPublicKey == "" {
+		return nil, fmt.Errorf("operator nkey does not exist")
+	}
+	if natsJwt.Subject != operatorPublicKey {
+		return nil, fmt.Errorf("operator jwt subject %s does not match the operator nkey %s", natsJwt.Subject, operatorPublicKey)
+	}
+
+	// the system account is set from the system account nkey
+	if natsJwt.SystemAccount != "" {
+		sysAccountPublicKey, err := readAccountPublicKey(ctx, storage, params.Operator, DefaultSysAccountName)
+		if err != nil {
+			return nil, err
+		}
+		if natsJwt.SystemAccount != sysAccountPublicKey {
+			return nil, fmt.Errorf("system account %s of the operator jwt does not match the %s account nkey", natsJwt.SystemAccount, DefaultSysAccountName)
+		}
+	}
+
+	issue, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{
+		Operator: params.Operator,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if issue == nil {
+		issue = &IssueOperatorStorage{
+			Operator: params.Operator,
+		}
+	}
+
+	claims := operatorv1.ConvertFrom(natsJwt)
+	signingKeys, err := listSigningPublicKeys(ctx, storage, getOperatorSigningNkeyPath(params.Operator, ""), issue.RetiredSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	claims.SigningKeys = adoptSigningKeys(claims.SigningKeys, signingKeys)
+	claims.SystemAccount = ""
+	clearSignedClaimsData(&claims.ClaimsData)
+
+	issue.Claims = *claims
+	err = storeInStorage(ctx, storage, getOperatorIssuePath(issue.Operator), issue)
+	if err != nil {
+		return nil, err
+	}
+	err = refreshOperator(ctx, storage, issue)
+	if err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+func adoptAccountIssue(ctx context.Context, storage logical.Storage, params AdoptIssueParameters) (*IssueAccountStorage, error) {
+	log.Info().
+		Str("operator", params.Operator).Str("account", params.Account).
+		Msg("adopt account")
+
+	stored, err := readAccountJWT(ctx, storage, JWTParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("account jwt does not exist")
+	}
+	natsJwt, err := jwt.DecodeAccountClaims(stored.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode account jwt: %s", err)
+	}
+
+	accountPublicKey, err := readAccountPublicKey(ctx, storage, params.Operator, params.Account)
+	if err != nil {
+		return nil, err
+	}
+	if accountPublicKey == "" {
+		return nil, fmt.Errorf("account nkey does not exist")
+	}
+	if natsJwt.Subject != accountPublicKey {
+		return nil, fmt.Errorf("account jwt subject %s does not match the account nkey %s", natsJwt.Subject, accountPublicKey)
+	}
+
+	// the account is re-signed by the key that signed the jwt
+	operatorPublicKey, err := readOperatorPublicKey(ctx, storage, params.Operator)
+	if err != nil {
+		return nil, err
+	}
+	if operatorPublicKey == "" {
+		return nil, fmt.Errorf("operator nkey does not exist")
+	}
+	useSigningKey := ""
+	if natsJwt.Issuer != operatorPublicKey {
+		operatorSigningKeys, err := listSigningPublicKeys(ctx, storage, getOperatorSigningNkeyPath(params.Operator, ""), nil)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		useSigningKey, ok = operatorSigningKeys[natsJwt.Issuer]
+		if !ok {
+			return nil, fmt.Errorf("account jwt is signed by %s, which is neither the operator nkey nor one of its signing nkeys", natsJwt.Issuer)
+		}
+	}
+
+	issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if issue == nil {
+		issue = &IssueAccountStorage{
+			Operator: params.Operator,
+			Account:  params.Account,
+		}
+	}
+
+	claims, err := accountv1.ConvertFrom(natsJwt)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert account jwt: %s", err)
+	}
+	signingKeys, err := listSigningPublicKeys(ctx, storage, getAccountSigningNkeyPath(params.Operator, params.Account, ""), issue.RetiredSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	claims.SigningKeys = adoptSigningKeys(claims.SigningKeys, signingKeys)
+	var scopes []accountv1.ScopedSigningKey
+	for _, scope := range claims.ScopedSigningKeys {
+		name, ok := signingKeys[scope.Key]
+		if ok && name == "" {
+			continue
+		}
+		if ok {
+			scope.Key = name
+		}
+		scopes = append(scopes, scope)
+	}
+	claims.ScopedSigningKeys = scopes
+
+	// imports from managed accounts reference them by name,
+	// so that they follow a new public key of the exporter
+	accounts, err := listAccountPublicKeys(ctx, storage, params.Operator)
+	if err != nil {
+		return nil, err
+	}
+	for i, imp := range claims.Imports {
+		if name, ok := accounts[imp.Account]; ok {
+			claims.Imports[i].Account = name
+		}
+	}
+	clearSignedClaimsData(&claims.ClaimsData)
+
+	issue.UseSigningKey = useSigningKey
+	issue.Claims = *claims
+	err = storeInStorage(ctx, storage, getAccountIssuePath(issue.Operator, issue.Account), issue)
+	if err != nil {
+		return nil, err
+	}
+	err = refreshAccount(ctx, storage, issue)
+	if err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+func adoptUserIssue(ctx context.Context, storage logical.Storage, params AdoptIssueParameters) (*IssueUserStorage, error) {
+	log.Info().
+		Str("operator", params.Operator).Str("account", params.Account).Str("user", params.User).
+		Msg("adopt user")
+
+	stored, err := readUserJWT(ctx, storage, JWTParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+		User:     params.User,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, fmt.Errorf("user jwt does not exist")
+	}
+	natsJwt, err := jwt.DecodeUserClaims(stored.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode user jwt: %s", err)
+	}
+
+	nkey, err := readUserNkey(ctx, storage, NkeyParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+		User:     params.User,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if nkey == nil {
+		return nil, fmt.Errorf("user nkey does not exist")
+	}
+	userKeyPair, err := nkeys.FromSeed(nkey.Seed)
+	if err != nil {
+		return nil, err
+	}
+	userPublicKey, err := userKeyPair.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if natsJwt.Subject != userPublicKey {
+		return nil, fmt.Errorf("user jwt subject %s does not match the user nkey %s", natsJwt.Subject, userPublicKey)
+	}
+
+	// the user is re-signed by the key that signed the jwt
+	accountPublicKey, err := readAccountPublicKey(ctx, storage, params.Operator, params.Account)
+	if err != nil {
+		return nil, err
+	}
+	if accountPublicKey == "" {
+		return nil, fmt.Errorf("account nkey does not exist")
+	}
+	useSigningKey := ""
+	if natsJwt.Issuer != accountPublicKey {
+		if natsJwt.IssuerAccount != accountPublicKey {
+			return nil, fmt.Errorf("user jwt is issued for account %s, not for the account nkey %s", natsJwt.IssuerAccount, accountPublicKey)
+		}
+		accountSigningKeys, err := listSigningPublicKeys(ctx, storage, getAccountSigningNkeyPath(params.Operator, params.Account, ""), nil)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		useSigningKey, ok = accountSigningKeys[natsJwt.Issuer]
+		if !ok {
+			return nil, fmt.Errorf("user jwt is signed by %s, which is neither the account nkey nor one of its signing nkeys", natsJwt.Issuer)
+		}
+	}
+
+	issue, err := readUserIssue(ctx, storage, IssueUserParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+		User:     params.User,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if issue == nil {
+		issue = &IssueUserStorage{
+			Operator: params.Operator,
+			Account:  params.Account,
+			User:     params.User,
+		}
+	}
+
+	claims := userv1.ConvertFrom(natsJwt)
+	// the issuer account is set when the user is signed
+	claims.IssuerAccount = ""
+	clearSignedClaimsData(&claims.ClaimsData)
+
+	issue.UseSigningKey = useSigningKey
+	issue.Claims = *claims
+	err = storeInStorage(ctx, storage, getUserIssuePath(issue.Operator, issue.Account, issue.User), issue)
+	if err != nil {
+		return nil, err
+	}
+	err = refreshUser(ctx, storage, issue)
+	if err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// listSigningPublicKeys returns the names of the signing nkeys stored
+// below the path indexed by their public keys. Retired signing nkeys
+// are indexed with an empty name.
+func listSigningPublicKeys(ctx context.Context, storage logical.Storage, path string, retired []RetiredSigningKey) (map[string]string, error) {
+	names, err := listNkeys(ctx, storage, path)
+	if err != nil {
+		return nil, err
+	}
+	retiredNames := getRetiredSigningKeyNames(retired)
+	publicKeys := map[string]string{}
+	for _, name := range names {
+		nkey, err := readNkey(ctx, storage, path+name)
+		if err != nil {
+			return nil, err
+		}
+		if nkey == nil {
+			continue
+		}
+		keyPair, err := nkeys.FromSeed(nkey.Seed)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := keyPair.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		if containsString(retiredNames, name) {
+			name = ""
+		}
+		publicKeys[publicKey] = name
+	}
+	return publicKeys, nil
+}
+
+// adoptSigningKeys replaces the public keys of stored signing nkeys by their names.
+// Retired signing keys are left out, they are published until they expire.
+func adoptSigningKeys(publicKeys []string, signingKeys map[string]string) []string {
+	var adopted []string
+	for _, publicKey := range publicKeys {
+		name, ok := signingKeys[publicKey]
+		switch {
+		case !ok:
+			adopted = append(adopted, publicKey)
+		case name != "":
+			adopted = append(adopted, name)
+		}
+	}
+	return adopted
+}
+
+// isSigningPublicKey reports whether a signing key of an issue is given as
+// a public key instead of the name of a stored signing nkey
+func isSigningPublicKey(signingKey string, prefix nkeys.PrefixByte) bool {
+	switch prefix {
+	case nkeys.PrefixByteOperator:
+		return nkeys.IsValidPublicOperatorKey(signingKey)
+	case nkeys.PrefixByteAccount:
+		return nkeys.IsValidPublicAccountKey(signingKey)
+	}
+	return false
+}
+
+// clearSignedClaimsData resets the claims data that is set when the JWT is signed
+func clearSignedClaimsData(claims *common.ClaimsData) {
+	claims.Subject = ""
+	claims.Issuer = ""
+	claims.IssuedAt = 0
+	claims.ID = ""
+}
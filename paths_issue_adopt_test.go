@@ -0,0 +1,229 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdoptIssue(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	createPair := func(prefix nkeys.PrefixByte) (nkeys.KeyPair, string, string) {
+		kp, err := nkeys.CreatePair(prefix)
+		assert.NoError(t, err)
+		pub, err := kp.PublicKey()
+		assert.NoError(t, err)
+		seed, err := kp.Seed()
+		assert.NoError(t, err)
+		return kp, pub, string(seed)
+	}
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	adopt := func(path string) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path + "/adopt",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// keys created outside of vault
+	operatorKp, operatorPub, operatorSeed := createPair(nkeys.PrefixByteOperator)
+	operatorSigningKp, operatorSigningPub, operatorSigningSeed := createPair(nkeys.PrefixByteOperator)
+	_, accountPub, accountSeed := createPair(nkeys.PrefixByteAccount)
+	accountSigningKp, accountSigningPub, accountSigningSeed := createPair(nkeys.PrefixByteAccount)
+	externalSigningKp, externalSigningPub, _ := createPair(nkeys.PrefixByteAccount)
+	_, userPub, userSeed := createPair(nkeys.PrefixByteUser)
+
+	operatorClaims := jwt.NewOperatorClaims(operatorPub)
+	operatorClaims.Name = "myop"
+	operatorClaims.SigningKeys.Add(operatorSigningPub)
+	operatorClaims.AccountServerURL = "nats://localhost:4222"
+	operatorClaims.StrictSigningKeyUsage = true
+	operatorJWT, err := operatorClaims.Encode(operatorKp)
+	assert.NoError(t, err)
+
+	accountClaims := jwt.NewAccountClaims(accountPub)
+	accountClaims.Name = "myaccount"
+	accountClaims.Limits.Exports = -1
+	accountClaims.Limits.WildcardExports = true
+	accountClaims.Limits.JetStreamLimits.DiskStorage = 1024
+	accountClaims.Exports.Add(&jwt.Export{
+		Name:    "events",
+		Subject: "events.>",
+		Type:    jwt.Stream,
+	})
+	accountClaims.Mappings = jwt.Mapping{}
+	accountClaims.AddMapping("foo", jwt.WeightedMapping{Subject: "bar", Weight: 100})
+	accountClaims.SigningKeys.Add(accountSigningPub)
+	scope := jwt.NewUserScope()
+	scope.Key = externalSigningPub
+	scope.Role = "restricted"
+	scope.Template.Pub.Allow.Add("restricted.>")
+	accountClaims.SigningKeys.AddScopedSigner(scope)
+	accountJWT, err := accountClaims.Encode(operatorSigningKp)
+	assert.NoError(t, err)
+
+	userClaims := jwt.NewUserClaims(userPub)
+	userClaims.Name = "myuser"
+	userClaims.IssuerAccount = accountPub
+	userClaims.Pub.Allow.Add("foo.>")
+	userClaims.Sub.Deny.Add("bar.>")
+	userClaims.Limits.Subs = 10
+	userClaims.Expires = time.Now().Add(time.Hour).Unix()
+	userJWT, err := userClaims.Encode(accountSigningKp)
+	assert.NoError(t, err)
+
+	// nkeys are written before the jwts, so that the
+	// issues created along with them don't replace the jwts
+	resp := write("nkey/operator/op1", map[string]interface{}{"seed": operatorSeed})
+	assert.False(t, resp.IsError())
+	resp = write("nkey/operator/op1/signing/opsk1", map[string]interface{}{"seed": operatorSigningSeed})
+	assert.False(t, resp.IsError())
+	resp = write("jwt/operator/op1", map[string]interface{}{"jwt": operatorJWT})
+	assert.False(t, resp.IsError())
+
+	t.Run("Test adopt operator", func(t *testing.T) {
+		resp := adopt("issue/operator/op1")
+		assert.False(t, resp.IsError())
+
+		issue, err := readOperatorIssue(context.Background(), reqStorage, IssueOperatorParameters{
+			Operator: "op1",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"opsk1"}, issue.Claims.SigningKeys)
+		assert.Equal(t, "nats://localhost:4222", issue.Claims.AccountServerURL)
+		assert.True(t, issue.Claims.StrictSigningKeyUsage)
+		assert.Equal(t, "myop", issue.Claims.Name)
+		assert.Empty(t, issue.Claims.Subject)
+
+		stored, err := readOperatorJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeOperatorClaims(stored.JWT)
+		assert.NoError(t, err)
+		original, err := jwt.DecodeOperatorClaims(operatorJWT)
+		assert.NoError(t, err)
+		assert.Equal(t, original.Operator, claims.Operator)
+	})
+
+	resp = write("nkey/operator/op1/account/ac1", map[string]interface{}{"seed": accountSeed})
+	assert.False(t, resp.IsError())
+	resp = write("nkey/operator/op1/account/ac1/signing/acsk1", map[string]interface{}{"seed": accountSigningSeed})
+	assert.False(t, resp.IsError())
+	resp = write("jwt/operator/op1/account/ac1", map[string]interface{}{"jwt": accountJWT})
+	assert.False(t, resp.IsError())
+
+	t.Run("Test adopt account", func(t *testing.T) {
+		resp := adopt("issue/operator/op1/account/ac1")
+		assert.False(t, resp.IsError())
+
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "opsk1", issue.UseSigningKey)
+		assert.Equal(t, []string{"acsk1"}, issue.Claims.SigningKeys)
+		assert.Len(t, issue.Claims.ScopedSigningKeys, 1)
+		// the scoped signing key has no stored nkey and is kept as public key
+		assert.Equal(t, externalSigningPub, issue.Claims.ScopedSigningKeys[0].Key)
+		assert.Equal(t, "restricted", issue.Claims.ScopedSigningKeys[0].Role)
+		assert.Len(t, issue.Claims.Exports, 1)
+		assert.Equal(t, "Stream", issue.Claims.Exports[0].Type)
+
+		// the re-signed jwt keeps all claims
+		stored, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(stored.JWT)
+		assert.NoError(t, err)
+		original, err := jwt.DecodeAccountClaims(accountJWT)
+		assert.NoError(t, err)
+		assert.Equal(t, operatorSigningPub, claims.Issuer)
+		assert.Equal(t, original.Account, claims.Account)
+	})
+
+	resp = write("nkey/operator/op1/account/ac1/user/u1", map[string]interface{}{"seed": userSeed})
+	assert.False(t, resp.IsError())
+	resp = write("jwt/operator/op1/account/ac1/user/u1", map[string]interface{}{"jwt": userJWT})
+	assert.False(t, resp.IsError())
+
+	t.Run("Test adopt user", func(t *testing.T) {
+		resp := adopt("issue/operator/op1/account/ac1/user/u1")
+		assert.False(t, resp.IsError())
+
+		issue, err := readUserIssue(context.Background(), reqStorage, IssueUserParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			User:     "u1",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "acsk1", issue.UseSigningKey)
+		assert.Equal(t, []string{"foo.>"}, issue.Claims.Pub.Allow)
+		assert.Equal(t, userClaims.Expires, issue.Claims.Expires)
+		assert.Empty(t, issue.Claims.IssuerAccount)
+
+		stored, err := readUserJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			User:     "u1",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeUserClaims(stored.JWT)
+		assert.NoError(t, err)
+		original, err := jwt.DecodeUserClaims(userJWT)
+		assert.NoError(t, err)
+		assert.Equal(t, accountSigningPub, claims.Issuer)
+		assert.Equal(t, original.User, claims.User)
+		assert.Equal(t, userClaims.Expires, claims.Expires)
+	})
+
+	t.Run("Test users signed by keys without stored nkey are refused", func(t *testing.T) {
+		_, pub, seed := createPair(nkeys.PrefixByteUser)
+		claims := jwt.NewUserClaims(pub)
+		claims.IssuerAccount = accountPub
+		token, err := claims.Encode(externalSigningKp)
+		assert.NoError(t, err)
+
+		resp := write("nkey/operator/op1/account/ac1/user/u2", map[string]interface{}{"seed": seed})
+		assert.False(t, resp.IsError())
+		resp = write("jwt/operator/op1/account/ac1/user/u2", map[string]interface{}{"jwt": token})
+		assert.False(t, resp.IsError())
+
+		resp = adopt("issue/operator/op1/account/ac1/user/u2")
+		assert.True(t, resp.IsError())
+		assert.Contains(t, resp.Error().Error(), "neither the account nkey nor one of its signing nkeys")
+	})
+
+	t.Run("Test jwt of another nkey is refused", func(t *testing.T) {
+		_, _, seed := createPair(nkeys.PrefixByteUser)
+		resp := write("nkey/operator/op1/account/ac1/user/u3", map[string]interface{}{"seed": seed})
+		assert.False(t, resp.IsError())
+		resp = write("jwt/operator/op1/account/ac1/user/u3", map[string]interface{}{"jwt": userJWT})
+		assert.False(t, resp.IsError())
+
+		resp = adopt("issue/operator/op1/account/ac1/user/u3")
+		assert.True(t, resp.IsError())
+		assert.Contains(t, resp.Error().Error(), "does not match the user nkey")
+	})
+}
@@ -14,37 +14,65 @@ import (
 	accountv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/account/v1alpha1"
 	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/common"
 	operatorv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/operator/v1alpha1"
+	userv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
 	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
 )
 
 type IssueOperatorStorage struct {
-	Operator            string                    `json:"operator"`
-	CreateSystemAccount bool                      `json:"createSystemAccount"`
-	SyncAccountServer   bool                      `json:"syncAccountServer"`
-	Claims              operatorv1.OperatorClaims `json:"claims"`
+	Operator               string                    `json:"operator"`
+	CreateSystemAccount    bool                      `json:"createSystemAccount"`
+	SyncAccountServer      bool                      `json:"syncAccountServer"`
+	AccountServerTLS       *resolver.TLSConfig       `json:"accountServerTls,omitempty"`
+	AccountServerReconcile *ReconcileOptions         `json:"accountServerReconcile,omitempty"`
+	AccountServerSync      *AccountServerSyncOptions `json:"accountServerSync,omitempty"`
+	OfflineIdentityKey     string                    `json:"offlineIdentityKey,omitempty"`
+	DefaultSigningKey      string                    `json:"defaultSigningKey,omitempty"`
+	Claims                 operatorv1.OperatorClaims `json:"claims"`
+	RetiredSigningKeys     []RetiredSigningKey       `json:"retiredSigningKeys,omitempty"`
+	AccountServerDrift     *AccountServerDrift       `json:"accountServerDrift,omitempty"`
 }
 
 // IssueOperatorParameters
 // +k8s:deepcopy-gen=true
 type IssueOperatorParameters struct {
-	Operator            string                    `json:"operator"`
-	CreateSystemAccount bool                      `json:"createSystemAccount,omitempty"`
-	SyncAccountServer   bool                      `json:"syncAccountServer,omitempty"`
-	Claims              operatorv1.OperatorClaims `json:"claims,omitempty"`
+	Operator               string                    `json:"operator"`
+	CreateSystemAccount    bool                      `json:"createSystemAccount,omitempty"`
+	SyncAccountServer      bool                      `json:"syncAccountServer,omitempty"`
+	AccountServerTLS       *resolver.TLSConfig       `json:"accountServerTls,omitempty"`
+	AccountServerReconcile *ReconcileOptions         `json:"accountServerReconcile,omitempty"`
+	AccountServerSync      *AccountServerSyncOptions `json:"accountServerSync,omitempty"`
+	// OfflineIdentityKey is the public key of an operator identity key
+	// that is kept outside of Vault
+	OfflineIdentityKey string `json:"offlineIdentityKey,omitempty"`
+	// DefaultSigningKey signs the accounts that don't name a signing key
+	// if the operator requires signing keys
+	DefaultSigningKey string                    `json:"defaultSigningKey,omitempty"`
+	Claims            operatorv1.OperatorClaims `json:"claims,omitempty"`
 }
 
 type IssueOperatorData struct {
-	Operator            string                    `json:"operator"`
-	CreateSystemAccount bool                      `json:"createSystemAccount"`
-	SyncAccountServer   bool                      `json:"syncAccountServer"`
-	Claims              operatorv1.OperatorClaims `json:"claims"`
-	Status              IssueOperatorStatus       `json:"status"`
+	Operator               string                    `json:"operator"`
+	CreateSystemAccount    bool                      `json:"createSystemAccount"`
+	SyncAccountServer      bool                      `json:"syncAccountServer"`
+	AccountServerTLS       *resolver.TLSConfig       `json:"accountServerTls,omitempty"`
+	AccountServerReconcile *ReconcileOptions         `json:"accountServerReconcile,omitempty"`
+	AccountServerSync      *AccountServerSyncOptions `json:"accountServerSync,omitempty"`
+	OfflineIdentityKey     string                    `json:"offlineIdentityKey,omitempty"`
+	DefaultSigningKey      string                    `json:"defaultSigningKey,omitempty"`
+	Claims                 operatorv1.OperatorClaims `json:"claims"`
+	RetiredSigningKeys     []RetiredSigningKey       `json:"retiredSigningKeys,omitempty"`
+	AccountServerDrift     *AccountServerDrift       `json:"accountServerDrift,omitempty"`
+	Status                 IssueOperatorStatus       `json:"status"`
 }
 
 type IssueOperatorStatus struct {
 	Operator          IssueStatus `json:"operator"`
 	SystemAccount     IssueStatus `json:"systemAccount"`
 	SystemAccountUser IssueStatus `json:"systemAccountUser"`
+	// IdentityKeySignedAccounts are the accounts whose JWT is signed with the
+	// operator identity key although the operator requires signing keys
+	IdentityKeySignedAccounts []string `json:"identityKeySignedAccounts,omitempty"`
 }
 
 type IssueStatus struct {
@@ -72,11 +100,48 @@ func pathOperatorIssue(b *NatsBackend) []*framework.Path {
 					Description: "Operator claims (jwt.OperatorClaims from github.com/nats-io/jwt/v2)",
 					Required:    false,
 				},
+				"dryRun": {
+					Type:        framework.TypeBool,
+					Description: "Return the changes of the write without storing or pushing anything",
+					Required:    false,
+					Default:     false,
+				},
+				"cascade": {
+					Type:        framework.TypeBool,
+					Description: "Delete the accounts and users of the operator together with the operator",
+					Required:    false,
+					Default:     false,
+				},
 				"syncAccountServer": {
 					Type:        framework.TypeBool,
 					Description: "Sync account jwt's with account server",
 					Required:    false,
 				},
+				"accountServerTls": {
+					Type:        framework.TypeMap,
+					Description: "TLS settings for the connection to the account server (caCert, clientCert, clientKey, serverName)",
+					Required:    false,
+				},
+				"accountServerSync": {
+					Type:        framework.TypeMap,
+					Description: "Quorum and response timeout for pushing to the account server (quorum, timeout)",
+					Required:    false,
+				},
+				"accountServerReconcile": {
+					Type:        framework.TypeMap,
+					Description: "Periodic reconciliation of the account server (enabled, prune, push)",
+					Required:    false,
+				},
+				"defaultSigningKey": {
+					Type:        framework.TypeString,
+					Description: "Operator signing key that signs accounts without useSigningKey if the operator requires signing keys (strictSigningKeyUsage or offlineIdentityKey)",
+					Required:    false,
+				},
+				"offlineIdentityKey": {
+					Type:        framework.TypeString,
+					Description: "Public key of an operator identity key that is kept outside of Vault. The operator JWT is signed externally and accounts are signed with operator signing keys.",
+					Required:    false,
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.CreateOperation: &framework.PathOperation{
@@ -122,11 +187,22 @@ func (b *NatsBackend) pathAddOperatorIssue(ctx context.Context, req *logical.Req
 	params := IssueOperatorParameters{}
 	json.Unmarshal(jsonString, &params)
 
+	warnings, err := validateOperatorIssue(params)
+	if err != nil {
+		return logical.ErrorResponse(AddingIssueFailedError + ":" + err.Error()), nil
+	}
+
+	if data.Get("dryRun").(bool) {
+		return dryRunIssue(ctx, req.Storage, getOperatorJWTPath(params.Operator), warnings, func(ctx context.Context, storage logical.Storage) error {
+			return addOperatorIssue(ctx, storage, params)
+		})
+	}
+
 	err = addOperatorIssue(ctx, req.Storage, params)
 	if err != nil {
 		return logical.ErrorResponse(AddingIssueFailedError + ":" + err.Error()), nil
 	}
-	return nil, nil
+	return createResponseWarnings(warnings)
 }
 
 func (b *NatsBackend) pathReadOperatorIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -183,7 +259,11 @@ func (b *NatsBackend) pathDeleteOperatorIssue(ctx context.Context, req *logical.
 	json.Unmarshal(jsonString, &params)
 
 	// delete issue and all related nkeys and jwt
-	err = deleteOperatorIssue(ctx, req.Storage, params)
+	if data.Get("cascade").(bool) {
+		err = deleteOperatorIssueCascade(ctx, req.Storage, params)
+	} else {
+		err = deleteOperatorIssue(ctx, req.Storage, params)
+	}
 	if err != nil {
 		return logical.ErrorResponse(DeleteIssueFailedError), nil
 	}
@@ -195,6 +275,25 @@ func addOperatorIssue(ctx context.Context, storage logical.Storage, params Issue
 		Str("operator", params.Operator).
 		Msgf("issue operator")
 
+	// check the tls and sync settings before they are used
+	// to connect to the account server
+	_, err := params.AccountServerTLS.Config()
+	if err != nil {
+		return fmt.Errorf("invalid account server tls settings: %s", err)
+	}
+	_, err = params.AccountServerSync.resolverOptions(params.AccountServerTLS)
+	if err != nil {
+		return fmt.Errorf("invalid account server sync settings: %s", err)
+	}
+	err = checkOperatorIdentityKey(ctx, storage, params)
+	if err != nil {
+		return err
+	}
+	err = checkOperatorSigningKeyUsage(params)
+	if err != nil {
+		return err
+	}
+
 	// store issue
 	issue, err := storeOperatorIssue(ctx, storage, params)
 	if err != nil {
@@ -215,6 +314,11 @@ func refreshAccountResolvers(ctx context.Context, storage logical.Storage, issue
 		return nil
 	}
 
+	// http account servers don't need the push user
+	if resolver.IsHTTPURL(issue.Claims.AccountServerURL) {
+		return refreshAllAccountResolvers(ctx, storage, issue)
+	}
+
 	pushUser, err := readUserIssue(ctx, storage, IssueUserParameters{
 		Operator: issue.Operator,
 		Account:  DefaultSysAccountName,
@@ -225,19 +329,7 @@ func refreshAccountResolvers(ctx context.Context, storage logical.Storage, issue
 	}
 	if pushUser != nil {
 		if pushUser.Status.User.JWT {
-			accounts, err := listAccountIssues(ctx, storage, issue.Operator)
-			if err != nil {
-				return err
-			}
-			for _, account := range accounts {
-				err = refreshAccountResolverPush(ctx, storage, &IssueAccountStorage{
-					Operator: issue.Operator,
-					Account:  account,
-				})
-				if err != nil {
-					return err
-				}
-			}
+			return refreshAllAccountResolvers(ctx, storage, issue)
 		} else {
 			// todo warning push user does not exist
 			log.Warn().Str("operator", issue.Operator).Msg("cannot refresh account resolvers, push user has no JWT yet")
@@ -250,6 +342,24 @@ func refreshAccountResolvers(ctx context.Context, storage logical.Storage, issue
 	return nil
 }
 
+// refreshAllAccountResolvers pushes all accounts of the operator to the account server
+func refreshAllAccountResolvers(ctx context.Context, storage logical.Storage, issue *IssueOperatorStorage) error {
+	accounts, err := listAccountIssues(ctx, storage, issue.Operator)
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		err = refreshAccountResolverPush(ctx, storage, &IssueAccountStorage{
+			Operator: issue.Operator,
+			Account:  account,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func refreshOperator(ctx context.Context, storage logical.Storage, issue *IssueOperatorStorage) error {
 
 	// create nkey and signing nkeys
@@ -316,6 +426,17 @@ func deleteOperatorIssue(ctx context.Context, storage logical.Storage, params Is
 		}
 	}
 
+	// delete retired operator signing nkeys
+	for _, retired := range issue.RetiredSigningKeys {
+		err := deleteOperatorSigningNkey(ctx, storage, NkeyParameters{
+			Operator: issue.Operator,
+			Signing:  retired.Name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	// if generated, delete system account
 	if issue.CreateSystemAccount {
 		err := deleteUserIssue(ctx, storage, IssueUserParameters{
@@ -350,6 +471,53 @@ func deleteOperatorIssue(ctx context.Context, storage logical.Storage, params Is
 	return deleteFromStorage(ctx, storage, path)
 }
 
+// deleteOperatorIssueCascade deletes the operator issue with all accounts
+// of the operator and their users. The system account is deleted last
+// because the account server is updated through it.
+func deleteOperatorIssueCascade(ctx context.Context, storage logical.Storage, params IssueOperatorParameters) error {
+	log.Info().
+		Str("operator", params.Operator).
+		Msgf("delete operator with all accounts")
+
+	issue, err := readOperatorIssue(ctx, storage, params)
+	if err != nil {
+		return err
+	}
+	if issue == nil {
+		// nothing to delete
+		return nil
+	}
+
+	accounts, err := listAccountIssues(ctx, storage, issue.Operator)
+	if err != nil {
+		return err
+	}
+	sysAccount := false
+	for _, account := range accounts {
+		if account == DefaultSysAccountName {
+			sysAccount = true
+			continue
+		}
+		err := deleteAccountIssueCascade(ctx, storage, IssueAccountParameters{
+			Operator: issue.Operator,
+			Account:  account,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if sysAccount {
+		err := deleteAccountIssueCascade(ctx, storage, IssueAccountParameters{
+			Operator: issue.Operator,
+			Account:  DefaultSysAccountName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return deleteOperatorIssue(ctx, storage, params)
+}
+
 func storeOperatorIssue(ctx context.Context, storage logical.Storage, params IssueOperatorParameters) (*IssueOperatorStorage, error) {
 	path := getOperatorIssuePath(params.Operator)
 
@@ -390,6 +558,11 @@ func storeOperatorIssue(ctx context.Context, storage logical.Storage, params Iss
 	issue.Claims.SigningKeys = params.Claims.SigningKeys
 	issue.Claims.AccountServerURL = params.Claims.AccountServerURL
 	issue.SyncAccountServer = params.SyncAccountServer
+	issue.AccountServerTLS = params.AccountServerTLS
+	issue.AccountServerReconcile = params.AccountServerReconcile
+	issue.AccountServerSync = params.AccountServerSync
+	issue.OfflineIdentityKey = params.OfflineIdentityKey
+	issue.DefaultSigningKey = params.DefaultSigningKey
 	err = storeInStorage(ctx, storage, path, issue)
 	if err != nil {
 		return nil, err
@@ -400,24 +573,29 @@ func storeOperatorIssue(ctx context.Context, storage logical.Storage, params Iss
 func issueOperatorNkeys(ctx context.Context, storage logical.Storage, issue IssueOperatorStorage) error {
 	var refreshAccounts bool
 
-	// issue operator nkey
-	p := NkeyParameters{
-		Operator: issue.Operator,
-	}
-	stored, err := readOperatorNkey(ctx, storage, p)
-	if err != nil {
-		return err
-	}
-	if stored == nil {
-		err := addOperatorNkey(ctx, storage, p)
+	// issue operator nkey, unless the identity key is kept offline
+	if issue.OfflineIdentityKey == "" {
+		p := NkeyParameters{
+			Operator: issue.Operator,
+		}
+		stored, err := readOperatorNkey(ctx, storage, p)
 		if err != nil {
 			return err
 		}
-		refreshAccounts = true
+		if stored == nil {
+			err := addOperatorNkey(ctx, storage, p)
+			if err != nil {
+				return err
+			}
+			refreshAccounts = true
+		}
 	}
 
 	// issue operator siginig nkeys
 	for _, signingKey := range issue.Claims.SigningKeys {
+		if isSigningPublicKey(signingKey, nkeys.PrefixByteOperator) {
+			continue
+		}
 		p := NkeyParameters{
 			Operator: issue.Operator,
 			Signing:  signingKey,
@@ -439,7 +617,7 @@ func issueOperatorNkeys(ctx context.Context, storage logical.Storage, issue Issu
 		// force update of all existing accounts
 		// so they can use the new operator nkey to sign their jwt
 		log.Info().Str("operator", issue.Operator).Msg("managed nkeys modified, all accounts will be updated")
-		err = updateAccountIssues(ctx, storage, issue)
+		err := updateAccountIssues(ctx, storage, issue)
 		if err != nil {
 			log.Err(err).Str("operator", issue.Operator).Msg("failed to update accounts")
 			return err
@@ -453,7 +631,25 @@ func issueOperatorNkeys(ctx context.Context, storage logical.Storage, issue Issu
 }
 
 func issueOperatorJWT(ctx context.Context, storage logical.Storage, issue IssueOperatorStorage) error {
-	// receive operator nkey and puplic key
+	claims, err := createOperatorClaims(ctx, storage, issue)
+	if err != nil {
+		return err
+	}
+
+	// an offline identity key signs the claims outside of Vault
+	if issue.OfflineIdentityKey != "" {
+		upToDate, err := isOfflineOperatorJWTUpToDate(ctx, storage, issue.Operator, claims)
+		if err != nil {
+			return err
+		}
+		if !upToDate {
+			log.Warn().
+				Str("operator", issue.Operator).
+				Msg("operator jwt has to be signed with the offline identity key")
+		}
+		return nil
+	}
+
 	data, err := readOperatorNkey(ctx, storage, NkeyParameters{
 		Operator: issue.Operator,
 	})
@@ -464,45 +660,63 @@ func issueOperatorJWT(ctx context.Context, storage logical.Storage, issue IssueO
 	if err != nil {
 		return err
 	}
-	operatorPublicKey, err := operatorKeyPair.PublicKey()
+	token, err := claims.Encode(operatorKeyPair)
 	if err != nil {
-		return err
+		return fmt.Errorf("could not encode operator jwt: %s", err)
 	}
 
-	// receive public key of system account
-	sysAccountPublicKey := ""
-	data, err = readAccountNkey(ctx, storage, NkeyParameters{
+	// store operator jwt
+	err = addOperatorJWT(ctx, storage, JWTParameters{
 		Operator: issue.Operator,
-		Account:  DefaultSysAccountName,
+		JWTStorage: JWTStorage{
+			JWT: token,
+		},
 	})
 	if err != nil {
-		return fmt.Errorf("could not read system account nkey: %s", err)
+		return err
 	}
-	if data != nil {
-		// log.Warn().
-		// 	Str("operator", issue.Operator).
-		// 	Msgf("system account nkey does not exist: %s - Cannot create jwt.", DefaultSysAccountName)
-		// return nil
-		// } else {
-		sysAccountKeyPair, err := nkeys.FromSeed(data.Seed)
-		if err != nil {
-			return fmt.Errorf("could not convert system account nkey to kp: %s", err)
-		}
-		sysAccountPublicKey, err = sysAccountKeyPair.PublicKey()
-		if err != nil {
-			return fmt.Errorf("could not extract pulic key from system account nkey: %s", err)
-		}
+
+	log.Info().
+		Str("operator", issue.Operator).
+		Msgf("jwt created/updated")
+	return nil
+}
+
+// createOperatorClaims returns the claims of the operator jwt
+// with the public keys of the identity key, the signing keys
+// and the system account filled in
+func createOperatorClaims(ctx context.Context, storage logical.Storage, issue IssueOperatorStorage) (*jwt.OperatorClaims, error) {
+	// receive operator puplic key
+	operatorPublicKey, err := readOperatorPublicKey(ctx, storage, issue.Operator)
+	if err != nil {
+		return nil, fmt.Errorf("could not read operator nkey: %s", err)
+	}
+	if operatorPublicKey == "" {
+		return nil, fmt.Errorf("operator nkey does not exist")
+	}
+
+	// receive public key of system account
+	sysAccountPublicKey, err := readAccountPublicKey(ctx, storage, issue.Operator, DefaultSysAccountName)
+	if err != nil {
+		return nil, fmt.Errorf("could not read system account nkey: %s", err)
 	}
 
-	// receive public keys of signing keys
+	// receive public keys of signing keys,
+	// retired ones are published until their overlap window closes
+	signingKeys := append([]string{}, issue.Claims.SigningKeys...)
+	signingKeys = append(signingKeys, getRetiredSigningKeyNames(issue.RetiredSigningKeys)...)
 	var signingPublicKeys []string
-	for _, signingKey := range issue.Claims.SigningKeys {
+	for _, signingKey := range signingKeys {
+		if isSigningPublicKey(signingKey, nkeys.PrefixByteOperator) {
+			signingPublicKeys = append(signingPublicKeys, signingKey)
+			continue
+		}
 		data, err := readOperatorSigningNkey(ctx, storage, NkeyParameters{
 			Operator: issue.Operator,
 			Signing:  signingKey,
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if data == nil {
 			log.Warn().
@@ -512,12 +726,12 @@ func issueOperatorJWT(ctx context.Context, storage logical.Storage, issue IssueO
 		}
 		signingKeyPair, err := nkeys.FromSeed(data.Seed)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		signingKey, err := signingKeyPair.PublicKey()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		signingPublicKeys = append(signingPublicKeys, signingKey)
 	}
@@ -526,37 +740,34 @@ func issueOperatorJWT(ctx context.Context, storage logical.Storage, issue IssueO
 	issue.Claims.ClaimsData.Issuer = operatorPublicKey
 	issue.Claims.Operator.SystemAccount = sysAccountPublicKey
 	issue.Claims.Operator.SigningKeys = signingPublicKeys
-	natsJwt := operatorv1.Convert(&issue.Claims)
-	token, err := natsJwt.Encode(operatorKeyPair)
-	if err != nil {
-		return fmt.Errorf("could not encode operator jwt: %s", err)
-	}
-
-	// store operator jwt
-	err = addOperatorJWT(ctx, storage, JWTParameters{
-		Operator: issue.Operator,
-		JWTStorage: JWTStorage{
-			JWT: token,
-		},
-	})
-	if err != nil {
-		return err
-	}
-
-	log.Info().
-		Str("operator", issue.Operator).
-		Msgf("jwt created/updated")
-	return nil
+	return operatorv1.Convert(&issue.Claims), nil
 }
 
 func issueSystemAccount(ctx context.Context, storage logical.Storage, issue IssueOperatorStorage) error {
 	// create system account jwt and nkey
-	err := addAccountIssue(ctx, storage, IssueAccountParameters{
-		Operator: issue.Operator,
-		Account:  DefaultSysAccountName,
+	// the system account is signed with an operator signing key
+	// if the operator requires it
+	useSigningKey, err := getDefaultOperatorSigningKey(issue)
+	if err != nil {
+		return err
+	}
+	// and signs its users with an account signing key
+	// if the operator enforces strict usage
+	var signingKeys []string
+	var defaultSigningKey string
+	if accountRequiresSigningKey(&issue) {
+		signingKeys = []string{DefaultSysAccountSigningKey}
+		defaultSigningKey = DefaultSysAccountSigningKey
+	}
+	err = addAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator:          issue.Operator,
+		Account:           DefaultSysAccountName,
+		UseSigningKey:     useSigningKey,
+		DefaultSigningKey: defaultSigningKey,
 		Claims: accountv1.AccountClaims{
 			Account: accountv1.Account{
-				Imports: []accountv1.Import{},
+				SigningKeys: signingKeys,
+				Imports:     []accountv1.Import{},
 				Exports: []accountv1.Export{
 					{
 						Name:                 "account-monitoring-services",
@@ -612,10 +823,24 @@ func issueSystemAccount(ctx context.Context, storage logical.Storage, issue Issu
 	}
 
 	// create system account user jwt and nkey
+	// the push user subscribes to the responses of the nats-servers
 	err = addUserIssue(ctx, storage, IssueUserParameters{
 		Operator: issue.Operator,
 		Account:  DefaultSysAccountName,
 		User:     DefaultPushUser,
+		Claims: userv1.UserClaims{
+			User: userv1.User{
+				UserPermissionLimits: userv1.UserPermissionLimits{
+					Limits: userv1.Limits{
+						NatsLimits: common.NatsLimits{
+							Subs:    -1,
+							Data:    -1,
+							Payload: -1,
+						},
+					},
+				},
+			},
+		},
 	})
 	if err != nil {
 		return err
@@ -625,6 +850,9 @@ func issueSystemAccount(ctx context.Context, storage logical.Storage, issue Issu
 }
 
 func updateAccountIssues(ctx context.Context, storage logical.Storage, issue IssueOperatorStorage) error {
+	// all accounts are re-issued, importers don't need to be updated again
+	ctx = withRefreshedAccounts(ctx)
+
 	accounts, err := listAccountIssues(ctx, storage, issue.Operator)
 	if err != nil {
 		return err
@@ -641,6 +869,14 @@ func updateAccountIssues(ctx context.Context, storage logical.Storage, issue Iss
 		if acc == nil {
 			return err
 		}
+		// accounts that can't be signed anymore are left as they are
+		// and show up in the status of the operator
+		_, err = resolveAccountSigningKey(ctx, storage, acc.Operator, acc.UseSigningKey)
+		if err != nil {
+			log.Warn().Str("operator", issue.Operator).Str("account", account).Err(err).
+				Msg("account is not updated")
+			continue
+		}
 		err = refreshAccount(ctx, storage, acc)
 		if err != nil {
 			return err
@@ -704,16 +940,28 @@ func getIssueOperatorStatus(ctx context.Context, storage logical.Storage, issue
 	if err == nil && jwt != nil {
 		status.SystemAccountUser.JWT = true
 	}
+
+	accounts, err := listIdentityKeySignedAccounts(ctx, storage, issue)
+	if err == nil {
+		status.IdentityKeySignedAccounts = accounts
+	}
 	return &status
 }
 
 func createResponseIssueOperatorData(issue *IssueOperatorStorage, status *IssueOperatorStatus) (*logical.Response, error) {
 	data := &IssueOperatorData{
-		Operator:            issue.Operator,
-		CreateSystemAccount: issue.CreateSystemAccount,
-		SyncAccountServer:   issue.SyncAccountServer,
-		Claims:              issue.Claims,
-		Status:              *status,
+		Operator:               issue.Operator,
+		CreateSystemAccount:    issue.CreateSystemAccount,
+		SyncAccountServer:      issue.SyncAccountServer,
+		Claims:                 issue.Claims,
+		RetiredSigningKeys:     issue.RetiredSigningKeys,
+		AccountServerTLS:       redactTLSConfig(issue.AccountServerTLS),
+		AccountServerReconcile: issue.AccountServerReconcile,
+		AccountServerSync:      issue.AccountServerSync,
+		AccountServerDrift:     issue.AccountServerDrift,
+		OfflineIdentityKey:     issue.OfflineIdentityKey,
+		DefaultSigningKey:      issue.DefaultSigningKey,
+		Status:                 *status,
 	}
 
 	rval := map[string]interface{}{}
@@ -727,3 +975,14 @@ func createResponseIssueOperatorData(issue *IssueOperatorStorage, status *IssueO
 	}
 	return resp, nil
 }
+
+// redactTLSConfig removes the client key so that
+// it is never returned by a read
+func redactTLSConfig(config *resolver.TLSConfig) *resolver.TLSConfig {
+	if config == nil {
+		return nil
+	}
+	redacted := *config
+	redacted.ClientKey = ""
+	return &redacted
+}
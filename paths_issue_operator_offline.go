@@ -0,0 +1,310 @@
+package natsbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// An operator whose identity key is kept offline only has the public
+// identity key in Vault. The operator claims are signed outside of Vault
+// and the signed JWT is written back. Accounts are signed with the
+// operator signing nkeys, which stay in Vault.
+
+// OfflineOperatorParameters is the user facing interface for writing
+// an operator JWT signed with the offline identity key.
+// Using pascal case on purpose.
+type OfflineOperatorParameters struct {
+	Operator string `json:"operator"`
+	JWT      string `json:"jwt"`
+}
+
+// OfflineOperatorData represents the the data returned by reading the
+// claims to be signed with the offline identity key
+type OfflineOperatorData struct {
+	Operator  string `json:"operator"`
+	PublicKey string `json:"publicKey"`
+	// Claims are the JSON encoded operator claims to be signed
+	Claims string `json:"claims"`
+	// UpToDate reports if the stored operator JWT matches the claims
+	UpToDate bool `json:"upToDate"`
+}
+
+func pathOfflineOperator(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/offline$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"jwt": {
+					Type:        framework.TypeString,
+					Description: "Operator JWT signed with the offline identity key",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReadOfflineOperator,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathAcceptOfflineOperatorJWT,
+				},
+			},
+			HelpSynopsis:    `Signs the operator JWT with an offline identity key.`,
+			HelpDescription: `Reading returns the unsigned operator claims of an operator with an offline identity key. Writing stores the operator JWT after the claims have been signed outside of Vault.`,
+		},
+	}
+}
+
+func (b *NatsBackend) pathReadOfflineOperator(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params OfflineOperatorParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	issue, err := readOperatorIssue(ctx, req.Storage, IssueOperatorParameters{Operator: params.Operator})
+	if err != nil {
+		return logical.ErrorResponse(ReadingIssueFailedError), nil
+	}
+	if issue == nil {
+		return logical.ErrorResponse(IssueNotFoundError), nil
+	}
+	if issue.OfflineIdentityKey == "" {
+		return logical.ErrorResponse(fmt.Sprintf("%s: operator identity key is not offline", ReadingOperatorClaimsFailedError)), nil
+	}
+
+	claims, err := createOperatorClaims(ctx, req.Storage, *issue)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", ReadingOperatorClaimsFailedError, err)), nil
+	}
+	upToDate, err := isOfflineOperatorJWTUpToDate(ctx, req.Storage, issue.Operator, claims)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", ReadingOperatorClaimsFailedError, err)), nil
+	}
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	rval := map[string]interface{}{}
+	err = stm.StructToMap(&OfflineOperatorData{
+		Operator:  issue.Operator,
+		PublicKey: issue.OfflineIdentityKey,
+		Claims:    string(encoded),
+		UpToDate:  upToDate,
+	}, &rval)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: rval,
+	}, nil
+}
+
+func (b *NatsBackend) pathAcceptOfflineOperatorJWT(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params OfflineOperatorParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	err = acceptOfflineOperatorJWT(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AcceptingOperatorJWTFailedError, err)), nil
+	}
+	return nil, nil
+}
+
+// acceptOfflineOperatorJWT stores an operator JWT that has been signed with
+// the offline identity key. The JWT has to publish the current signing keys
+// and system account, otherwise the accounts signed by Vault would be refused.
+func acceptOfflineOperatorJWT(ctx context.Context, storage logical.Storage, params OfflineOperatorParameters) error {
+	issue, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{Operator: params.Operator})
+	if err != nil {
+		return err
+	}
+	if issue == nil {
+		return fmt.Errorf("operator issue does not exist")
+	}
+	if issue.OfflineIdentityKey == "" {
+		return fmt.Errorf("operator identity key is not offline")
+	}
+
+	signed, err := jwt.DecodeOperatorClaims(params.JWT)
+	if err != nil {
+		return fmt.Errorf("could not decode operator jwt: %s", err)
+	}
+	if signed.Issuer != issue.OfflineIdentityKey {
+		return fmt.Errorf("operator jwt is signed by %s instead of the offline identity key %s", signed.Issuer, issue.OfflineIdentityKey)
+	}
+	vr := jwt.CreateValidationResults()
+	signed.Validate(vr)
+	_, err = validationResults(vr)
+	if err != nil {
+		return err
+	}
+
+	claims, err := createOperatorClaims(ctx, storage, *issue)
+	if err != nil {
+		return err
+	}
+	err = checkOfflineOperatorClaims(claims, signed)
+	if err != nil {
+		return err
+	}
+
+	err = addOperatorJWT(ctx, storage, JWTParameters{
+		Operator: issue.Operator,
+		JWTStorage: JWTStorage{
+			JWT: params.JWT,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("operator", issue.Operator).
+		Msg("jwt signed with offline identity key stored")
+	return nil
+}
+
+// isOfflineOperatorJWTUpToDate checks if the stored operator jwt
+// publishes the keys of the claims
+func isOfflineOperatorJWTUpToDate(ctx context.Context, storage logical.Storage, operator string, claims *jwt.OperatorClaims) (bool, error) {
+	stored, err := readOperatorJWT(ctx, storage, JWTParameters{Operator: operator})
+	if err != nil || stored == nil {
+		return false, err
+	}
+	signed, err := jwt.DecodeOperatorClaims(stored.JWT)
+	if err != nil {
+		return false, err
+	}
+	return checkOfflineOperatorClaims(claims, signed) == nil, nil
+}
+
+// checkOfflineOperatorClaims checks that a signed operator jwt publishes
+// the identity key, the signing keys and the system account of the claims
+func checkOfflineOperatorClaims(claims *jwt.OperatorClaims, signed *jwt.OperatorClaims) error {
+	if signed.Subject != claims.Subject {
+		return fmt.Errorf("operator jwt subject %s does not match the offline identity key %s", signed.Subject, claims.Subject)
+	}
+	if signed.SystemAccount != claims.SystemAccount {
+		return fmt.Errorf("system account %s of the operator jwt does not match %s", signed.SystemAccount, claims.SystemAccount)
+	}
+	for _, signingKey := range claims.SigningKeys {
+		if !signed.SigningKeys.Contains(signingKey) {
+			return fmt.Errorf("operator jwt does not publish the signing key %s", signingKey)
+		}
+	}
+	if signed.StrictSigningKeyUsage != claims.StrictSigningKeyUsage {
+		return fmt.Errorf("strict signing key usage of the operator jwt does not match the issue")
+	}
+	return nil
+}
+
+// checkOperatorIdentityKey checks if the identity key of an operator
+// can be taken offline or brought back online by writing the issue
+func checkOperatorIdentityKey(ctx context.Context, storage logical.Storage, params IssueOperatorParameters) error {
+	stored, err := readOperatorIssue(ctx, storage, params)
+	if err != nil {
+		return err
+	}
+	publicKey, err := readNkeyPublicKey(ctx, storage, getOperatorNkeyPath(params.Operator))
+	if err != nil {
+		return err
+	}
+
+	if params.OfflineIdentityKey == "" {
+		// a new identity key must not be created for an offline operator
+		if stored != nil && stored.OfflineIdentityKey != "" && publicKey != stored.OfflineIdentityKey {
+			return fmt.Errorf("operator identity key is offline: write its seed to nkey/operator/%s to bring it online", params.Operator)
+		}
+		return nil
+	}
+
+	if !nkeys.IsValidPublicOperatorKey(params.OfflineIdentityKey) {
+		return fmt.Errorf("not an operator public key: %s", params.OfflineIdentityKey)
+	}
+	if publicKey != "" {
+		return fmt.Errorf("operator nkey is stored: delete nkey/operator/%s to take the identity key offline", params.Operator)
+	}
+	token, err := readOperatorJWT(ctx, storage, JWTParameters{Operator: params.Operator})
+	if err != nil {
+		return err
+	}
+	if token != nil {
+		claims, err := jwt.DecodeOperatorClaims(token.JWT)
+		if err != nil {
+			return fmt.Errorf("could not decode operator jwt: %s", err)
+		}
+		if claims.Subject != params.OfflineIdentityKey {
+			return fmt.Errorf("offline identity key does not match the operator jwt subject %s", claims.Subject)
+		}
+	}
+
+	return nil
+}
+
+// readOperatorPublicKey returns the public key of the operator identity key,
+// either of the stored nkey or of the offline identity key.
+// An empty string is returned if neither exists.
+func readOperatorPublicKey(ctx context.Context, storage logical.Storage, operator string) (string, error) {
+	issue, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{Operator: operator})
+	if err != nil {
+		return "", err
+	}
+	if issue != nil && issue.OfflineIdentityKey != "" {
+		return issue.OfflineIdentityKey, nil
+	}
+	return readNkeyPublicKey(ctx, storage, getOperatorNkeyPath(operator))
+}
+
+// readOperatorOnlineKeyPair returns the key pair that signs requests to the
+// account server on behalf of the operator. That is the operator nkey or, if
+// the operator requires signing keys, the default operator signing nkey.
+// A nil key pair is returned if the nkey does not exist.
+func readOperatorOnlineKeyPair(ctx context.Context, storage logical.Storage, operator string) (nkeys.KeyPair, error) {
+	issue, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{Operator: operator})
+	if err != nil {
+		return nil, err
+	}
+	if issue == nil || !operatorRequiresSigningKey(issue) {
+		return readOperatorKeyPair(ctx, storage, operator)
+	}
+	signingKey, err := getDefaultOperatorSigningKey(*issue)
+	if err != nil {
+		return nil, err
+	}
+	nkey, err := readOperatorSigningNkey(ctx, storage, NkeyParameters{
+		Operator: operator,
+		Signing:  signingKey,
+	})
+	if err != nil || nkey == nil {
+		return nil, err
+	}
+	return nkeys.FromSeed(nkey.Seed)
+}
@@ -0,0 +1,177 @@
+package natsbackend
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOfflineOperator(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	readClaims := func() (*jwt.OperatorClaims, bool) {
+		resp := request(logical.ReadOperation, "issue/operator/op1/offline", nil)
+		assert.False(t, resp.IsError())
+		claims := &jwt.OperatorClaims{}
+		assert.NoError(t, json.Unmarshal([]byte(resp.Data["claims"].(string)), claims))
+		return claims, resp.Data["upToDate"].(bool)
+	}
+
+	identityKp, err := nkeys.CreateOperator()
+	assert.NoError(t, err)
+	identityPub, err := identityKp.PublicKey()
+	assert.NoError(t, err)
+
+	t.Run("Test offline operator requires a signing key", func(t *testing.T) {
+		resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+			"offlineIdentityKey": identityPub,
+		})
+		assert.True(t, resp.IsError())
+
+		resp = request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+			"offlineIdentityKey": "not-a-key",
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"signingKeys": []interface{}{"opsk1"},
+				},
+			},
+		})
+		assert.True(t, resp.IsError())
+	})
+
+	t.Run("Test offline operator keeps only the public key", func(t *testing.T) {
+		resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+			"offlineIdentityKey":  identityPub,
+			"createSystemAccount": true,
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"signingKeys": []interface{}{"opsk1"},
+				},
+			},
+		})
+		assert.False(t, resp.IsError())
+
+		nkey, err := readOperatorNkey(context.Background(), reqStorage, NkeyParameters{Operator: "op1"})
+		assert.NoError(t, err)
+		assert.Nil(t, nkey)
+		token, err := readOperatorJWT(context.Background(), reqStorage, JWTParameters{Operator: "op1"})
+		assert.NoError(t, err)
+		assert.Nil(t, token)
+
+		// the system account is signed with the signing key
+		sys, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{Operator: "op1", Account: DefaultSysAccountName})
+		assert.NoError(t, err)
+		assert.Equal(t, "opsk1", sys.UseSigningKey)
+		signingPub, err := readNkeyPublicKey(context.Background(), reqStorage, getOperatorSigningNkeyPath("op1", "opsk1"))
+		assert.NoError(t, err)
+		sysJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{Operator: "op1", Account: DefaultSysAccountName})
+		assert.NoError(t, err)
+		sysClaims, err := jwt.DecodeAccountClaims(sysJWT.JWT)
+		assert.NoError(t, err)
+		assert.Equal(t, signingPub, sysClaims.Issuer)
+	})
+
+	t.Run("Test accounts are signed with a signing key", func(t *testing.T) {
+		resp := request(logical.CreateOperation, "issue/operator/op1/account/ac1", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+
+		signingPub, err := readNkeyPublicKey(context.Background(), reqStorage, getOperatorSigningNkeyPath("op1", "opsk1"))
+		assert.NoError(t, err)
+		token, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{Operator: "op1", Account: "ac1"})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(token.JWT)
+		assert.NoError(t, err)
+		assert.Equal(t, signingPub, claims.Issuer)
+	})
+
+	t.Run("Test sign operator claims offline", func(t *testing.T) {
+		claims, upToDate := readClaims()
+		assert.False(t, upToDate)
+		assert.Equal(t, identityPub, claims.Subject)
+		assert.Len(t, claims.SigningKeys, 1)
+		assert.NotEmpty(t, claims.SystemAccount)
+
+		// jwts of other keys are refused
+		otherKp, err := nkeys.CreateOperator()
+		assert.NoError(t, err)
+		other, err := claims.Encode(otherKp)
+		assert.NoError(t, err)
+		resp := request(logical.UpdateOperation, "issue/operator/op1/offline", map[string]interface{}{"jwt": other})
+		assert.True(t, resp.IsError())
+
+		// jwts missing the signing keys are refused
+		outdated := *claims
+		outdated.SigningKeys = jwt.StringList{}
+		token, err := outdated.Encode(identityKp)
+		assert.NoError(t, err)
+		resp = request(logical.UpdateOperation, "issue/operator/op1/offline", map[string]interface{}{"jwt": token})
+		assert.True(t, resp.IsError())
+
+		token, err = claims.Encode(identityKp)
+		assert.NoError(t, err)
+		resp = request(logical.UpdateOperation, "issue/operator/op1/offline", map[string]interface{}{"jwt": token})
+		assert.False(t, resp.IsError())
+
+		stored, err := readOperatorJWT(context.Background(), reqStorage, JWTParameters{Operator: "op1"})
+		assert.NoError(t, err)
+		assert.Equal(t, token, stored.JWT)
+		_, upToDate = readClaims()
+		assert.True(t, upToDate)
+
+		// a new signing key requires a new signature
+		resp = request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+			"offlineIdentityKey":  identityPub,
+			"createSystemAccount": true,
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"signingKeys": []interface{}{"opsk1", "opsk2"},
+				},
+			},
+		})
+		assert.False(t, resp.IsError())
+		claims, upToDate = readClaims()
+		assert.False(t, upToDate)
+		assert.Len(t, claims.SigningKeys, 2)
+	})
+
+	t.Run("Test offline identity key is not replaced", func(t *testing.T) {
+		// going online needs the seed of the offline identity key
+		resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+			"createSystemAccount": true,
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"signingKeys": []interface{}{"opsk1"},
+				},
+			},
+		})
+		assert.True(t, resp.IsError())
+
+		// a stored identity seed has to be deleted to go offline
+		resp = request(logical.CreateOperation, "issue/operator/op2", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+		resp = request(logical.CreateOperation, "issue/operator/op2", map[string]interface{}{
+			"offlineIdentityKey": identityPub,
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"signingKeys": []interface{}{"opsk1"},
+				},
+			},
+		})
+		assert.True(t, resp.IsError())
+	})
+}
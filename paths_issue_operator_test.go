@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	v1alpha1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/operator/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
 	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/nats-io/jwt/v2"
@@ -561,3 +563,196 @@ func TestCRUDOperatorIssue(t *testing.T) {
 		assert.True(t, resp.IsError())
 	})
 }
+
+func TestOperatorIssueAccountServerTLS(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// invalid tls settings are refused
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"accountServerTls": map[string]interface{}{
+				"clientCert": "invalid",
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"syncAccountServer": true,
+			"accountServerTls": map[string]interface{}{
+				"serverName": "nats.example.com",
+			},
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"accountServerUrl": "tls://localhost:4222",
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+	var current IssueOperatorData
+	stm.MapToStruct(resp.Data, &current)
+	assert.Equal(t, &resolver.TLSConfig{ServerName: "nats.example.com"}, current.AccountServerTLS)
+
+	// the client key is never returned
+	redacted := redactTLSConfig(&resolver.TLSConfig{
+		ClientCert: "cert",
+		ClientKey:  "key",
+	})
+	assert.Equal(t, &resolver.TLSConfig{ClientCert: "cert"}, redacted)
+	assert.Nil(t, redactTLSConfig(nil))
+}
+
+func TestOperatorIssueAccountServerSync(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// invalid timeouts are refused
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"accountServerSync": map[string]interface{}{
+				"timeout": "invalid",
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"accountServerSync": map[string]interface{}{
+				"quorum":  3,
+				"timeout": "2s",
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	issue, err := readOperatorIssue(context.Background(), reqStorage, IssueOperatorParameters{
+		Operator: "op1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &AccountServerSyncOptions{Quorum: 3, Timeout: "2s"}, issue.AccountServerSync)
+	opts, err := issue.AccountServerSync.resolverOptions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, opts.Timeout)
+
+	// the sync is only successful if the quorum is met
+	result := &resolver.Result{
+		Acknowledged: []resolver.ServerResult{{Server: "n1"}, {Server: "n2"}},
+		Failed:       []resolver.ServerResult{{Server: "n3", Error: "failed"}},
+	}
+	assert.Error(t, issue.AccountServerSync.checkQuorum(result, nil))
+	issue.AccountServerSync.Quorum = 2
+	assert.NoError(t, issue.AccountServerSync.checkQuorum(result, nil))
+	assert.Error(t, issue.AccountServerSync.checkQuorum(result, fmt.Errorf("no response from server")))
+
+	// without options a single acknowledgement is sufficient
+	var defaults *AccountServerSyncOptions
+	assert.Equal(t, 1, defaults.quorum())
+	opts, err = defaults.resolverOptions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), opts.Timeout)
+}
+
+func TestOperatorIssueCascadeDelete(t *testing.T) {
+	b, reqStorage, memory := getTestBackendWithResolver(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+		"createSystemAccount": true,
+		"syncAccountServer":   true,
+		"claims": map[string]interface{}{
+			"operator": map[string]interface{}{
+				"accountServerUrl": "nats://localhost:4222",
+			},
+		},
+	})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1/user/u1", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+	ac1PublicKey, err := readAccountPublicKey(context.Background(), reqStorage, "op1", "ac1")
+	assert.NoError(t, err)
+	assert.Contains(t, memory.Accounts(), ac1PublicKey)
+
+	t.Run("Test cascading delete removes the whole operator", func(t *testing.T) {
+		resp := request(logical.DeleteOperation, "issue/operator/op1", map[string]interface{}{"cascade": true})
+		assert.Nil(t, resp)
+
+		for _, prefix := range []string{"issue/", "nkey/", "jwt/", "creds/"} {
+			keys, err := collectKeys(context.Background(), reqStorage, prefix)
+			assert.NoError(t, err)
+			assert.Empty(t, keys, prefix)
+		}
+
+		// the accounts are deleted from the account server
+		assert.NotContains(t, memory.Accounts(), ac1PublicKey)
+	})
+}
+
+func TestOperatorIssueSystemAccountPushUserLimits(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"createSystemAccount": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	// the push user subscribes to the responses of the nats-servers,
+	// so its subscriptions, data and payload are unlimited
+	pushJWT, err := readUserJWT(context.Background(), reqStorage, JWTParameters{
+		Operator: "op1",
+		Account:  DefaultSysAccountName,
+		User:     DefaultPushUser,
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, pushJWT)
+	pushClaims, err := jwt.DecodeUserClaims(pushJWT.JWT)
+	assert.NoError(t, err)
+	assert.Equal(t, jwt.NatsLimits{
+		Subs:    jwt.NoLimit,
+		Data:    jwt.NoLimit,
+		Payload: jwt.NoLimit,
+	}, pushClaims.NatsLimits)
+}
@@ -0,0 +1,403 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+const (
+	// DefaultSigningKeyOverlap is the time a rotated signing key
+	// is still published next to its successor
+	DefaultSigningKeyOverlap = 24 * time.Hour
+)
+
+// RetiredSigningKey is a signing nkey that has been replaced by a rotation.
+// It stays published until it expires, so that JWTs signed by it remain valid.
+type RetiredSigningKey struct {
+	// Name the retired signing nkey is stored under
+	Name string `json:"name"`
+	// Key is the name of the signing key that has been rotated
+	Key string `json:"key"`
+	// Expires is the unix time the retired signing nkey is dropped
+	Expires int64 `json:"expires"`
+}
+
+// RotateSigningKeyParameters is the user facing interface for rotating a signing key.
+// Using pascal case on purpose.
+type RotateSigningKeyParameters struct {
+	Operator   string        `json:"operator"`
+	Account    string        `json:"account,omitempty"`
+	SigningKey string        `json:"signingKey"`
+	Overlap    time.Duration `json:"-"`
+}
+
+// RotateSigningKeyData represents the the data returned by a rotate operation
+type RotateSigningKeyData struct {
+	SigningKey       string `json:"signingKey"`
+	PublicKey        string `json:"publicKey"`
+	RetiredPublicKey string `json:"retiredPublicKey"`
+	RetiredUntil     int64  `json:"retiredUntil"`
+}
+
+func pathRotateSigningKey(b *NatsBackend) []*framework.Path {
+	signingKeyFields := map[string]*framework.FieldSchema{
+		"signingKey": {
+			Type:        framework.TypeString,
+			Description: "Name of the signing key to rotate",
+			Required:    true,
+		},
+		"overlap": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Time the old signing key is still published next to the new one. If set to 0, the old signing key is dropped immediately.",
+			Required:    false,
+			Default:     int(DefaultSigningKeyOverlap.Seconds()),
+		},
+	}
+	operatorFields := map[string]*framework.FieldSchema{
+		"operator": {
+			Type:        framework.TypeString,
+			Description: "operator identifier",
+			Required:    false,
+		},
+	}
+	accountFields := map[string]*framework.FieldSchema{
+		"operator": {
+			Type:        framework.TypeString,
+			Description: "operator identifier",
+			Required:    false,
+		},
+		"account": {
+			Type:        framework.TypeString,
+			Description: "account identifier",
+			Required:    false,
+		},
+	}
+	for k, v := range signingKeyFields {
+		operatorFields[k] = v
+		accountFields[k] = v
+	}
+
+	return []*framework.Path{
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/rotate$",
+			Fields:  operatorFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathRotateOperatorSigningKey,
+				},
+			},
+			HelpSynopsis:    `Rotates an operator signing key.`,
+			HelpDescription: `Creates a new nkey for the operator signing key and re-signs all accounts. The old signing key is published in the operator JWT until the overlap window closes.`,
+		},
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/rotate$",
+			Fields:  accountFields,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathRotateAccountSigningKey,
+				},
+			},
+			HelpSynopsis:    `Rotates an account signing key.`,
+			HelpDescription: `Creates a new nkey for the account signing key and re-signs all users. The old signing key is published in the account JWT until the overlap window closes.`,
+		},
+	}
+}
+
+func (b *NatsBackend) pathRotateOperatorSigningKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	params, resp, err := getRotateSigningKeyParameters(data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	rotated, err := rotateOperatorSigningKey(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", RotatingSigningKeyFailedError, err.Error())), nil
+	}
+	return createResponseRotateSigningKeyData(rotated)
+}
+
+func (b *NatsBackend) pathRotateAccountSigningKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	params, resp, err := getRotateSigningKeyParameters(data)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	rotated, err := rotateAccountSigningKey(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", RotatingSigningKeyFailedError, err.Error())), nil
+	}
+	return createResponseRotateSigningKeyData(rotated)
+}
+
+func getRotateSigningKeyParameters(data *framework.FieldData) (RotateSigningKeyParameters, *logical.Response, error) {
+	params := RotateSigningKeyParameters{}
+	err := data.Validate()
+	if err != nil {
+		return params, logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return params, logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+	params.Overlap = time.Duration(data.Get("overlap").(int)) * time.Second
+	return params, nil, nil
+}
+
+func rotateOperatorSigningKey(ctx context.Context, storage logical.Storage, params RotateSigningKeyParameters) (*RotateSigningKeyData, error) {
+	log.Info().
+		Str("operator", params.Operator).Str("signing", params.SigningKey).
+		Msg("rotate operator signing key")
+
+	issue, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{
+		Operator: params.Operator,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if issue == nil {
+		return nil, fmt.Errorf("operator issue does not exist")
+	}
+	if !containsString(issue.Claims.SigningKeys, params.SigningKey) {
+		return nil, fmt.Errorf("signing key %s is not part of the operator claims", params.SigningKey)
+	}
+
+	rotated, retired, err := rotateSigningNkey(ctx, storage, func(signingKey string) string {
+		return getOperatorSigningNkeyPath(issue.Operator, signingKey)
+	}, nkeys.PrefixByteOperator, params)
+	if err != nil {
+		return nil, err
+	}
+	issue.RetiredSigningKeys = append(issue.RetiredSigningKeys, *retired)
+	err = storeInStorage(ctx, storage, getOperatorIssuePath(issue.Operator), issue)
+	if err != nil {
+		return nil, err
+	}
+
+	// publish both signing keys and
+	// re-sign the accounts with the new one
+	err = issueOperatorJWT(ctx, storage, *issue)
+	if err != nil {
+		return nil, err
+	}
+	err = updateAccountIssues(ctx, storage, *issue)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Overlap == 0 {
+		err = expireOperatorSigningKeys(ctx, storage, issue, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rotated, nil
+}
+
+func rotateAccountSigningKey(ctx context.Context, storage logical.Storage, params RotateSigningKeyParameters) (*RotateSigningKeyData, error) {
+	log.Info().
+		Str("operator", params.Operator).Str("account", params.Account).Str("signing", params.SigningKey).
+		Msg("rotate account signing key")
+
+	issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if issue == nil {
+		return nil, fmt.Errorf("account issue does not exist")
+	}
+	if !containsString(getAccountSigningKeyNames(&issue.Claims), params.SigningKey) {
+		return nil, fmt.Errorf("signing key %s is not part of the account claims", params.SigningKey)
+	}
+
+	rotated, retired, err := rotateSigningNkey(ctx, storage, func(signingKey string) string {
+		return getAccountSigningNkeyPath(issue.Operator, issue.Account, signingKey)
+	}, nkeys.PrefixByteAccount, params)
+	if err != nil {
+		return nil, err
+	}
+	issue.RetiredSigningKeys = append(issue.RetiredSigningKeys, *retired)
+
+	// publish both signing keys and
+	// re-sign the users with the new one
+	err = refreshAccount(ctx, storage, issue)
+	if err != nil {
+		return nil, err
+	}
+	err = updateUserIssues(ctx, storage, *issue)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Overlap == 0 {
+		err = expireAccountSigningKeys(ctx, storage, issue, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rotated, nil
+}
+
+// rotateSigningNkey moves the current seed of a signing nkey to a retired
+// name and stores a new seed under the name of the signing key.
+// Issues referencing the signing key by name are signed by the new seed.
+func rotateSigningNkey(ctx context.Context, storage logical.Storage, path func(string) string, prefix nkeys.PrefixByte, params RotateSigningKeyParameters) (*RotateSigningKeyData, *RetiredSigningKey, error) {
+	current, err := readNkey(ctx, storage, path(params.SigningKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	if current == nil {
+		return nil, nil, fmt.Errorf("signing nkey does not exist: %s", params.SigningKey)
+	}
+	currentKeyPair, err := nkeys.FromSeed(current.Seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	currentPublicKey, err := currentKeyPair.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	retired := &RetiredSigningKey{
+		Name:    fmt.Sprintf("%s-retired-%d", params.SigningKey, now.UnixNano()),
+		Key:     params.SigningKey,
+		Expires: now.Add(params.Overlap).Unix(),
+	}
+	err = storeInStorage(ctx, storage, path(retired.Name), current)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seed, err := createSeed(prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = storeInStorage(ctx, storage, path(params.SigningKey), &NKeyStorage{Seed: seed})
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPair, err := nkeys.FromSeed(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := keyPair.PublicKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &RotateSigningKeyData{
+		SigningKey:       params.SigningKey,
+		PublicKey:        publicKey,
+		RetiredPublicKey: currentPublicKey,
+		RetiredUntil:     retired.Expires,
+	}, retired, nil
+}
+
+// expireOperatorSigningKeys drops the retired operator signing keys
+// whose overlap window is closed and re-issues the operator JWT.
+func expireOperatorSigningKeys(ctx context.Context, storage logical.Storage, issue *IssueOperatorStorage, now time.Time) error {
+	kept, expired := splitRetiredSigningKeys(issue.RetiredSigningKeys, now)
+	if len(expired) == 0 {
+		return nil
+	}
+
+	for _, retired := range expired {
+		log.Info().
+			Str("operator", issue.Operator).Str("signing", retired.Key).
+			Msg("drop retired operator signing key")
+		err := deleteOperatorSigningNkey(ctx, storage, NkeyParameters{
+			Operator: issue.Operator,
+			Signing:  retired.Name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	issue.RetiredSigningKeys = kept
+	err := storeInStorage(ctx, storage, getOperatorIssuePath(issue.Operator), issue)
+	if err != nil {
+		return err
+	}
+	return issueOperatorJWT(ctx, storage, *issue)
+}
+
+// expireAccountSigningKeys drops the retired account signing keys
+// whose overlap window is closed and re-issues the account JWT.
+func expireAccountSigningKeys(ctx context.Context, storage logical.Storage, issue *IssueAccountStorage, now time.Time) error {
+	kept, expired := splitRetiredSigningKeys(issue.RetiredSigningKeys, now)
+	if len(expired) == 0 {
+		return nil
+	}
+
+	for _, retired := range expired {
+		log.Info().
+			Str("operator", issue.Operator).Str("account", issue.Account).Str("signing", retired.Key).
+			Msg("drop retired account signing key")
+		err := deleteAccountSigningNkey(ctx, storage, NkeyParameters{
+			Operator: issue.Operator,
+			Account:  issue.Account,
+			Signing:  retired.Name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	issue.RetiredSigningKeys = kept
+	return refreshAccount(ctx, storage, issue)
+}
+
+func splitRetiredSigningKeys(retired []RetiredSigningKey, now time.Time) ([]RetiredSigningKey, []RetiredSigningKey) {
+	var kept, expired []RetiredSigningKey
+	for _, r := range retired {
+		if r.Expires <= now.Unix() {
+			expired = append(expired, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	return kept, expired
+}
+
+func getRetiredSigningKeyNames(retired []RetiredSigningKey) []string {
+	var names []string
+	for _, r := range retired {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func containsString(a []string, x string) bool {
+	for _, n := range a {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
+
+func createResponseRotateSigningKeyData(rotated *RotateSigningKeyData) (*logical.Response, error) {
+	rval := map[string]interface{}{}
+	err := stm.StructToMap(rotated, &rval)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: rval,
+	}
+	return resp, nil
+}
@@ -0,0 +1,199 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateSigningKey(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"signingKeys": []interface{}{"opsk1"},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"useSigningKey": "opsk1",
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"signingKeys": []interface{}{"acsk1"},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1/user/u1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"useSigningKey": "acsk1",
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	readAccountClaims := func() *jwt.AccountClaims {
+		accountJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(accountJWT.JWT)
+		assert.NoError(t, err)
+		return claims
+	}
+	readUserClaims := func() *jwt.UserClaims {
+		userJWT, err := readUserJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			User:     "u1",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeUserClaims(userJWT.JWT)
+		assert.NoError(t, err)
+		return claims
+	}
+	readOperatorClaims := func() *jwt.OperatorClaims {
+		operatorJWT, err := readOperatorJWT(context.Background(), reqStorage, JWTParameters{
+			Operator: "op1",
+		})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeOperatorClaims(operatorJWT.JWT)
+		assert.NoError(t, err)
+		return claims
+	}
+
+	t.Run("Test rotating unknown signing keys fails", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/ac1/rotate",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"signingKey": "unknown",
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op2/rotate",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"signingKey": "opsk1",
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+	})
+
+	t.Run("Test account signing key rotation with overlap window", func(t *testing.T) {
+		oldIssuer := readUserClaims().Issuer
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/account/ac1/rotate",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"signingKey": "acsk1",
+				"overlap":    "1h",
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		newKey := resp.Data["publicKey"].(string)
+		assert.Equal(t, oldIssuer, resp.Data["retiredPublicKey"])
+		assert.NotEqual(t, oldIssuer, newKey)
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), resp.Data["retiredUntil"], 5)
+
+		// both signing keys are published, the user is re-signed
+		accountClaims := readAccountClaims()
+		assert.Len(t, accountClaims.SigningKeys, 2)
+		assert.Contains(t, accountClaims.SigningKeys, oldIssuer)
+		assert.Contains(t, accountClaims.SigningKeys, newKey)
+		assert.Equal(t, newKey, readUserClaims().Issuer)
+
+		// the periodic func keeps the old key within the window
+		err = b.periodicFunc(context.Background(), &logical.Request{Storage: reqStorage})
+		assert.NoError(t, err)
+		assert.Len(t, readAccountClaims().SigningKeys, 2)
+
+		// and drops it after the window closed
+		issue, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{
+			Operator: "op1",
+			Account:  "ac1",
+		})
+		assert.NoError(t, err)
+		assert.Len(t, issue.RetiredSigningKeys, 1)
+		retired := issue.RetiredSigningKeys[0]
+		issue.RetiredSigningKeys[0].Expires = time.Now().Add(-time.Second).Unix()
+		_, err = storeAccountIssueUpdate(context.Background(), reqStorage, issue)
+		assert.NoError(t, err)
+
+		err = b.periodicFunc(context.Background(), &logical.Request{Storage: reqStorage})
+		assert.NoError(t, err)
+
+		accountClaims = readAccountClaims()
+		assert.Len(t, accountClaims.SigningKeys, 1)
+		assert.Contains(t, accountClaims.SigningKeys, newKey)
+		nkey, err := readAccountSigningNkey(context.Background(), reqStorage, NkeyParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			Signing:  retired.Name,
+		})
+		assert.NoError(t, err)
+		assert.Nil(t, nkey)
+	})
+
+	t.Run("Test operator signing key rotation without overlap window", func(t *testing.T) {
+		oldIssuer := readAccountClaims().Issuer
+
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/operator/op1/rotate",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"signingKey": "opsk1",
+				"overlap":    0,
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		newKey := resp.Data["publicKey"].(string)
+		assert.NotEqual(t, oldIssuer, newKey)
+
+		// the old key is dropped immediately and the account is re-signed
+		operatorClaims := readOperatorClaims()
+		assert.Equal(t, jwt.StringList{newKey}, operatorClaims.SigningKeys)
+		assert.Equal(t, newKey, readAccountClaims().Issuer)
+
+		issue, err := readOperatorIssue(context.Background(), reqStorage, IssueOperatorParameters{
+			Operator: "op1",
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, issue.RetiredSigningKeys)
+	})
+}
@@ -0,0 +1,205 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+const (
+	// ServerConfigResolverFull stores the accounts pushed to the nats-server in a directory
+	ServerConfigResolverFull = "full"
+	// ServerConfigResolverCache caches the accounts looked up from other nats-servers
+	ServerConfigResolverCache = "cache"
+	// ServerConfigResolverMemory preloads all accounts of the operator
+	ServerConfigResolverMemory = "memory"
+
+	// DefaultServerConfigResolverDir is the directory the full and cache resolvers store the accounts in
+	DefaultServerConfigResolverDir = "./jwt"
+)
+
+// ServerConfigParameters is the user facing interface for rendering a nats-server config.
+// Using pascal case on purpose.
+type ServerConfigParameters struct {
+	Operator    string `json:"operator"`
+	Resolver    string `json:"resolver"`
+	Dir         string `json:"dir"`
+	AllowDelete bool   `json:"allowDelete"`
+}
+
+// ServerConfigData represents the the data returned by a server config operation
+type ServerConfigData struct {
+	Operator      string `json:"operator"`
+	SystemAccount string `json:"systemAccount,omitempty"`
+	Resolver      string `json:"resolver"`
+	Config        string `json:"config"`
+}
+
+func pathServerConfig(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/server-config$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"resolver": {
+					Type:          framework.TypeString,
+					Description:   "Type of the account resolver: full, cache or memory",
+					Required:      false,
+					Default:       ServerConfigResolverFull,
+					AllowedValues: []interface{}{ServerConfigResolverFull, ServerConfigResolverCache, ServerConfigResolverMemory},
+				},
+				"dir": {
+					Type:        framework.TypeString,
+					Description: "Directory the full and cache resolvers store the account JWTs in",
+					Required:    false,
+					Default:     DefaultServerConfigResolverDir,
+				},
+				"allowDelete": {
+					Type:        framework.TypeBool,
+					Description: "Allow the full resolver to delete accounts",
+					Required:    false,
+					Default:     false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReadServerConfig,
+				},
+			},
+			HelpSynopsis:    `Renders a nats-server configuration for the operator.`,
+			HelpDescription: `Renders the operator JWT, the system account and the account resolver as nats-server configuration. The memory resolver preloads all account JWTs of the operator.`,
+		},
+	}
+}
+
+func (b *NatsBackend) pathReadServerConfig(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	params := ServerConfigParameters{
+		Operator:    data.Get("operator").(string),
+		Resolver:    data.Get("resolver").(string),
+		Dir:         data.Get("dir").(string),
+		AllowDelete: data.Get("allowDelete").(bool),
+	}
+
+	config, err := renderServerConfig(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", RenderingServerConfigFailedError, err.Error())), nil
+	}
+	return createResponseServerConfigData(config)
+}
+
+// renderServerConfig renders the nats-server configuration that
+// trusts the operator and resolves its accounts
+func renderServerConfig(ctx context.Context, storage logical.Storage, params ServerConfigParameters) (*ServerConfigData, error) {
+	switch params.Resolver {
+	case ServerConfigResolverFull, ServerConfigResolverCache, ServerConfigResolverMemory:
+	default:
+		return nil, fmt.Errorf("unknown resolver %q", params.Resolver)
+	}
+
+	operatorJWT, err := readOperatorJWT(ctx, storage, JWTParameters{
+		Operator: params.Operator,
+	})
+	if err != nil {
+		return nil, err
+	} else if operatorJWT == nil {
+		return nil, fmt.Errorf("operator jwt does not exist")
+	}
+
+	accounts, err := listManagedAccounts(ctx, storage, params.Operator)
+	if err != nil {
+		return nil, err
+	}
+
+	systemAccount := ""
+	for publicKey, account := range accounts {
+		if account.Name == DefaultSysAccountName {
+			systemAccount = publicKey
+		}
+	}
+	if systemAccount == "" && params.Resolver != ServerConfigResolverMemory {
+		return nil, fmt.Errorf("the %s resolver requires the system account", params.Resolver)
+	}
+
+	// the full and cache resolver only need the system account,
+	// all other accounts are pushed or looked up
+	preload := map[string]managedAccount{}
+	for publicKey, account := range accounts {
+		if params.Resolver == ServerConfigResolverMemory || publicKey == systemAccount {
+			preload[publicKey] = account
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Operator %q\n", params.Operator)
+	fmt.Fprintf(&sb, "operator: %q\n", operatorJWT.JWT)
+	if systemAccount != "" {
+		fmt.Fprintf(&sb, "system_account: %q\n", systemAccount)
+	}
+	sb.WriteString("\n")
+
+	switch params.Resolver {
+	case ServerConfigResolverFull:
+		sb.WriteString("resolver: {\n")
+		sb.WriteString("    type: full\n")
+		fmt.Fprintf(&sb, "    dir: %q\n", params.Dir)
+		fmt.Fprintf(&sb, "    allow_delete: %t\n", params.AllowDelete)
+		sb.WriteString("    interval: \"2m\"\n")
+		sb.WriteString("}\n")
+	case ServerConfigResolverCache:
+		sb.WriteString("resolver: {\n")
+		sb.WriteString("    type: cache\n")
+		fmt.Fprintf(&sb, "    dir: %q\n", params.Dir)
+		sb.WriteString("    ttl: \"1h\"\n")
+		sb.WriteString("}\n")
+	case ServerConfigResolverMemory:
+		sb.WriteString("resolver: MEMORY\n")
+	}
+
+	publicKeys := make([]string, 0, len(preload))
+	for publicKey := range preload {
+		publicKeys = append(publicKeys, publicKey)
+	}
+	sort.Strings(publicKeys)
+
+	sb.WriteString("\nresolver_preload: {\n")
+	for _, publicKey := range publicKeys {
+		fmt.Fprintf(&sb, "    # Account %q\n", preload[publicKey].Name)
+		fmt.Fprintf(&sb, "    %s: %q\n", publicKey, preload[publicKey].JWT)
+	}
+	sb.WriteString("}\n")
+
+	return &ServerConfigData{
+		Operator:      params.Operator,
+		SystemAccount: systemAccount,
+		Resolver:      params.Resolver,
+		Config:        sb.String(),
+	}, nil
+}
+
+func createResponseServerConfigData(config *ServerConfigData) (*logical.Response, error) {
+	rval := map[string]interface{}{}
+	err := stm.StructToMap(config, &rval)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: rval,
+	}
+	return resp, nil
+}
@@ -0,0 +1,147 @@
+package natsbackend
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerConfig(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	// the operator must exist
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "issue/operator/op1/server-config",
+		Storage:   reqStorage,
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"createSystemAccount": true,
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	managed, err := listManagedAccounts(context.Background(), reqStorage, "op1")
+	assert.NoError(t, err)
+
+	// parseConfig checks that the rendered config is accepted by the nats-server.
+	// The preloads are stored in the resolver once the server is created.
+	parseConfig := func(config string) *server.Options {
+		path := filepath.Join(t.TempDir(), "server.conf")
+		assert.NoError(t, os.WriteFile(path, []byte(config), 0600))
+		opts, err := server.ProcessConfigFile(path)
+		assert.NoError(t, err)
+		return opts
+	}
+
+	t.Run("Test full resolver", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "issue/operator/op1/server-config",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"dir":         t.TempDir(),
+				"allowDelete": true,
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, ServerConfigResolverFull, resp.Data["resolver"])
+
+		opts := parseConfig(resp.Data["config"].(string))
+		assert.Len(t, opts.TrustedOperators, 1)
+		assert.Equal(t, resp.Data["systemAccount"], opts.SystemAccount)
+		assert.IsType(t, &server.DirAccResolver{}, opts.AccountResolver)
+
+		// only the system account is preloaded
+		opts.NoLog = true
+		_, err = server.NewServer(opts)
+		assert.NoError(t, err)
+		jwt, err := opts.AccountResolver.Fetch(opts.SystemAccount)
+		assert.NoError(t, err)
+		assert.Equal(t, managed[opts.SystemAccount].JWT, jwt)
+		for publicKey, account := range managed {
+			if account.Name != DefaultSysAccountName {
+				_, err := opts.AccountResolver.Fetch(publicKey)
+				assert.Error(t, err)
+			}
+		}
+	})
+
+	t.Run("Test cache resolver", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "issue/operator/op1/server-config",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"resolver": ServerConfigResolverCache,
+				"dir":      t.TempDir(),
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		opts := parseConfig(resp.Data["config"].(string))
+		assert.IsType(t, &server.CacheDirAccResolver{}, opts.AccountResolver)
+	})
+
+	t.Run("Test memory resolver preloads all accounts", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "issue/operator/op1/server-config",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"resolver": ServerConfigResolverMemory,
+			},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		opts := parseConfig(resp.Data["config"].(string))
+		assert.IsType(t, &server.MemAccResolver{}, opts.AccountResolver)
+
+		opts.NoLog = true
+		_, err = server.NewServer(opts)
+		assert.NoError(t, err)
+		for publicKey, account := range managed {
+			jwt, err := opts.AccountResolver.Fetch(publicKey)
+			assert.NoError(t, err)
+			assert.Equal(t, account.JWT, jwt)
+		}
+	})
+
+	t.Run("Test unknown resolver", func(t *testing.T) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "issue/operator/op1/server-config",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"resolver": "url",
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+	})
+}
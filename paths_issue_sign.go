@@ -0,0 +1,457 @@
+package natsbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// SignedUserStorage is a user JWT that has been signed for a public key
+// supplied by the caller. The seed of the user never reaches the plugin,
+// only the public key is kept to be able to revoke the user.
+type SignedUserStorage struct {
+	Operator      string `json:"operator"`
+	Account       string `json:"account"`
+	PublicKey     string `json:"publicKey"`
+	Name          string `json:"name"`
+	Role          string `json:"role"`
+	UseSigningKey string `json:"useSigningKey"`
+	// IssuedAt is the unix time the JWT was signed
+	IssuedAt int64 `json:"issuedAt"`
+	// Expires is the unix time the JWT expires, 0 if it never expires
+	Expires int64 `json:"expires"`
+}
+
+// SignUserParameters is the user facing interface for signing a user JWT.
+// Using pascal case on purpose.
+type SignUserParameters struct {
+	Operator      string              `json:"operator"`
+	Account       string              `json:"account"`
+	PublicKey     string              `json:"publicKey"`
+	Name          string              `json:"name,omitempty"`
+	Role          string              `json:"role,omitempty"`
+	UseSigningKey string              `json:"useSigningKey,omitempty"`
+	Claims        v1alpha1.UserClaims `json:"claims,omitempty"`
+	Expires       time.Duration       `json:"-"`
+}
+
+// SignUserData represents the the data returned by a sign operation
+type SignUserData struct {
+	JWT       string `json:"jwt"`
+	PublicKey string `json:"publicKey"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// SignedUserData represents the the data returned by reading a signed user
+type SignedUserData struct {
+	Operator      string `json:"operator"`
+	Account       string `json:"account"`
+	PublicKey     string `json:"publicKey"`
+	Name          string `json:"name"`
+	Role          string `json:"role"`
+	UseSigningKey string `json:"useSigningKey"`
+	IssuedAt      int64  `json:"issuedAt"`
+	Expires       int64  `json:"expires"`
+}
+
+func pathSignUser(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/sign$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier",
+					Required:    false,
+				},
+				"publicKey": {
+					Type:        framework.TypeString,
+					Description: "User public key the JWT is signed for",
+					Required:    true,
+				},
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the user in the JWT",
+					Required:    false,
+				},
+				"role": {
+					Type:        framework.TypeString,
+					Description: "Role of the account to take the claims, signing key and maximum lifetime from. Cannot be combined with claims or useSigningKey.",
+					Required:    false,
+				},
+				"useSigningKey": {
+					Type:        framework.TypeString,
+					Description: "Account signing key to sign the user",
+					Required:    false,
+				},
+				"claims": {
+					Type:        framework.TypeMap,
+					Description: "User claims (jwt.UserClaims from github.com/nats-io/jwt/v2)",
+					Required:    false,
+				},
+				"expires": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Time the user JWT is valid. If set to 0, the JWT never expires or, with a role, expires after the role's maxTtl.",
+					Required:    false,
+					Default:     0,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathSignUser,
+				},
+			},
+			HelpSynopsis:    `Signs a user JWT for a public key supplied by the caller.`,
+			HelpDescription: `The user seed is kept by the caller and is never sent to the plugin. The JWT is signed by the account or one of its signing keys. Only the public key is stored, so that the user can be revoked with "signed/<publicKey>".`,
+		},
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/signed/" + framework.GenericNameRegex("publicKey") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier",
+					Required:    false,
+				},
+				"publicKey": {
+					Type:        framework.TypeString,
+					Description: "User public key",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReadSignedUser,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathRevokeSignedUser,
+				},
+			},
+			HelpSynopsis:    `Manages users signed for public keys supplied by the caller.`,
+			HelpDescription: `Deleting a signed user adds its public key to the revocation list of the account.`,
+		},
+		{
+			Pattern: "issue/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/signed/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathListSignedUsers,
+				},
+			},
+			HelpSynopsis:    "Lists the public keys of the signed users of an account.",
+			HelpDescription: "",
+		},
+	}
+}
+
+func (b *NatsBackend) pathSignUser(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	jsonString, err := json.Marshal(data.Raw)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+	params := SignUserParameters{}
+	json.Unmarshal(jsonString, &params)
+	params.Expires = time.Duration(data.Get("expires").(int)) * time.Second
+
+	if params.Role != "" {
+		if _, ok := data.Raw["claims"]; ok || params.UseSigningKey != "" {
+			return logical.ErrorResponse(fmt.Sprintf("%s: role cannot be combined with claims or useSigningKey", SigningUserFailedError)), nil
+		}
+		role, err := readRole(ctx, req.Storage, params.Role)
+		if err != nil {
+			return logical.ErrorResponse(ReadingRoleFailedError), nil
+		}
+		if role == nil {
+			return logical.ErrorResponse(RoleNotFoundError), nil
+		}
+		if role.Operator != params.Operator || role.Account != params.Account {
+			return logical.ErrorResponse(fmt.Sprintf("%s: role %s does not belong to the account", SigningUserFailedError, params.Role)), nil
+		}
+		// the role caps the lifetime the same way as for leased creds
+		_, maxTTL := b.roleLeaseTTLs(role)
+		if params.Expires == 0 || params.Expires > maxTTL {
+			params.Expires = maxTTL
+		}
+		params.Claims = *role.Claims.DeepCopy()
+		params.UseSigningKey = role.UseSigningKey
+		if params.Name == "" {
+			params.Name = role.Role
+		}
+	}
+
+	warnings, err := validateUserIssue(IssueUserParameters{
+		UseSigningKey: params.UseSigningKey,
+		Claims:        params.Claims,
+	})
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", SigningUserFailedError, err.Error())), nil
+	}
+
+	signed, err := signUser(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", SigningUserFailedError, err.Error())), nil
+	}
+
+	rval := map[string]interface{}{}
+	err = stm.StructToMap(signed, &rval)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data:     rval,
+		Warnings: warnings,
+	}, nil
+}
+
+func (b *NatsBackend) pathReadSignedUser(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	signed, err := readSignedUser(ctx, req.Storage, data.Get("operator").(string), data.Get("account").(string), data.Get("publicKey").(string))
+	if err != nil {
+		return logical.ErrorResponse(ReadingIssueFailedError), nil
+	}
+	if signed == nil {
+		return logical.ErrorResponse(IssueNotFoundError), nil
+	}
+	return createResponseSignedUserData(signed)
+}
+
+func (b *NatsBackend) pathListSignedUsers(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	entries, err := listSignedUsers(ctx, req.Storage, data.Get("operator").(string), data.Get("account").(string))
+	if err != nil {
+		return logical.ErrorResponse(ListIssuesFailedError), nil
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *NatsBackend) pathRevokeSignedUser(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	err = revokeSignedUser(ctx, req.Storage, data.Get("operator").(string), data.Get("account").(string), data.Get("publicKey").(string))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", RevokingSignedUserFailedError, err.Error())), nil
+	}
+	return nil, nil
+}
+
+// signUser signs a user JWT for the public key of the parameters
+// and keeps the public key to be able to revoke the user
+func signUser(ctx context.Context, storage logical.Storage, params SignUserParameters) (*SignUserData, error) {
+	log.Info().
+		Str("operator", params.Operator).Str("account", params.Account).
+		Msgf("sign user %s", params.PublicKey)
+
+	if !nkeys.IsValidPublicUserKey(params.PublicKey) {
+		return nil, fmt.Errorf("not a user public key: %s", params.PublicKey)
+	}
+	if params.Expires < 0 {
+		return nil, fmt.Errorf("expires must not be negative")
+	}
+
+	account, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+	})
+	if err != nil {
+		return nil, err
+	} else if account == nil {
+		return nil, fmt.Errorf("account issue does not exist")
+	}
+	if _, revoked := account.Claims.Revocations[params.PublicKey]; revoked {
+		return nil, fmt.Errorf("public key has been revoked")
+	}
+
+	params.UseSigningKey, err = resolveUserSigningKey(ctx, storage, params.Operator, params.Account, params.UseSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	signingKeyPair, accountPublicKey, err := readUserSigningKeyPair(ctx, storage, params.Operator, params.Account, params.UseSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if signingKeyPair == nil {
+		return nil, fmt.Errorf("account nkey does not exist: %s", params.Account)
+	}
+	signingPublicKey, err := signingKeyPair.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var expires int64
+	if params.Expires > 0 {
+		expires = now.Add(params.Expires).Unix()
+	}
+
+	claims := *params.Claims.DeepCopy()
+	if params.UseSigningKey != "" {
+		claims.IssuerAccount = accountPublicKey
+	}
+	claims.ClaimsData.Subject = params.PublicKey
+	claims.ClaimsData.Issuer = signingPublicKey
+	claims.ClaimsData.Name = params.Name
+	claims.ClaimsData.Expires = expires
+	natsJwt, err := v1alpha1.Convert(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert claims to nats jwt: %s", err)
+	}
+	err = applySigningKeyScope(ctx, storage, params.Operator, params.Account, params.UseSigningKey, natsJwt)
+	if err != nil {
+		return nil, err
+	}
+	token, err := natsJwt.Encode(signingKeyPair)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode jwt: %s", err)
+	}
+
+	// the jwt itself is not stored, it can be signed again at any time
+	err = storeInStorage(ctx, storage, getSignedUserPath(params.Operator, params.Account, params.PublicKey), &SignedUserStorage{
+		Operator:      params.Operator,
+		Account:       params.Account,
+		PublicKey:     params.PublicKey,
+		Name:          params.Name,
+		Role:          params.Role,
+		UseSigningKey: params.UseSigningKey,
+		IssuedAt:      now.Unix(),
+		Expires:       expires,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("operator", params.Operator).Str("account", params.Account).
+		Msgf("user jwt signed for %s", params.PublicKey)
+
+	return &SignUserData{
+		JWT:       token,
+		PublicKey: params.PublicKey,
+		ExpiresAt: expires,
+	}, nil
+}
+
+// revokeSignedUser adds the public key of a signed user to the revocation
+// list of the account and forgets about the user
+func revokeSignedUser(ctx context.Context, storage logical.Storage, operator string, account string, publicKey string) error {
+	signed, err := readSignedUser(ctx, storage, operator, account, publicKey)
+	if err != nil {
+		return err
+	}
+	if signed == nil {
+		return fmt.Errorf("signed user does not exist")
+	}
+
+	issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator: operator,
+		Account:  account,
+	})
+	if err != nil {
+		return err
+	}
+	if issue != nil {
+		err = addPublicKeyToRevocationList(ctx, storage, issue, publicKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info().
+		Str("operator", operator).Str("account", account).
+		Msgf("signed user revoked: %s", publicKey)
+	return deleteFromStorage(ctx, storage, getSignedUserPath(operator, account, publicKey))
+}
+
+func readSignedUser(ctx context.Context, storage logical.Storage, operator string, account string, publicKey string) (*SignedUserStorage, error) {
+	return getFromStorage[SignedUserStorage](ctx, storage, getSignedUserPath(operator, account, publicKey))
+}
+
+func listSignedUsers(ctx context.Context, storage logical.Storage, operator string, account string) ([]string, error) {
+	return listIssues(ctx, storage, getSignedUserPath(operator, account, ""))
+}
+
+// deleteSignedUsers deletes the signed users of an account
+// without adding them to the revocation list
+func deleteSignedUsers(ctx context.Context, storage logical.Storage, operator string, account string) error {
+	signed, err := listSignedUsers(ctx, storage, operator, account)
+	if err != nil {
+		return err
+	}
+	for _, publicKey := range signed {
+		err := deleteFromStorage(ctx, storage, getSignedUserPath(operator, account, publicKey))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getSignedUserPath(operator string, account string, publicKey string) string {
+	return getAccountIssuePath(operator, account) + "/signed/" + publicKey
+}
+
+func createResponseSignedUserData(signed *SignedUserStorage) (*logical.Response, error) {
+	data := &SignedUserData{
+		Operator:      signed.Operator,
+		Account:       signed.Account,
+		PublicKey:     signed.PublicKey,
+		Name:          signed.Name,
+		Role:          signed.Role,
+		UseSigningKey: signed.UseSigningKey,
+		IssuedAt:      signed.IssuedAt,
+		Expires:       signed.Expires,
+	}
+
+	rval := map[string]interface{}{}
+	err := stm.StructToMap(data, &rval)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: rval,
+	}, nil
+}
@@ -0,0 +1,194 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignUser(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	userPublicKey := func() string {
+		kp, err := nkeys.CreateUser()
+		assert.NoError(t, err)
+		pub, err := kp.PublicKey()
+		assert.NoError(t, err)
+		return pub
+	}
+
+	resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{})
+	assert.False(t, resp.IsError())
+	resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1", map[string]interface{}{
+		"claims": map[string]interface{}{
+			"account": map[string]interface{}{
+				"signingKeys": []interface{}{"acsk1"},
+			},
+		},
+	})
+	assert.False(t, resp.IsError())
+	accountPublicKey, err := readAccountPublicKey(context.Background(), reqStorage, "op1", "ac1")
+	assert.NoError(t, err)
+
+	t.Run("Test sign user with claims", func(t *testing.T) {
+		pub := userPublicKey()
+		resp := request(logical.UpdateOperation, "issue/operator/op1/account/ac1/sign", map[string]interface{}{
+			"publicKey":     pub,
+			"name":          "device1",
+			"useSigningKey": "acsk1",
+			"expires":       "1h",
+			"claims": map[string]interface{}{
+				"user": map[string]interface{}{
+					"pub": map[string]interface{}{
+						"allow": []interface{}{"foo.>"},
+					},
+				},
+			},
+		})
+		assert.False(t, resp.IsError())
+
+		claims, err := jwt.DecodeUserClaims(resp.Data["jwt"].(string))
+		assert.NoError(t, err)
+		assert.Equal(t, pub, claims.Subject)
+		assert.Equal(t, "device1", claims.Name)
+		assert.Equal(t, accountPublicKey, claims.IssuerAccount)
+		assert.NotEqual(t, accountPublicKey, claims.Issuer)
+		assert.Equal(t, jwt.StringList{"foo.>"}, claims.Pub.Allow)
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), claims.Expires, 5)
+
+		// neither a seed nor a user issue is stored
+		nkey, err := readNkey(context.Background(), reqStorage, getUserNkeyPath("op1", "ac1", "device1"))
+		assert.NoError(t, err)
+		assert.Nil(t, nkey)
+		users, err := listUserIssues(context.Background(), reqStorage, IssueUserParameters{Operator: "op1", Account: "ac1"})
+		assert.NoError(t, err)
+		assert.Empty(t, users)
+
+		resp = request(logical.ReadOperation, "issue/operator/op1/account/ac1/signed/"+pub, nil)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, pub, resp.Data["publicKey"])
+		assert.Equal(t, "acsk1", resp.Data["useSigningKey"])
+	})
+
+	t.Run("Test sign user with role", func(t *testing.T) {
+		resp := request(logical.CreateOperation, "role/r1", map[string]interface{}{
+			"operator": "op1",
+			"account":  "ac1",
+			"maxTtl":   "2h",
+			"claims": map[string]interface{}{
+				"user": map[string]interface{}{
+					"sub": map[string]interface{}{
+						"allow": []interface{}{"bar.>"},
+					},
+				},
+			},
+		})
+		assert.False(t, resp.IsError())
+
+		pub := userPublicKey()
+		resp = request(logical.UpdateOperation, "issue/operator/op1/account/ac1/sign", map[string]interface{}{
+			"publicKey": pub,
+			"role":      "r1",
+		})
+		assert.False(t, resp.IsError())
+
+		claims, err := jwt.DecodeUserClaims(resp.Data["jwt"].(string))
+		assert.NoError(t, err)
+		assert.Equal(t, "r1", claims.Name)
+		assert.Equal(t, accountPublicKey, claims.Issuer)
+		assert.Equal(t, jwt.StringList{"bar.>"}, claims.Sub.Allow)
+		assert.InDelta(t, time.Now().Add(2*time.Hour).Unix(), claims.Expires, 5)
+
+		// the role cannot be combined with claims
+		resp = request(logical.UpdateOperation, "issue/operator/op1/account/ac1/sign", map[string]interface{}{
+			"publicKey": pub,
+			"role":      "r1",
+			"claims":    map[string]interface{}{},
+		})
+		assert.True(t, resp.IsError())
+
+		// the role has to belong to the account
+		resp = request(logical.CreateOperation, "issue/operator/op1/account/ac2", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+		resp = request(logical.UpdateOperation, "issue/operator/op1/account/ac2/sign", map[string]interface{}{
+			"publicKey": pub,
+			"role":      "r1",
+		})
+		assert.True(t, resp.IsError())
+	})
+
+	t.Run("Test sign user refuses other keys", func(t *testing.T) {
+		resp := request(logical.UpdateOperation, "issue/operator/op1/account/ac1/sign", map[string]interface{}{
+			"publicKey": accountPublicKey,
+		})
+		assert.True(t, resp.IsError())
+
+		kp, err := nkeys.CreateUser()
+		assert.NoError(t, err)
+		seed, err := kp.Seed()
+		assert.NoError(t, err)
+		resp = request(logical.UpdateOperation, "issue/operator/op1/account/ac1/sign", map[string]interface{}{
+			"publicKey": string(seed),
+		})
+		assert.True(t, resp.IsError())
+
+		resp = request(logical.UpdateOperation, "issue/operator/op1/account/unknown/sign", map[string]interface{}{
+			"publicKey": userPublicKey(),
+		})
+		assert.True(t, resp.IsError())
+	})
+
+	t.Run("Test revoke signed user", func(t *testing.T) {
+		pub := userPublicKey()
+		resp := request(logical.UpdateOperation, "issue/operator/op1/account/ac1/sign", map[string]interface{}{
+			"publicKey": pub,
+		})
+		assert.False(t, resp.IsError())
+
+		resp = request(logical.ListOperation, "issue/operator/op1/account/ac1/signed/", nil)
+		assert.False(t, resp.IsError())
+		assert.Contains(t, resp.Data["keys"], pub)
+
+		resp = request(logical.DeleteOperation, "issue/operator/op1/account/ac1/signed/"+pub, nil)
+		assert.False(t, resp.IsError())
+
+		token, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{Operator: "op1", Account: "ac1"})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeAccountClaims(token.JWT)
+		assert.NoError(t, err)
+		assert.Contains(t, claims.Revocations, pub)
+
+		resp = request(logical.ReadOperation, "issue/operator/op1/account/ac1/signed/"+pub, nil)
+		assert.True(t, resp.IsError())
+
+		// a revoked public key is not signed again
+		resp = request(logical.UpdateOperation, "issue/operator/op1/account/ac1/sign", map[string]interface{}{
+			"publicKey": pub,
+		})
+		assert.True(t, resp.IsError())
+	})
+
+	t.Run("Test signed users are deleted with the account", func(t *testing.T) {
+		resp := request(logical.DeleteOperation, "issue/operator/op1/account/ac1", nil)
+		assert.False(t, resp.IsError())
+
+		signed, err := listSignedUsers(context.Background(), reqStorage, "op1", "ac1")
+		assert.NoError(t, err)
+		assert.Empty(t, signed)
+	})
+}
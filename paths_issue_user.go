@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -46,6 +47,9 @@ type IssueUserData struct {
 
 type IssueUserStatus struct {
 	User IssueStatus `json:"user"`
+	// IdentityKeySigned is set if the JWT is signed with the account
+	// identity key although the operator enforces signing keys
+	IdentityKeySigned bool `json:"identityKeySigned,omitempty"`
 }
 
 func pathUserIssue(b *NatsBackend) []*framework.Path {
@@ -78,6 +82,12 @@ func pathUserIssue(b *NatsBackend) []*framework.Path {
 					Description: "User claims (jwt.UserClaims from github.com/nats-io/jwt/v2)",
 					Required:    false,
 				},
+				"dryRun": {
+					Type:        framework.TypeBool,
+					Description: "Return the changes of the write without storing or pushing anything",
+					Required:    false,
+					Default:     false,
+				},
 			},
 			Operations: map[logical.Operation]framework.OperationHandler{
 				logical.CreateOperation: &framework.PathOperation{
@@ -134,11 +144,22 @@ func (b *NatsBackend) pathAddUserIssue(ctx context.Context, req *logical.Request
 	params := IssueUserParameters{}
 	json.Unmarshal(jsonString, &params)
 
+	warnings, err := validateUserIssue(params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingIssueFailedError, err.Error())), nil
+	}
+
+	if data.Get("dryRun").(bool) {
+		return dryRunIssue(ctx, req.Storage, getUserJWTPath(params.Operator, params.Account, params.User), warnings, func(ctx context.Context, storage logical.Storage) error {
+			return addUserIssue(ctx, storage, params)
+		})
+	}
+
 	err = addUserIssue(ctx, req.Storage, params)
 	if err != nil {
-		return logical.ErrorResponse(AddingIssueFailedError), nil
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingIssueFailedError, err.Error())), nil
 	}
-	return nil, nil
+	return createResponseWarnings(warnings)
 }
 
 func (b *NatsBackend) pathReadUserIssue(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -163,6 +184,15 @@ func (b *NatsBackend) pathReadUserIssue(ctx context.Context, req *logical.Reques
 		return logical.ErrorResponse(IssueNotFoundError), nil
 	}
 
+	op, err := readOperatorIssue(ctx, req.Storage, IssueOperatorParameters{Operator: issue.Operator})
+	if err != nil {
+		return logical.ErrorResponse(ReadingIssueFailedError), nil
+	}
+	issue.Status.IdentityKeySigned, err = isUserIdentityKeySigned(ctx, req.Storage, op, issue.Account, issue.User)
+	if err != nil {
+		return logical.ErrorResponse(ReadingIssueFailedError), nil
+	}
+
 	return createResponseIssueUserData(issue)
 }
 
@@ -212,6 +242,22 @@ func addUserIssue(ctx context.Context, storage logical.Storage, params IssueUser
 		Str("operator", params.Operator).Str("account", params.Account).Str("user", params.User).
 		Msgf("issue user")
 
+	useSigningKey, err := resolveUserSigningKey(ctx, storage, params.Operator, params.Account, params.UseSigningKey)
+	if err != nil {
+		return err
+	}
+
+	// refuse claims exceeding a scoped signing key
+	// before the issue is stored
+	natsJwt, err := v1alpha1.Convert(&params.Claims)
+	if err != nil {
+		return fmt.Errorf("could not convert claims to nats jwt: %s", err)
+	}
+	err = applySigningKeyScope(ctx, storage, params.Operator, params.Account, useSigningKey, natsJwt)
+	if err != nil {
+		return err
+	}
+
 	// store issue
 	issue, err := storeUserIssue(ctx, storage, params)
 	if err != nil {
@@ -305,13 +351,55 @@ func deleteUserIssue(ctx context.Context, storage logical.Storage, params IssueU
 		}
 	}
 
+	err = purgeUserIssue(ctx, storage, issue)
+	if err != nil {
+		return err
+	}
+
+	// an account with an auth callout must no longer publish the deleted user
+	return refreshAuthCalloutAccount(ctx, storage, issue.Operator, issue.Account, issue.User, "")
+}
+
+// deleteUserIssues deletes all user issues of an account without
+// adding the users to the revocation list of the account
+func deleteUserIssues(ctx context.Context, storage logical.Storage, operator string, account string) error {
+	users, err := listUserIssues(ctx, storage, IssueUserParameters{
+		Operator: operator,
+		Account:  account,
+	})
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		issue, err := readUserIssue(ctx, storage, IssueUserParameters{
+			Operator: operator,
+			Account:  account,
+			User:     user,
+		})
+		if err != nil {
+			return err
+		}
+		if issue == nil {
+			continue
+		}
+		err = purgeUserIssue(ctx, storage, issue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeUserIssue deletes the user issue with its nkey, jwt and creds
+// without adding the user to the revocation list of the account
+func purgeUserIssue(ctx context.Context, storage logical.Storage, issue *IssueUserStorage) error {
 	// delete user nkey
 	nkey := NkeyParameters{
 		Operator: issue.Operator,
 		Account:  issue.Account,
 		User:     issue.User,
 	}
-	err = deleteUserNkey(ctx, storage, nkey)
+	err := deleteUserNkey(ctx, storage, nkey)
 	if err != nil {
 		return err
 	}
@@ -392,6 +480,11 @@ func issueUserNKeys(ctx context.Context, storage logical.Storage, issue IssueUse
 		if err != nil {
 			return err
 		}
+		// the account publishes the public keys of its auth callout users
+		err = refreshAuthCalloutAccount(ctx, storage, issue.Operator, issue.Account, issue.User, "")
+		if err != nil {
+			return err
+		}
 	}
 	log.Info().
 		Str("operator", issue.Operator).Str("account", issue.Account).Str("user", issue.User).
@@ -400,53 +493,21 @@ func issueUserNKeys(ctx context.Context, storage logical.Storage, issue IssueUse
 }
 
 func issueUserJWT(ctx context.Context, storage logical.Storage, issue IssueUserStorage) error {
-	// use either operator nkey or signing nkey
+	// use either account nkey or signing nkey
 	// to sign jwt and add issuer claim
-	useSigningKey := issue.UseSigningKey
-	var seed []byte
-	accountNkey, err := readAccountNkey(ctx, storage, NkeyParameters{
-		Operator: issue.Operator,
-		Account:  issue.Account,
-	})
-	if err != nil {
-		return fmt.Errorf("could not read operator nkey: %s", err)
-	}
-	if accountNkey == nil {
-		log.Warn().
-			Str("operator", issue.Operator).Str("account", issue.Account).Str("user", issue.User).
-			Msgf("account nkey does not exist: %s - Cannot create jwt.", issue.Account)
-		return nil
-	}
-	accountKeyPair, err := nkeys.FromSeed(accountNkey.Seed)
+	useSigningKey, err := resolveUserSigningKey(ctx, storage, issue.Operator, issue.Account, issue.UseSigningKey)
 	if err != nil {
 		return err
 	}
-	accountPublicKey, err := accountKeyPair.PublicKey()
+	signingKeyPair, accountPublicKey, err := readUserSigningKeyPair(ctx, storage, issue.Operator, issue.Account, useSigningKey)
 	if err != nil {
 		return err
 	}
-	if useSigningKey == "" {
-		seed = accountNkey.Seed
-	} else {
-		signingNkey, err := readAccountSigningNkey(ctx, storage, NkeyParameters{
-			Operator: issue.Operator,
-			Account:  issue.Account,
-			Signing:  useSigningKey,
-		})
-		if err != nil {
-			return fmt.Errorf("could not read signing nkey: %s", err)
-		}
-		if signingNkey == nil {
-			log.Error().
-				Str("operator", issue.Operator).Str("account", issue.Account).Str("user", issue.User).
-				Msgf("account signing nkey does not exist: %s - Cannot create jwt.", useSigningKey)
-			return fmt.Errorf("account signing nkey does not exist: %s - Cannot create JWT", useSigningKey)
-		}
-		seed = signingNkey.Seed
-	}
-	signingKeyPair, err := nkeys.FromSeed(seed)
-	if err != nil {
-		return err
+	if signingKeyPair == nil {
+		log.Warn().
+			Str("operator", issue.Operator).Str("account", issue.Account).Str("user", issue.User).
+			Msgf("account nkey does not exist: %s - Cannot create jwt.", issue.Account)
+		return nil
 	}
 	signingPublicKey, err := signingKeyPair.PublicKey()
 	if err != nil {
@@ -485,6 +546,10 @@ func issueUserJWT(ctx context.Context, storage logical.Storage, issue IssueUserS
 	if err != nil {
 		return fmt.Errorf("could not convert claims to nats jwt: %s", err)
 	}
+	err = applySigningKeyScope(ctx, storage, issue.Operator, issue.Account, useSigningKey, natsJwt)
+	if err != nil {
+		return err
+	}
 	token, err := natsJwt.Encode(signingKeyPair)
 	if err != nil {
 		return fmt.Errorf("could not encode jwt: %s", err)
@@ -509,6 +574,54 @@ func issueUserJWT(ctx context.Context, storage logical.Storage, issue IssueUserS
 	return nil
 }
 
+// readUserSigningKeyPair returns the key pair that signs users of an account
+// together with the account public key. Either the account nkey itself or the
+// account signing nkey named by useSigningKey is used. A nil key pair is returned
+// if the account nkey does not exist yet.
+func readUserSigningKeyPair(ctx context.Context, storage logical.Storage, operator string, account string, useSigningKey string) (nkeys.KeyPair, string, error) {
+	accountNkey, err := readAccountNkey(ctx, storage, NkeyParameters{
+		Operator: operator,
+		Account:  account,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read account nkey: %s", err)
+	}
+	if accountNkey == nil {
+		return nil, "", nil
+	}
+	accountKeyPair, err := nkeys.FromSeed(accountNkey.Seed)
+	if err != nil {
+		return nil, "", err
+	}
+	accountPublicKey, err := accountKeyPair.PublicKey()
+	if err != nil {
+		return nil, "", err
+	}
+	if useSigningKey == "" {
+		return accountKeyPair, accountPublicKey, nil
+	}
+
+	signingNkey, err := readAccountSigningNkey(ctx, storage, NkeyParameters{
+		Operator: operator,
+		Account:  account,
+		Signing:  useSigningKey,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read signing nkey: %s", err)
+	}
+	if signingNkey == nil {
+		log.Error().
+			Str("operator", operator).Str("account", account).
+			Msgf("account signing nkey does not exist: %s - Cannot create jwt.", useSigningKey)
+		return nil, "", fmt.Errorf("account signing nkey does not exist: %s - Cannot create JWT", useSigningKey)
+	}
+	signingKeyPair, err := nkeys.FromSeed(signingNkey.Seed)
+	if err != nil {
+		return nil, "", err
+	}
+	return signingKeyPair, accountPublicKey, nil
+}
+
 func issueUserCreds(ctx context.Context, storage logical.Storage, issue IssueUserStorage) error {
 	// receive user nkey seed
 	// to add to creds file
@@ -618,3 +731,63 @@ func updateUserStatus(ctx context.Context, storage logical.Storage, issue *Issue
 		issue.Status.User.JWT = false
 	}
 }
+
+// applySigningKeyScope refuses user claims that set permissions or limits
+// when the user is signed by a scoped account signing key. Those users get
+// their permissions and limits from the template of the key, nats requires
+// them to be empty in the user jwt.
+// Nothing is done if the signing key is not scoped.
+func applySigningKeyScope(ctx context.Context, storage logical.Storage, operator string, account string, useSigningKey string, claims *jwt.UserClaims) error {
+	if useSigningKey == "" {
+		return nil
+	}
+	issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator: operator,
+		Account:  account,
+	})
+	if err != nil {
+		return fmt.Errorf("could not read account issue: %s", err)
+	}
+	if issue == nil {
+		return nil
+	}
+	scope := getAccountSigningKeyScope(&issue.Claims, useSigningKey)
+	if scope == nil {
+		return nil
+	}
+
+	fields := getUserPermissionLimitsFields(&claims.UserPermissionLimits)
+	if len(fields) > 0 {
+		return fmt.Errorf("users signed by scoped signing key %s must not set permissions or limits: %s", useSigningKey, strings.Join(fields, ", "))
+	}
+	claims.UserPermissionLimits = jwt.UserPermissionLimits{}
+	return nil
+}
+
+// getUserPermissionLimitsFields returns the names of the permissions
+// and limits that are set in the user claims
+func getUserPermissionLimitsFields(user *jwt.UserPermissionLimits) []string {
+	fields := []string{}
+	set := []struct {
+		name string
+		set  bool
+	}{
+		{"pub", !user.Pub.Empty()},
+		{"sub", !user.Sub.Empty()},
+		{"resp", user.Resp != nil},
+		{"src", len(user.Src) > 0},
+		{"times", len(user.Times) > 0},
+		{"timesLocation", user.Locale != ""},
+		{"subs", user.Subs != 0},
+		{"data", user.Data != 0},
+		{"payload", user.Payload != 0},
+		{"bearerToken", user.BearerToken},
+		{"allowedConnectionTypes", len(user.AllowedConnectionTypes) > 0},
+	}
+	for _, s := range set {
+		if s.set {
+			fields = append(fields, s.name)
+		}
+	}
+	return fields
+}
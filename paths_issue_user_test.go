@@ -10,6 +10,7 @@ import (
 
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
 	"github.com/stretchr/testify/assert"
 	"gonum.org/v1/gonum/stat/combin"
 
@@ -951,3 +952,166 @@ func Test_EverythingBeforeUser(t *testing.T) {
 		assert.False(t, resp.IsError())
 	})
 }
+
+func TestUserIssueScopedSigningKey(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"signingKeys": []interface{}{"sk1"},
+					"scopedSigningKeys": []interface{}{
+						map[string]interface{}{
+							"key":  "sk2",
+							"role": "restricted",
+							"template": map[string]interface{}{
+								"pub": map[string]interface{}{
+									"allow": []interface{}{"foo.>"},
+								},
+								"subs": 10,
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	// the scoped signing nkey is created and its public key is part of the account jwt
+	signingNkey, err := readAccountSigningNkey(context.Background(), reqStorage, NkeyParameters{
+		Operator: "op1",
+		Account:  "ac1",
+		Signing:  "sk2",
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, signingNkey)
+	signingKeyPair, err := nkeys.FromSeed(signingNkey.Seed)
+	assert.NoError(t, err)
+	signingPublicKey, err := signingKeyPair.PublicKey()
+	assert.NoError(t, err)
+
+	accountJWT, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{
+		Operator: "op1",
+		Account:  "ac1",
+	})
+	assert.NoError(t, err)
+	accountClaims, err := jwt.DecodeAccountClaims(accountJWT.JWT)
+	assert.NoError(t, err)
+	assert.Len(t, accountClaims.SigningKeys, 2)
+	scope, ok := accountClaims.SigningKeys.GetScope(signingPublicKey)
+	assert.True(t, ok)
+	userScope, ok := scope.(*jwt.UserScope)
+	assert.True(t, ok)
+	assert.Equal(t, "restricted", userScope.Role)
+	assert.Equal(t, jwt.StringList{"foo.>"}, userScope.Template.Pub.Allow)
+	assert.Equal(t, int64(10), userScope.Template.Subs)
+
+	// a user within the scope is signed without own permissions
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1/user/u1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"useSigningKey": "sk2",
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	userJWT, err := readUserJWT(context.Background(), reqStorage, JWTParameters{
+		Operator: "op1",
+		Account:  "ac1",
+		User:     "u1",
+	})
+	assert.NoError(t, err)
+	userClaims, err := jwt.DecodeUserClaims(userJWT.JWT)
+	assert.NoError(t, err)
+	assert.Equal(t, signingPublicKey, userClaims.Issuer)
+	assert.Equal(t, accountClaims.Subject, userClaims.IssuerAccount)
+	assert.True(t, userClaims.HasEmptyPermissions())
+	vr := jwt.CreateValidationResults()
+	accountClaims.Validate(vr)
+	assert.Empty(t, vr.Errors())
+	assert.NoError(t, userScope.ValidateScopedSigner(userClaims))
+
+	// users setting permissions or limits are refused,
+	// even if they are narrower than the scope
+	for _, tc := range []struct {
+		field string
+		user  map[string]interface{}
+	}{
+		{"pub", map[string]interface{}{"pub": map[string]interface{}{"allow": []interface{}{"bar"}}}},
+		{"pub", map[string]interface{}{"pub": map[string]interface{}{"allow": []interface{}{"foo.bar"}}}},
+		{"subs", map[string]interface{}{"subs": 100}},
+		{"subs", map[string]interface{}{"subs": 5}},
+		{"bearerToken", map[string]interface{}{"bearerToken": true}},
+		{"times", map[string]interface{}{"times": []interface{}{map[string]interface{}{"start": "08:00:00", "end": "17:00:00"}}}},
+		{"timesLocation", map[string]interface{}{"timesLocation": "Europe/Berlin"}},
+	} {
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "issue/operator/op1/account/ac1/user/u2",
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"useSigningKey": "sk2",
+				"claims": map[string]interface{}{
+					"user": tc.user,
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+		assert.EqualError(t, resp.Error(), AddingIssueFailedError+": users signed by scoped signing key sk2 must not set permissions or limits: "+tc.field)
+	}
+	user, err := readUserIssue(context.Background(), reqStorage, IssueUserParameters{
+		Operator: "op1",
+		Account:  "ac1",
+		User:     "u2",
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	// a user signed by the unscoped signing key keeps its permissions
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1/user/u3",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"useSigningKey": "sk1",
+			"claims": map[string]interface{}{
+				"user": map[string]interface{}{
+					"pub": map[string]interface{}{
+						"allow": []interface{}{"bar"},
+					},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	userJWT, err = readUserJWT(context.Background(), reqStorage, JWTParameters{
+		Operator: "op1",
+		Account:  "ac1",
+		User:     "u3",
+	})
+	assert.NoError(t, err)
+	userClaims, err = jwt.DecodeUserClaims(userJWT.JWT)
+	assert.NoError(t, err)
+	assert.Equal(t, jwt.StringList{"bar"}, userClaims.Pub.Allow)
+}
@@ -0,0 +1,219 @@
+package natsbackend
+
+import (
+	"context"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+)
+
+func pathAccountXKey(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "nkey/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/xkey/" + framework.GenericNameRegex("xkey") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier",
+					Required:    false,
+				},
+				"xkey": {
+					Type:        framework.TypeString,
+					Description: "xkey identifier",
+					Required:    false,
+				},
+				"seed": {
+					Type:        framework.TypeString,
+					Description: "Nkey seed - Base64 Encoded.",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathAddAccountXKey,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathAddAccountXKey,
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReadAccountXKey,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathDeleteAccountXKey,
+				},
+			},
+			HelpSynopsis:    `Manages account xkey (curve) Nkey keypairs.`,
+			HelpDescription: `On Create or Update: If no account xkey seed is passed, a corresponding curve Nkey is generated. Xkeys encrypt the authorization callout requests of the account.`,
+		},
+		{
+			Pattern: "nkey/operator/" + framework.GenericNameRegex("operator") + "/account/" + framework.GenericNameRegex("account") + "/xkey/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathListAccountXKeys,
+				},
+			},
+			HelpSynopsis:    "pathRoleListHelpSynopsis",
+			HelpDescription: "pathRoleListHelpDescription",
+		},
+	}
+}
+
+func (b *NatsBackend) pathAddAccountXKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params NkeyParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	err = addAccountXKey(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse("%s: %s", AddingNkeyFailedError, err.Error()), nil
+	}
+
+	err = refreshAuthCalloutAccount(ctx, req.Storage, params.Operator, params.Account, "", params.XKey)
+	if err != nil {
+		return logical.ErrorResponse("%s: %s", AddingNkeyFailedError, err.Error()), nil
+	}
+	return nil, nil
+}
+
+func (b *NatsBackend) pathReadAccountXKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params NkeyParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	nkey, err := readAccountXKey(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(ReadingNkeyFailedError), nil
+	}
+
+	if nkey == nil {
+		return logical.ErrorResponse(NkeyNotFoundError), nil
+	}
+
+	return createResponseNkeyData(nkey)
+}
+
+func (b *NatsBackend) pathListAccountXKeys(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params NkeyParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	entries, err := listAccountXKeys(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(ListNkeysFailedError), nil
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *NatsBackend) pathDeleteAccountXKey(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params NkeyParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	// when a key is given, store it
+	err = deleteAccountXKey(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(DeleteNkeyFailedError), nil
+	}
+
+	// an account with an auth callout must no longer publish the deleted key
+	err = refreshAuthCalloutAccount(ctx, req.Storage, params.Operator, params.Account, "", params.XKey)
+	if err != nil {
+		return logical.ErrorResponse(DeleteNkeyFailedError), nil
+	}
+	return nil, nil
+}
+
+func readAccountXKey(ctx context.Context, storage logical.Storage, params NkeyParameters) (*NKeyStorage, error) {
+	path := getAccountXKeyPath(params.Operator, params.Account, params.XKey)
+	return readNkey(ctx, storage, path)
+}
+
+func deleteAccountXKey(ctx context.Context, storage logical.Storage, params NkeyParameters) error {
+	path := getAccountXKeyPath(params.Operator, params.Account, params.XKey)
+	return deleteNkey(ctx, storage, path)
+}
+
+func addAccountXKey(ctx context.Context, storage logical.Storage, params NkeyParameters) error {
+	log.Info().
+		Str("operator", params.Operator).Str("account", params.Account).Str("xkey", params.XKey).
+		Msg("create/update account xkey")
+
+	path := getAccountXKeyPath(params.Operator, params.Account, params.XKey)
+	err := addNkey(ctx, storage, path, nkeys.PrefixByteCurve, params, "curve")
+	if err != nil {
+		return err
+	}
+
+	iParams := IssueAccountParameters{
+		Operator: params.Operator,
+		Account:  params.Account,
+	}
+
+	issue, err := readAccountIssue(ctx, storage, iParams)
+	if err != nil {
+		return err
+	}
+	if issue == nil {
+		//ignore error, try to create issue
+		addAccountIssue(ctx, storage, iParams)
+	}
+	return nil
+}
+
+func listAccountXKeys(ctx context.Context, storage logical.Storage, params NkeyParameters) ([]string, error) {
+	path := getAccountXKeyPath(params.Operator, params.Account, "")
+	return listNkeys(ctx, storage, path)
+}
+
+func getAccountXKeyPath(operator string, account string, xkey string) string {
+	return "nkey/operator/" + operator + "/account/" + account + "/xkey/" + xkey
+}
@@ -95,6 +95,11 @@ func (b *NatsBackend) pathAddUserNkey(ctx context.Context, req *logical.Request,
 	if err != nil {
 		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingNkeyFailedError, err.Error())), nil
 	}
+
+	err = refreshAuthCalloutAccount(ctx, req.Storage, params.Operator, params.Account, params.User, "")
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingNkeyFailedError, err.Error())), nil
+	}
 	return nil, nil
 }
 
@@ -159,6 +164,12 @@ func (b *NatsBackend) pathDeleteUserNkey(ctx context.Context, req *logical.Reque
 	if err != nil {
 		return logical.ErrorResponse(DeleteNkeyFailedError), nil
 	}
+
+	// an account with an auth callout must no longer publish the deleted key
+	err = refreshAuthCalloutAccount(ctx, req.Storage, params.Operator, params.Account, params.User, "")
+	if err != nil {
+		return logical.ErrorResponse(DeleteNkeyFailedError), nil
+	}
 	return nil, nil
 }
 
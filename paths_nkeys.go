@@ -24,6 +24,7 @@ type NkeyParameters struct {
 	Account  string `json:"account,omitempty"`
 	Signing  string `json:"signing,omitempty"`
 	User     string `json:"user,omitempty"`
+	XKey     string `json:"xkey,omitempty"`
 	Seed     string `json:"seed,omitempty"`
 }
 
@@ -42,6 +43,7 @@ func pathNkey(b *NatsBackend) []*framework.Path {
 	paths = append(paths, pathOperatorSigningNkey(b)...)
 	paths = append(paths, pathAccountNkey(b)...)
 	paths = append(paths, pathAccountSigningNkey(b)...)
+	paths = append(paths, pathAccountXKey(b)...)
 	paths = append(paths, pathUserNkey(b)...)
 	return paths
 }
@@ -72,6 +74,8 @@ func validateSeed(seed []byte, kind string) error {
 		expected = nkeys.PrefixByteAccount
 	case "user":
 		expected = nkeys.PrefixByteUser
+	case "curve":
+		expected = nkeys.PrefixByteCurve
 	default:
 		expected = nkeys.PrefixByteUnknown
 	}
@@ -0,0 +1,275 @@
+package natsbackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/rs/zerolog/log"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+// RoleStorage represents a role stored in the backend
+type RoleStorage struct {
+	Role          string              `json:"role"`
+	Operator      string              `json:"operator"`
+	Account       string              `json:"account"`
+	UseSigningKey string              `json:"useSigningKey"`
+	Claims        v1alpha1.UserClaims `json:"claims"`
+	TTL           time.Duration       `json:"ttl"`
+	MaxTTL        time.Duration       `json:"maxTtl"`
+}
+
+// RoleParameters is the user facing interface for configuring a role.
+// Using pascal case on purpose.
+type RoleParameters struct {
+	Role          string              `json:"role"`
+	Operator      string              `json:"operator"`
+	Account       string              `json:"account"`
+	UseSigningKey string              `json:"useSigningKey,omitempty"`
+	Claims        v1alpha1.UserClaims `json:"claims,omitempty"`
+	TTL           time.Duration       `json:"-"`
+	MaxTTL        time.Duration       `json:"-"`
+}
+
+// RoleData represents the the data returned by a role operation
+type RoleData struct {
+	Role          string              `json:"role"`
+	Operator      string              `json:"operator"`
+	Account       string              `json:"account"`
+	UseSigningKey string              `json:"useSigningKey"`
+	Claims        v1alpha1.UserClaims `json:"claims"`
+	TTL           int64               `json:"ttl"`
+	MaxTTL        int64               `json:"maxTtl"`
+}
+
+func pathRole(b *NatsBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "role/" + framework.GenericNameRegex("role") + "$",
+			Fields: map[string]*framework.FieldSchema{
+				"role": {
+					Type:        framework.TypeString,
+					Description: "role identifier",
+					Required:    false,
+				},
+				"operator": {
+					Type:        framework.TypeString,
+					Description: "operator identifier",
+					Required:    false,
+				},
+				"account": {
+					Type:        framework.TypeString,
+					Description: "account identifier the users are issued in",
+					Required:    false,
+				},
+				"useSigningKey": {
+					Type:        framework.TypeString,
+					Description: "Account signing key identifier to sign the users",
+					Required:    false,
+				},
+				"claims": {
+					Type:        framework.TypeMap,
+					Description: "User claims template (jwt.UserClaims from github.com/nats-io/jwt/v2)",
+					Required:    false,
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Default lease for generated credentials. If not set or set to 0, will use system default.",
+					Required:    false,
+				},
+				"maxTtl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "Maximum time for generated credentials. The user JWT expires after this time. If not set or set to 0, will use system default.",
+					Required:    false,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.pathAddRole,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathAddRole,
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReadRole,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathDeleteRole,
+				},
+			},
+			HelpSynopsis:    `Manages roles for dynamic user credentials.`,
+			HelpDescription: `A role references an account issue and holds the user claims template that is used to generate leased user credentials with "creds/role/<role>".`,
+		},
+		{
+			Pattern: "role/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathListRoles,
+				},
+			},
+			HelpSynopsis:    "List roles.",
+			HelpDescription: "",
+		},
+	}
+}
+
+func (b *NatsBackend) pathAddRole(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	jsonString, err := json.Marshal(data.Raw)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+	params := RoleParameters{}
+	json.Unmarshal(jsonString, &params)
+	params.TTL = time.Duration(data.Get("ttl").(int)) * time.Second
+	params.MaxTTL = time.Duration(data.Get("maxTtl").(int)) * time.Second
+
+	err = addRole(ctx, req.Storage, params)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s: %s", AddingRoleFailedError, err.Error())), nil
+	}
+	return nil, nil
+}
+
+func (b *NatsBackend) pathReadRole(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params RoleParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	role, err := readRole(ctx, req.Storage, params.Role)
+	if err != nil {
+		return logical.ErrorResponse(ReadingRoleFailedError), nil
+	}
+
+	if role == nil {
+		return logical.ErrorResponse(RoleNotFoundError), nil
+	}
+
+	return createResponseRoleData(role)
+}
+
+func (b *NatsBackend) pathListRoles(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	entries, err := listRoles(ctx, req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(ListRolesFailedError), nil
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *NatsBackend) pathDeleteRole(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := data.Validate()
+	if err != nil {
+		return logical.ErrorResponse(InvalidParametersError), logical.ErrInvalidRequest
+	}
+
+	var params RoleParameters
+	err = stm.MapToStruct(data.Raw, &params)
+	if err != nil {
+		return logical.ErrorResponse(DecodeFailedError), logical.ErrInvalidRequest
+	}
+
+	// leases that are already handed out stay valid until
+	// they expire or are revoked
+	err = deleteRole(ctx, req.Storage, params.Role)
+	if err != nil {
+		return logical.ErrorResponse(DeleteRoleFailedError), nil
+	}
+	return nil, nil
+}
+
+func addRole(ctx context.Context, storage logical.Storage, params RoleParameters) error {
+	log.Info().
+		Str("role", params.Role).Str("operator", params.Operator).Str("account", params.Account).
+		Msg("create/update role")
+
+	if params.Operator == "" || params.Account == "" {
+		return fmt.Errorf("operator and account are required")
+	}
+	if params.MaxTTL != 0 && params.TTL > params.MaxTTL {
+		return fmt.Errorf("ttl cannot be greater than maxTtl")
+	}
+
+	// check if the user claims template can be converted
+	// to catch errors before credentials are requested
+	natsJwt, err := v1alpha1.Convert(&params.Claims)
+	if err != nil {
+		return fmt.Errorf("invalid claims: %s", err)
+	}
+	err = applySigningKeyScope(ctx, storage, params.Operator, params.Account, params.UseSigningKey, natsJwt)
+	if err != nil {
+		return err
+	}
+
+	role := &RoleStorage{
+		Role:          params.Role,
+		Operator:      params.Operator,
+		Account:       params.Account,
+		UseSigningKey: params.UseSigningKey,
+		Claims:        params.Claims,
+		TTL:           params.TTL,
+		MaxTTL:        params.MaxTTL,
+	}
+	return storeInStorage(ctx, storage, getRolePath(params.Role), role)
+}
+
+func readRole(ctx context.Context, storage logical.Storage, role string) (*RoleStorage, error) {
+	return getFromStorage[RoleStorage](ctx, storage, getRolePath(role))
+}
+
+func deleteRole(ctx context.Context, storage logical.Storage, role string) error {
+	return deleteFromStorage(ctx, storage, getRolePath(role))
+}
+
+func listRoles(ctx context.Context, storage logical.Storage) ([]string, error) {
+	return listIssues(ctx, storage, getRolePath(""))
+}
+
+func getRolePath(role string) string {
+	return "role/" + role
+}
+
+func createResponseRoleData(role *RoleStorage) (*logical.Response, error) {
+	data := &RoleData{
+		Role:          role.Role,
+		Operator:      role.Operator,
+		Account:       role.Account,
+		UseSigningKey: role.UseSigningKey,
+		Claims:        role.Claims,
+		TTL:           int64(role.TTL.Seconds()),
+		MaxTTL:        int64(role.MaxTTL.Seconds()),
+	}
+
+	rval := map[string]interface{}{}
+	err := stm.StructToMap(data, &rval)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: rval,
+	}
+	return resp, nil
+}
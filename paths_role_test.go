@@ -0,0 +1,157 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/common"
+	userv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+func TestCRUDRole(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	t.Run("Test CRUD for roles", func(t *testing.T) {
+
+		path := "role/r1"
+
+		// first call read/delete/list without creating the role
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      path,
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ListOperation,
+			Path:      "role/",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, resp.Data, map[string]interface{}{})
+
+		// a role needs an operator and an account
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      map[string]interface{}{},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+
+		// ttl must not exceed max ttl
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data: map[string]interface{}{
+				"operator": "op1",
+				"account":  "ac1",
+				"ttl":      "2h",
+				"maxTtl":   "1h",
+			},
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+
+		// then create the role and read it
+		var request map[string]interface{}
+		stm.StructToMap(&RoleParameters{
+			Operator: "op1",
+			Account:  "ac1",
+			Claims: userv1.UserClaims{
+				User: userv1.User{
+					UserPermissionLimits: userv1.UserPermissionLimits{
+						Permissions: common.Permissions{
+							Pub: common.Permission{
+								Allow: []string{"foo.>"},
+							},
+						},
+					},
+				},
+			},
+		}, &request)
+		request["ttl"] = "1h"
+		request["maxTtl"] = "24h"
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      request,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		var current RoleData
+		stm.MapToStruct(resp.Data, &current)
+		assert.Equal(t, RoleData{
+			Role:     "r1",
+			Operator: "op1",
+			Account:  "ac1",
+			Claims: userv1.UserClaims{
+				User: userv1.User{
+					UserPermissionLimits: userv1.UserPermissionLimits{
+						Permissions: common.Permissions{
+							Pub: common.Permission{
+								Allow: []string{"foo.>"},
+							},
+						},
+					},
+				},
+			},
+			TTL:    3600,
+			MaxTTL: 86400,
+		}, current)
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ListOperation,
+			Path:      "role/",
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, map[string]interface{}{"keys": []string{"r1"}}, resp.Data)
+
+		// then delete the role and try to read it
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      path,
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+			Storage:   reqStorage,
+		})
+		assert.NoError(t, err)
+		assert.True(t, resp.IsError())
+	})
+}
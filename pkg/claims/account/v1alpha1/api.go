@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/common"
+	userv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
 	"github.com/nats-io/jwt/v2"
 )
 
@@ -47,6 +48,10 @@ type Account struct {
 	// A list of signing keys the account can use
 	// +kubebuilder:validation:Optional
 	SigningKeys []string `json:"signingKeys,omitempty"`
+	// A list of signing keys the account can use that are restricted to a scope.
+	// Users signed with one of these keys get the permissions and limits of the scope's template.
+	// +kubebuilder:validation:Optional
+	ScopedSigningKeys []ScopedSigningKey `json:"scopedSigningKeys,omitempty"`
 	// Stores user JWTs that have been revoked and the time they were revoked
 	// +kubebuilder:validation:Optional
 	Revocations map[string]int64 `json:"revocations,omitempty"`
@@ -64,6 +69,19 @@ type Account struct {
 	common.GenericFields `json:",inline"`
 }
 
+// ScopedSigningKey is a signing key that can only sign users
+// with the permissions and limits of its template
+type ScopedSigningKey struct {
+	// The signing key to scope
+	Key string `json:"key"`
+	// The role name of the scope
+	// +kubebuilder:validation:Optional
+	Role string `json:"role,omitempty"`
+	// The permissions and limits users signed with this key get
+	// +kubebuilder:validation:Optional
+	Template userv1.UserPermissionLimits `json:"template,omitempty"`
+}
+
 // Enable external authorization for account users.
 type ExternalAuthorization struct {
 	AuthUsers       []string `json:"auth_users,omitempty"`
@@ -88,14 +106,14 @@ type OperatorLimits struct {
 	common.NatsLimits `json:",inline"`
 	AccountLimits     `json:",inline"`
 	JetStreamLimits   `json:",inline"`
-	// JetStreamTieredLimits as far as i can tell it is only used by NATS internally.
-	// So not exposed to the user for now.
-	// JetStreamTieredLimits `json:"tieredLimits,omitempty"`
+	// JetStream limits per replication tier, e.g. "R1" and "R3".
+	// Mutually exclusive with the JetStream limits.
+	// +kubebuilder:validation:Optional
+	JetStreamTieredLimits JetStreamTieredLimits `json:"tieredLimits,omitempty"`
 }
 
-// JetStreamTieredLimits as far as i can tell it is only used by NATS internally.
-// So not exposed to the user for now.
-// type JetStreamTieredLimits map[string]JetStreamLimits
+// JetStreamTieredLimits maps the tier name to the JetStream limits of the tier
+type JetStreamTieredLimits map[string]JetStreamLimits
 
 // JetStreamLimits represents the Jetstream limits for an account
 type JetStreamLimits struct {
@@ -161,6 +179,17 @@ func convertExportType(t string) (jwt.ExportType, error) {
 	}
 }
 
+func convertExportTypeFrom(t jwt.ExportType) string {
+	switch t {
+	case jwt.Stream:
+		return "Stream"
+	case jwt.Service:
+		return "Service"
+	default:
+		return "Unknown"
+	}
+}
+
 // Import describes a mapping from another account into this one
 type Import struct {
 	// The name of the import
@@ -175,6 +204,10 @@ type Import struct {
 	// The token to use for the import
 	// +kubebuilder:validation:Optional
 	Token string `json:"token,omitempty"`
+	// The name of an activation issued by the exporting account.
+	// Its token is filled in when the account JWT is issued.
+	// +kubebuilder:validation:Optional
+	Activation string `json:"activation,omitempty"`
 	// The local subject to import to
 	// +kubebuilder:validation:Optional
 	LocalSubject string `json:"localSubject,omitempty"`
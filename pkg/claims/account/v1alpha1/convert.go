@@ -1,9 +1,12 @@
 package v1alpha1
 
 import (
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/common"
+	userv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
 	"github.com/nats-io/jwt/v2"
 )
 
@@ -71,7 +74,20 @@ func convertExports(in *Account, out *jwt.Account) error {
 	return nil
 }
 
-func convertLimits(in *Account, out *jwt.Account) {
+func convertJetStreamLimits(in *JetStreamLimits) jwt.JetStreamLimits {
+	return jwt.JetStreamLimits{
+		MemoryStorage:        in.MemoryStorage,
+		DiskStorage:          in.DiskStorage,
+		Streams:              in.Streams,
+		Consumer:             in.Consumer,
+		MaxAckPending:        in.MaxAckPending,
+		MemoryMaxStreamBytes: in.MemoryMaxStreamBytes,
+		DiskMaxStreamBytes:   in.DiskMaxStreamBytes,
+		MaxBytesRequired:     in.MaxBytesRequired,
+	}
+}
+
+func convertLimits(in *Account, out *jwt.Account) error {
 	out.Limits = jwt.OperatorLimits{
 		NatsLimits: jwt.NatsLimits{
 			Subs:    in.Limits.NatsLimits.Subs,
@@ -86,17 +102,22 @@ func convertLimits(in *Account, out *jwt.Account) {
 			Conn:            in.Limits.AccountLimits.Conn,
 			LeafNodeConn:    in.Limits.AccountLimits.LeafNodeConn,
 		},
-		JetStreamLimits: jwt.JetStreamLimits{
-			MemoryStorage:        in.Limits.JetStreamLimits.MemoryStorage,
-			DiskStorage:          in.Limits.JetStreamLimits.DiskStorage,
-			Streams:              in.Limits.JetStreamLimits.Streams,
-			Consumer:             in.Limits.JetStreamLimits.Consumer,
-			MaxAckPending:        in.Limits.JetStreamLimits.MaxAckPending,
-			MemoryMaxStreamBytes: in.Limits.JetStreamLimits.MemoryMaxStreamBytes,
-			DiskMaxStreamBytes:   in.Limits.JetStreamLimits.DiskMaxStreamBytes,
-			MaxBytesRequired:     in.Limits.JetStreamLimits.MaxBytesRequired,
-		},
+		JetStreamLimits: convertJetStreamLimits(&in.Limits.JetStreamLimits),
+	}
+	if len(in.Limits.JetStreamTieredLimits) == 0 {
+		return nil
+	}
+	if in.Limits.JetStreamLimits != (JetStreamLimits{}) {
+		return fmt.Errorf("tiered JetStream limits and JetStream limits are mutually exclusive")
+	}
+	out.Limits.JetStreamTieredLimits = make(jwt.JetStreamTieredLimits, len(in.Limits.JetStreamTieredLimits))
+	for tier, limits := range in.Limits.JetStreamTieredLimits {
+		if tier == "" {
+			return fmt.Errorf("tiered JetStream limits must not contain an empty tier name")
+		}
+		out.Limits.JetStreamTieredLimits[tier] = convertJetStreamLimits(&limits)
 	}
+	return nil
 }
 
 func convertSigningKeyKind(kind string) jwt.ScopeType {
@@ -107,12 +128,24 @@ func convertSigningKeyKind(kind string) jwt.ScopeType {
 	return jwt.UserScopeType
 }
 
-func convertSigningKeys(in *Account, out *jwt.Account) {
-	if in.SigningKeys == nil {
-		return
+func convertSigningKeys(in *Account, out *jwt.Account) error {
+	if in.SigningKeys == nil && in.ScopedSigningKeys == nil {
+		return nil
 	}
-	out.SigningKeys = make(map[string]jwt.Scope, len(in.SigningKeys))
+	out.SigningKeys = make(map[string]jwt.Scope, len(in.SigningKeys)+len(in.ScopedSigningKeys))
 	out.SigningKeys.Add(in.SigningKeys...)
+	for _, e := range in.ScopedSigningKeys {
+		scope := jwt.NewUserScope()
+		scope.Key = e.Key
+		scope.Role = e.Role
+		template, err := userv1.ConvertUserPermissionLimits(&e.Template)
+		if err != nil {
+			return fmt.Errorf("invalid template for scoped signing key %s: %s", e.Key, err)
+		}
+		scope.Template = template
+		out.SigningKeys.AddScopedSigner(scope)
+	}
+	return nil
 }
 
 func convertRevocations(in *Account, out *jwt.Account) {
@@ -125,7 +158,7 @@ func convertRevocations(in *Account, out *jwt.Account) {
 	}
 }
 
-func convertDefaultPermissions(in *Account, out *jwt.Account) {
+func convertDefaultPermissions(in *Account, out *jwt.Account) error {
 	out.DefaultPermissions = jwt.Permissions{
 		Pub: jwt.Permission{
 			Allow: jwt.StringList(in.DefaultPermissions.Pub.Allow),
@@ -143,11 +176,12 @@ func convertDefaultPermissions(in *Account, out *jwt.Account) {
 		if in.DefaultPermissions.Resp.Expires != "" {
 			dur, err := time.ParseDuration(in.DefaultPermissions.Resp.Expires)
 			if err != nil {
-				return
+				return fmt.Errorf("invalid default permissions: %s", err)
 			}
 			out.DefaultPermissions.Resp.Expires = dur
 		}
 	}
+	return nil
 }
 
 func convertMappings(in *Account, out *jwt.Account) {
@@ -200,13 +234,221 @@ func Convert(claims *AccountClaims) (*jwt.AccountClaims, error) {
 	if err != nil {
 		return nil, err
 	}
-	convertLimits(&claims.Account, &nats.Account)
-	convertSigningKeys(&claims.Account, &nats.Account)
+	err = convertLimits(&claims.Account, &nats.Account)
+	if err != nil {
+		return nil, err
+	}
+	err = convertSigningKeys(&claims.Account, &nats.Account)
+	if err != nil {
+		return nil, err
+	}
 	convertRevocations(&claims.Account, &nats.Account)
-	convertDefaultPermissions(&claims.Account, &nats.Account)
+	err = convertDefaultPermissions(&claims.Account, &nats.Account)
+	if err != nil {
+		return nil, err
+	}
 	convertMappings(&claims.Account, &nats.Account)
 	convertAuthorization(&claims.Account, &nats.Account)
 	nats.ClaimsData = common.ConvertClaimsData(&claims.ClaimsData)
 	nats.GenericFields = common.ConvertGenericFields(&claims.GenericFields)
 	return nats, nil
 }
+
+func convertImportsFrom(in *jwt.Account, out *Account) {
+	for _, e := range in.Imports {
+		out.Imports = append(out.Imports, Import{
+			Name:         e.Name,
+			Subject:      string(e.Subject),
+			Account:      e.Account,
+			Token:        e.Token,
+			LocalSubject: string(e.LocalSubject),
+			Type:         convertExportTypeFrom(e.Type),
+			Share:        e.Share,
+		})
+	}
+}
+
+func convertExportsFrom(in *jwt.Account, out *Account) {
+	for _, e := range in.Exports {
+		export := Export{
+			Name:                 e.Name,
+			Subject:              string(e.Subject),
+			Type:                 convertExportTypeFrom(e.Type),
+			TokenReq:             e.TokenReq,
+			ResponseType:         string(e.ResponseType),
+			AccountTokenPosition: e.AccountTokenPosition,
+			Advertise:            e.Advertise,
+			Info: common.Info{
+				Description: e.Info.Description,
+				InfoURL:     e.Info.InfoURL,
+			},
+		}
+		if e.Revocations != nil {
+			export.Revocations = make(map[string]int64, len(e.Revocations))
+			for k, v := range e.Revocations {
+				export.Revocations[k] = v
+			}
+		}
+		if e.Latency != nil {
+			export.Latency = &ServiceLatency{
+				Sampling: int(e.Latency.Sampling),
+				Results:  string(e.Latency.Results),
+			}
+		}
+		if e.ResponseThreshold != 0 {
+			export.ResponseThreshold = e.ResponseThreshold.String()
+		}
+		out.Exports = append(out.Exports, export)
+	}
+}
+
+func convertJetStreamLimitsFrom(in *jwt.JetStreamLimits) JetStreamLimits {
+	return JetStreamLimits{
+		MemoryStorage:        in.MemoryStorage,
+		DiskStorage:          in.DiskStorage,
+		Streams:              in.Streams,
+		Consumer:             in.Consumer,
+		MaxAckPending:        in.MaxAckPending,
+		MemoryMaxStreamBytes: in.MemoryMaxStreamBytes,
+		DiskMaxStreamBytes:   in.DiskMaxStreamBytes,
+		MaxBytesRequired:     in.MaxBytesRequired,
+	}
+}
+
+func convertLimitsFrom(in *jwt.Account, out *Account) {
+	out.Limits = OperatorLimits{
+		NatsLimits: common.NatsLimits{
+			Subs:    in.Limits.NatsLimits.Subs,
+			Data:    in.Limits.NatsLimits.Data,
+			Payload: in.Limits.NatsLimits.Payload,
+		},
+		AccountLimits: AccountLimits{
+			Imports:         in.Limits.AccountLimits.Imports,
+			Exports:         in.Limits.AccountLimits.Exports,
+			WildcardExports: in.Limits.AccountLimits.WildcardExports,
+			DisallowBearer:  in.Limits.AccountLimits.DisallowBearer,
+			Conn:            in.Limits.AccountLimits.Conn,
+			LeafNodeConn:    in.Limits.AccountLimits.LeafNodeConn,
+		},
+		JetStreamLimits: convertJetStreamLimitsFrom(&in.Limits.JetStreamLimits),
+	}
+	if len(in.Limits.JetStreamTieredLimits) == 0 {
+		return
+	}
+	out.Limits.JetStreamTieredLimits = make(JetStreamTieredLimits, len(in.Limits.JetStreamTieredLimits))
+	for tier, limits := range in.Limits.JetStreamTieredLimits {
+		out.Limits.JetStreamTieredLimits[tier] = convertJetStreamLimitsFrom(&limits)
+	}
+}
+
+// convertSigningKeysFrom splits the signing keys into plain and scoped ones.
+// Both are sorted by key as the signing keys of a JWT are unordered.
+func convertSigningKeysFrom(in *jwt.Account, out *Account) error {
+	keys := make([]string, 0, len(in.SigningKeys))
+	for k := range in.SigningKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		scope := in.SigningKeys[k]
+		if scope == nil {
+			out.SigningKeys = append(out.SigningKeys, k)
+			continue
+		}
+		userScope, ok := scope.(*jwt.UserScope)
+		if !ok {
+			return fmt.Errorf("unsupported scope %T for signing key %s", scope, k)
+		}
+		out.ScopedSigningKeys = append(out.ScopedSigningKeys, ScopedSigningKey{
+			Key:      k,
+			Role:     userScope.Role,
+			Template: userv1.ConvertUserPermissionLimitsFrom(&userScope.Template),
+		})
+	}
+	return nil
+}
+
+func convertRevocationsFrom(in *jwt.Account, out *Account) {
+	if in.Revocations == nil {
+		return
+	}
+	out.Revocations = make(map[string]int64, len(in.Revocations))
+	for k, v := range in.Revocations {
+		out.Revocations[k] = v
+	}
+}
+
+func convertDefaultPermissionsFrom(in *jwt.Account, out *Account) {
+	out.DefaultPermissions = common.Permissions{
+		Pub: common.Permission{
+			Allow: []string(in.DefaultPermissions.Pub.Allow),
+			Deny:  []string(in.DefaultPermissions.Pub.Deny),
+		},
+		Sub: common.Permission{
+			Allow: []string(in.DefaultPermissions.Sub.Allow),
+			Deny:  []string(in.DefaultPermissions.Sub.Deny),
+		},
+	}
+	if in.DefaultPermissions.Resp != nil {
+		out.DefaultPermissions.Resp = &common.ResponsePermission{
+			MaxMsgs: in.DefaultPermissions.Resp.MaxMsgs,
+		}
+		if in.DefaultPermissions.Resp.Expires != 0 {
+			out.DefaultPermissions.Resp.Expires = in.DefaultPermissions.Resp.Expires.String()
+		}
+	}
+}
+
+func convertMappingsFrom(in *jwt.Account, out *Account) {
+	if in.Mappings == nil {
+		return
+	}
+	out.Mappings = make(map[string][]WeightedMapping, len(in.Mappings))
+	for k, v := range in.Mappings {
+		mappings := []WeightedMapping{}
+		for _, m := range v {
+			mappings = append(mappings, WeightedMapping{
+				Subject: string(m.Subject),
+				Weight:  m.Weight,
+				Cluster: m.Cluster,
+			})
+		}
+		out.Mappings[string(k)] = mappings
+	}
+}
+
+func convertAuthorizationFrom(in *jwt.Account, out *Account) {
+	out.Authorization = ExternalAuthorization{
+		AuthUsers:       []string(in.Authorization.AuthUsers),
+		AllowedAccounts: []string(in.Authorization.AllowedAccounts),
+		XKey:            in.Authorization.XKey,
+	}
+}
+
+// ConvertFrom converts decoded nats-jwt account claims back into AccountClaims.
+// Names of activations and accounts used by imports are not part of the JWT,
+// the imports reference the public keys of the exporting accounts.
+func ConvertFrom(nats *jwt.AccountClaims) (*AccountClaims, error) {
+	claims := &AccountClaims{
+		Account: Account{
+			Info: common.Info{
+				Description: nats.Description,
+				InfoURL:     nats.InfoURL,
+			},
+		},
+	}
+	convertImportsFrom(&nats.Account, &claims.Account)
+	convertExportsFrom(&nats.Account, &claims.Account)
+	convertLimitsFrom(&nats.Account, &claims.Account)
+	err := convertSigningKeysFrom(&nats.Account, &claims.Account)
+	if err != nil {
+		return nil, err
+	}
+	convertRevocationsFrom(&nats.Account, &claims.Account)
+	convertDefaultPermissionsFrom(&nats.Account, &claims.Account)
+	convertMappingsFrom(&nats.Account, &claims.Account)
+	convertAuthorizationFrom(&nats.Account, &claims.Account)
+	claims.ClaimsData = common.ConvertClaimsDataFrom(&nats.ClaimsData)
+	claims.GenericFields = common.ConvertGenericFieldsFrom(&nats.GenericFields)
+	return claims, nil
+}
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/common"
+	userv1 "github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/user/v1alpha1"
 )
 
 func TestConvert(t *testing.T) {
@@ -201,3 +203,345 @@ func TestConvert(t *testing.T) {
 	assert.Equal(nats.Authorization.AllowedAccounts[2], "*")
 	assert.Equal(nats.Authorization.XKey, "myxkey")
 }
+
+func TestConvertScopedSigningKeys(t *testing.T) {
+	assert := assert.New(t)
+	claims := AccountClaims{
+		Account: Account{
+			SigningKeys: []string{"plainkey"},
+			ScopedSigningKeys: []ScopedSigningKey{
+				{
+					Key:  "scopedkey",
+					Role: "myrole",
+					Template: userv1.UserPermissionLimits{
+						Permissions: common.Permissions{
+							Pub: common.Permission{
+								Allow: []string{"foo.>"},
+							},
+						},
+						BearerToken: true,
+					},
+				},
+			},
+		},
+	}
+
+	nats, err := Convert(&claims)
+	assert.NoError(err)
+	assert.Len(nats.SigningKeys, 2)
+
+	scope, ok := nats.SigningKeys.GetScope("plainkey")
+	assert.True(ok)
+	assert.Nil(scope)
+
+	scope, ok = nats.SigningKeys.GetScope("scopedkey")
+	assert.True(ok)
+	userScope, ok := scope.(*jwt.UserScope)
+	assert.True(ok)
+	assert.Equal("scopedkey", userScope.Key)
+	assert.Equal("myrole", userScope.Role)
+	assert.Equal(jwt.StringList{"foo.>"}, userScope.Template.Pub.Allow)
+	assert.True(userScope.Template.BearerToken)
+
+	claims.ScopedSigningKeys[0].Template.AllowedConnectionTypes = []string{"INVALID"}
+	_, err = Convert(&claims)
+	assert.Error(err)
+}
+
+func TestConvertTieredLimits(t *testing.T) {
+	assert := assert.New(t)
+	claims := AccountClaims{
+		Account: Account{
+			Limits: OperatorLimits{
+				JetStreamTieredLimits: JetStreamTieredLimits{
+					"R1": {DiskStorage: 1024, Streams: 10},
+					"R3": {DiskStorage: 512, Streams: -1},
+				},
+			},
+		},
+	}
+	nats, err := Convert(&claims)
+	assert.NoError(err)
+	assert.Equal(jwt.JetStreamLimits{}, nats.Limits.JetStreamLimits)
+	assert.Equal(jwt.JetStreamTieredLimits{
+		"R1": {DiskStorage: 1024, Streams: 10},
+		"R3": {DiskStorage: 512, Streams: -1},
+	}, nats.Limits.JetStreamTieredLimits)
+	assert.True(nats.Limits.IsJSEnabled())
+
+	vr := jwt.CreateValidationResults()
+	nats.Limits.Validate(vr)
+	assert.True(vr.IsEmpty())
+
+	// the deep copy does not share the tiers
+	copied := claims.DeepCopy()
+	copied.Limits.JetStreamTieredLimits["R1"] = JetStreamLimits{}
+	assert.Equal(int64(1024), claims.Limits.JetStreamTieredLimits["R1"].DiskStorage)
+
+	// empty tier names are refused
+	claims.Limits.JetStreamTieredLimits[""] = JetStreamLimits{DiskStorage: 1}
+	_, err = Convert(&claims)
+	assert.Error(err)
+	delete(claims.Limits.JetStreamTieredLimits, "")
+
+	// tiered and flat limits are mutually exclusive
+	claims.Limits.JetStreamLimits.DiskStorage = 1024
+	_, err = Convert(&claims)
+	assert.Error(err)
+}
+
+func TestConvertDefaultPermissions(t *testing.T) {
+	assert := assert.New(t)
+	claims := AccountClaims{
+		Account: Account{
+			DefaultPermissions: common.Permissions{
+				Resp: &common.ResponsePermission{
+					MaxMsgs: 1,
+					Expires: "1s",
+				},
+			},
+		},
+	}
+	nats, err := Convert(&claims)
+	assert.NoError(err)
+	assert.Equal(time.Second, nats.DefaultPermissions.Resp.Expires)
+
+	// invalid durations are not swallowed
+	claims.DefaultPermissions.Resp.Expires = "soon"
+	_, err = Convert(&claims)
+	assert.Error(err)
+}
+
+// roundTrip converts the claims to nats-jwt, encodes them like they are in a JWT
+// and converts the decoded claims back
+func roundTrip(t *testing.T, claims *AccountClaims) *AccountClaims {
+	nats, err := Convert(claims)
+	assert.NoError(t, err)
+	encoded, err := json.Marshal(nats)
+	assert.NoError(t, err)
+	decoded := &jwt.AccountClaims{}
+	assert.NoError(t, json.Unmarshal(encoded, decoded))
+	converted, err := ConvertFrom(decoded)
+	assert.NoError(t, err)
+	return converted
+}
+
+func TestConvertFrom(t *testing.T) {
+	claims := &AccountClaims{
+		ClaimsData: common.ClaimsData{
+			Audience:  "audience",
+			Expires:   1675804600,
+			ID:        "id",
+			IssuedAt:  1675804500,
+			Issuer:    "issuer",
+			Name:      "name",
+			NotBefore: 1675804400,
+			Subject:   "subject",
+		},
+		Account: Account{
+			Imports: []Import{
+				{
+					Name:         "myimport",
+					Subject:      "mysubject",
+					Account:      "myaccount",
+					Token:        "token",
+					LocalSubject: "localsubject",
+					Type:         "Stream",
+					Share:        true,
+				},
+				{
+					Name:    "myservice",
+					Subject: "myservice",
+					Account: "myaccount",
+					Type:    "Service",
+				},
+			},
+			Exports: []Export{
+				{
+					Name:              "myexport",
+					Subject:           "mysubject",
+					Type:              "Service",
+					TokenReq:          true,
+					Revocations:       map[string]int64{"r1": 1675804527, "r2": 1675804526},
+					ResponseType:      "Stream",
+					ResponseThreshold: "3m0s",
+					Latency: &ServiceLatency{
+						Sampling: 100,
+						Results:  "results",
+					},
+					AccountTokenPosition: 5,
+					Advertise:            true,
+					Info: common.Info{
+						Description: "mydescription",
+						InfoURL:     "myurl",
+					},
+				},
+				{
+					Name:    "mystream",
+					Subject: "mystream.>",
+					Type:    "Stream",
+				},
+			},
+			Limits: OperatorLimits{
+				NatsLimits: common.NatsLimits{
+					Subs:    1,
+					Data:    2,
+					Payload: 3,
+				},
+				AccountLimits: AccountLimits{
+					Imports:         4,
+					Exports:         5,
+					WildcardExports: true,
+					DisallowBearer:  true,
+					Conn:            6,
+					LeafNodeConn:    7,
+				},
+				JetStreamLimits: JetStreamLimits{
+					MemoryStorage:        8,
+					DiskStorage:          9,
+					Streams:              10,
+					Consumer:             11,
+					MaxAckPending:        12,
+					MemoryMaxStreamBytes: 13,
+					DiskMaxStreamBytes:   14,
+					MaxBytesRequired:     true,
+				},
+			},
+			SigningKeys: []string{"plainkey1", "plainkey2"},
+			ScopedSigningKeys: []ScopedSigningKey{
+				{
+					Key:  "scopedkey",
+					Role: "myrole",
+					Template: userv1.UserPermissionLimits{
+						Permissions: common.Permissions{
+							Pub: common.Permission{
+								Allow: []string{"foo.>"},
+								Deny:  []string{"bar.>"},
+							},
+							Sub: common.Permission{
+								Allow: []string{"baz.>"},
+							},
+							Resp: &common.ResponsePermission{
+								MaxMsgs: 1,
+								Expires: "1s",
+							},
+						},
+						Limits: userv1.Limits{
+							UserLimits: userv1.UserLimits{
+								Src: []string{"192.168.1.0/24"},
+								Times: []userv1.TimeRange{
+									{
+										Start: "01:15:00",
+										End:   "03:15:00",
+									},
+								},
+								Locale: "Europe/Berlin",
+							},
+							NatsLimits: common.NatsLimits{
+								Subs:    1,
+								Data:    2,
+								Payload: 3,
+							},
+						},
+						BearerToken:            true,
+						AllowedConnectionTypes: []string{"STANDARD"},
+					},
+				},
+			},
+			Revocations: map[string]int64{"r3": 1675804525, "r4": 1675804524},
+			DefaultPermissions: common.Permissions{
+				Pub: common.Permission{
+					Allow: []string{"pub1", "pub2"},
+					Deny:  []string{"pub3", "pub4"},
+				},
+				Sub: common.Permission{
+					Allow: []string{"sub5", "sub6"},
+					Deny:  []string{"sub7", "sub8"},
+				},
+				Resp: &common.ResponsePermission{
+					MaxMsgs: 100,
+					Expires: "5m0s",
+				},
+			},
+			Mappings: map[string][]WeightedMapping{
+				"mapping1": {
+					{
+						Weight:  1,
+						Subject: "mysubject1",
+						Cluster: "mycluster1",
+					},
+					{
+						Weight:  2,
+						Subject: "mysubject2",
+						Cluster: "mycluster2",
+					},
+				},
+				"mapping2": {
+					{
+						Weight:  10,
+						Subject: "mysubject10",
+					},
+				},
+			},
+			Authorization: ExternalAuthorization{
+				AuthUsers:       []string{"myauthuser1", "myauthuser2"},
+				AllowedAccounts: []string{"myacct10", "myacct20", "*"},
+				XKey:            "myxkey",
+			},
+			Info: common.Info{
+				Description: "mydescription",
+				InfoURL:     "myurl",
+			},
+			GenericFields: common.GenericFields{
+				Tags:    []string{"tag1", "tag2"},
+				Type:    "account",
+				Version: 2,
+			},
+		},
+	}
+	assert.Equal(t, claims, roundTrip(t, claims))
+
+	t.Run("Test tiered limits", func(t *testing.T) {
+		claims := &AccountClaims{
+			Account: Account{
+				Limits: OperatorLimits{
+					NatsLimits: common.NatsLimits{
+						Subs: -1,
+					},
+					JetStreamTieredLimits: JetStreamTieredLimits{
+						"R1": {DiskStorage: 1024, Streams: 10},
+						"R3": {DiskStorage: 512, Streams: -1, MaxBytesRequired: true},
+					},
+				},
+			},
+		}
+		assert.Equal(t, claims, roundTrip(t, claims))
+	})
+
+	t.Run("Test unknown export type", func(t *testing.T) {
+		claims := &AccountClaims{
+			Account: Account{
+				Exports: []Export{
+					{
+						Subject: "mysubject",
+						Type:    "Unknown",
+					},
+				},
+			},
+		}
+		assert.Equal(t, claims, roundTrip(t, claims))
+	})
+
+	t.Run("Test default permissions without ttl", func(t *testing.T) {
+		claims := &AccountClaims{
+			Account: Account{
+				DefaultPermissions: common.Permissions{
+					Resp: &common.ResponsePermission{
+						MaxMsgs: 1,
+					},
+				},
+			},
+		}
+		assert.Equal(t, claims, roundTrip(t, claims))
+	})
+}
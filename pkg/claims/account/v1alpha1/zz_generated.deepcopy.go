@@ -38,12 +38,19 @@ func (in *Account) DeepCopyInto(out *Account) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
-	out.Limits = in.Limits
+	in.Limits.DeepCopyInto(&out.Limits)
 	if in.SigningKeys != nil {
 		in, out := &in.SigningKeys, &out.SigningKeys
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ScopedSigningKeys != nil {
+		in, out := &in.ScopedSigningKeys, &out.ScopedSigningKeys
+		*out = make([]ScopedSigningKey, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Revocations != nil {
 		in, out := &in.Revocations, &out.Revocations
 		*out = make(map[string]int64, len(*in))
@@ -197,12 +204,40 @@ func (in *JetStreamLimits) DeepCopy() *JetStreamLimits {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in JetStreamTieredLimits) DeepCopyInto(out *JetStreamTieredLimits) {
+	{
+		in := &in
+		*out = make(JetStreamTieredLimits, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JetStreamTieredLimits.
+func (in JetStreamTieredLimits) DeepCopy() JetStreamTieredLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(JetStreamTieredLimits)
+	in.DeepCopyInto(out)
+	return *out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OperatorLimits) DeepCopyInto(out *OperatorLimits) {
 	*out = *in
 	out.NatsLimits = in.NatsLimits
 	out.AccountLimits = in.AccountLimits
 	out.JetStreamLimits = in.JetStreamLimits
+	if in.JetStreamTieredLimits != nil {
+		in, out := &in.JetStreamTieredLimits, &out.JetStreamTieredLimits
+		*out = make(JetStreamTieredLimits, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OperatorLimits.
@@ -215,6 +250,22 @@ func (in *OperatorLimits) DeepCopy() *OperatorLimits {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScopedSigningKey) DeepCopyInto(out *ScopedSigningKey) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScopedSigningKey.
+func (in *ScopedSigningKey) DeepCopy() *ScopedSigningKey {
+	if in == nil {
+		return nil
+	}
+	out := new(ScopedSigningKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceLatency) DeepCopyInto(out *ServiceLatency) {
 	*out = *in
@@ -22,3 +22,24 @@ func ConvertClaimsData(in *ClaimsData) jwt.ClaimsData {
 		Subject:   in.Subject,
 	}
 }
+
+func ConvertGenericFieldsFrom(in *jwt.GenericFields) GenericFields {
+	return GenericFields{
+		Tags:    []string(in.Tags),
+		Type:    string(in.Type),
+		Version: in.Version,
+	}
+}
+
+func ConvertClaimsDataFrom(in *jwt.ClaimsData) ClaimsData {
+	return ClaimsData{
+		Audience:  in.Audience,
+		Expires:   in.Expires,
+		ID:        in.ID,
+		IssuedAt:  in.IssuedAt,
+		Issuer:    in.Issuer,
+		Name:      in.Name,
+		NotBefore: in.NotBefore,
+		Subject:   in.Subject,
+	}
+}
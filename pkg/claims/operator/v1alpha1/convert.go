@@ -21,3 +21,20 @@ func Convert(claims *OperatorClaims) *jwt.OperatorClaims {
 	nats.GenericFields = common.ConvertGenericFields(&claims.GenericFields)
 	return nats
 }
+
+// ConvertFrom converts decoded nats-jwt operator claims back into OperatorClaims
+func ConvertFrom(nats *jwt.OperatorClaims) *OperatorClaims {
+	claims := &OperatorClaims{
+		Operator: Operator{
+			SigningKeys:           []string(nats.SigningKeys),
+			AccountServerURL:      nats.AccountServerURL,
+			OperatorServiceURLs:   []string(nats.OperatorServiceURLs),
+			SystemAccount:         nats.SystemAccount,
+			AssertServerVersion:   nats.AssertServerVersion,
+			StrictSigningKeyUsage: nats.StrictSigningKeyUsage,
+		},
+	}
+	claims.ClaimsData = common.ConvertClaimsDataFrom(&nats.ClaimsData)
+	claims.GenericFields = common.ConvertGenericFieldsFrom(&nats.GenericFields)
+	return claims
+}
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/claims/common"
@@ -37,3 +38,38 @@ func TestConvert(t *testing.T) {
 	assert.Equal(nats.GenericFields.Type, jwt.ClaimType("claimtype"))
 	assert.Equal(nats.GenericFields.Version, int(100))
 }
+
+func TestConvertFrom(t *testing.T) {
+	assert := assert.New(t)
+	claims := &OperatorClaims{
+		ClaimsData: common.ClaimsData{
+			Audience:  "audience",
+			Expires:   1675804600,
+			ID:        "id",
+			IssuedAt:  1675804500,
+			Issuer:    "issuer",
+			Name:      "name",
+			NotBefore: 1675804400,
+			Subject:   "subject",
+		},
+		Operator: Operator{
+			SigningKeys:           []string{"sk1", "sk2"},
+			AccountServerURL:      "nats://localhost:4222",
+			OperatorServiceURLs:   []string{"tls://host:port"},
+			SystemAccount:         "systemaccount",
+			AssertServerVersion:   "serverversion",
+			StrictSigningKeyUsage: true,
+			GenericFields: common.GenericFields{
+				Tags:    []string{"tag1", "tag2"},
+				Type:    "operator",
+				Version: 2,
+			},
+		},
+	}
+
+	encoded, err := json.Marshal(Convert(claims))
+	assert.NoError(err)
+	decoded := &jwt.OperatorClaims{}
+	assert.NoError(json.Unmarshal(encoded, decoded))
+	assert.Equal(claims, ConvertFrom(decoded))
+}
@@ -35,11 +35,13 @@ func convertUserPermissionLimits(in *User, out *jwt.User) error {
 	if in.UserPermissionLimits.Resp != nil {
 		out.UserPermissionLimits.Resp = &jwt.ResponsePermission{}
 		out.UserPermissionLimits.Resp.MaxMsgs = in.UserPermissionLimits.Resp.MaxMsgs
-		dur, err := time.ParseDuration(in.UserPermissionLimits.Resp.Expires)
-		if err != nil {
-			return err
+		if in.UserPermissionLimits.Resp.Expires != "" {
+			dur, err := time.ParseDuration(in.UserPermissionLimits.Resp.Expires)
+			if err != nil {
+				return err
+			}
+			out.UserPermissionLimits.Resp.Expires = dur
 		}
-		out.UserPermissionLimits.Resp.Expires = dur
 	}
 	out.UserPermissionLimits.BearerToken = in.UserPermissionLimits.BearerToken
 	err := checkAllowedConnectionTypes(in.UserPermissionLimits.AllowedConnectionTypes)
@@ -67,6 +69,20 @@ func checkAllowedConnectionTypes(t []string) error {
 	return nil
 }
 
+// ConvertUserPermissionLimits converts permissions and limits on their own,
+// e.g. the template of a scoped signing key.
+func ConvertUserPermissionLimits(in *UserPermissionLimits) (jwt.UserPermissionLimits, error) {
+	user := &User{UserPermissionLimits: *in}
+	nats := &jwt.User{}
+	err := convertUserPermissionLimits(user, nats)
+	if err != nil {
+		return jwt.UserPermissionLimits{}, err
+	}
+	convertUserLimits(user, nats)
+	convertNatsLimits(user, nats)
+	return nats.UserPermissionLimits, nil
+}
+
 func Convert(claims *UserClaims) (*jwt.UserClaims, error) {
 	nats := &jwt.UserClaims{
 		User: jwt.User{
@@ -83,3 +99,63 @@ func Convert(claims *UserClaims) (*jwt.UserClaims, error) {
 	nats.GenericFields = common.ConvertGenericFields(&claims.GenericFields)
 	return nats, nil
 }
+
+func convertNatsLimitsFrom(in *jwt.User, out *User) {
+	out.NatsLimits.Data = in.NatsLimits.Data
+	out.NatsLimits.Payload = in.NatsLimits.Payload
+	out.NatsLimits.Subs = in.NatsLimits.Subs
+}
+
+func convertUserLimitsFrom(in *jwt.User, out *User) {
+	out.UserLimits.Locale = in.UserLimits.Locale
+	out.UserLimits.Src = []string(in.UserLimits.Src)
+	for _, e := range in.UserLimits.Times {
+		out.UserLimits.Times = append(out.UserLimits.Times, TimeRange{
+			Start: e.Start,
+			End:   e.End,
+		})
+	}
+}
+
+func convertUserPermissionLimitsFrom(in *jwt.User, out *User) {
+	out.UserPermissionLimits.Pub.Allow = []string(in.UserPermissionLimits.Pub.Allow)
+	out.UserPermissionLimits.Pub.Deny = []string(in.UserPermissionLimits.Pub.Deny)
+	out.UserPermissionLimits.Sub.Allow = []string(in.UserPermissionLimits.Sub.Allow)
+	out.UserPermissionLimits.Sub.Deny = []string(in.UserPermissionLimits.Sub.Deny)
+	if in.UserPermissionLimits.Resp != nil {
+		out.UserPermissionLimits.Resp = &common.ResponsePermission{
+			MaxMsgs: in.UserPermissionLimits.Resp.MaxMsgs,
+		}
+		if in.UserPermissionLimits.Resp.Expires != 0 {
+			out.UserPermissionLimits.Resp.Expires = in.UserPermissionLimits.Resp.Expires.String()
+		}
+	}
+	out.UserPermissionLimits.BearerToken = in.UserPermissionLimits.BearerToken
+	out.UserPermissionLimits.AllowedConnectionTypes = []string(in.UserPermissionLimits.AllowedConnectionTypes)
+}
+
+// ConvertUserPermissionLimitsFrom converts nats-jwt permissions and limits on their own,
+// e.g. the template of a scoped signing key.
+func ConvertUserPermissionLimitsFrom(in *jwt.UserPermissionLimits) UserPermissionLimits {
+	nats := &jwt.User{UserPermissionLimits: *in}
+	user := &User{}
+	convertUserPermissionLimitsFrom(nats, user)
+	convertUserLimitsFrom(nats, user)
+	convertNatsLimitsFrom(nats, user)
+	return user.UserPermissionLimits
+}
+
+// ConvertFrom converts decoded nats-jwt user claims back into UserClaims
+func ConvertFrom(nats *jwt.UserClaims) *UserClaims {
+	claims := &UserClaims{
+		User: User{
+			IssuerAccount: nats.IssuerAccount,
+		},
+	}
+	convertUserPermissionLimitsFrom(&nats.User, &claims.User)
+	convertUserLimitsFrom(&nats.User, &claims.User)
+	convertNatsLimitsFrom(&nats.User, &claims.User)
+	claims.ClaimsData = common.ConvertClaimsDataFrom(&nats.ClaimsData)
+	claims.GenericFields = common.ConvertGenericFieldsFrom(&nats.GenericFields)
+	return claims
+}
@@ -90,3 +90,108 @@ func TestConvert(t *testing.T) {
 	assert.Equal(nats.UserPermissionLimits.BearerToken, true)
 	assert.Equal(nats.UserPermissionLimits.AllowedConnectionTypes, jwt.StringList{"STANDARD", "WEBSOCKET"})
 }
+
+func TestConvertFrom(t *testing.T) {
+	assert := assert.New(t)
+	claims := &UserClaims{
+		ClaimsData: common.ClaimsData{
+			Audience:  "audience",
+			Expires:   1675804600,
+			ID:        "id",
+			IssuedAt:  1675804500,
+			Issuer:    "issuer",
+			Name:      "name",
+			NotBefore: 1675804400,
+			Subject:   "subject",
+		},
+		User: User{
+			UserPermissionLimits: UserPermissionLimits{
+				Permissions: common.Permissions{
+					Pub: common.Permission{
+						Allow: []string{"pub1", "pub2"},
+						Deny:  []string{"pub3", "pub4"},
+					},
+					Sub: common.Permission{
+						Allow: []string{"sub1", "sub2"},
+						Deny:  []string{"sub3", "sub4"},
+					},
+					Resp: &common.ResponsePermission{
+						MaxMsgs: 100,
+						Expires: "5m0s",
+					},
+				},
+				Limits: Limits{
+					UserLimits: UserLimits{
+						Src: []string{"192.168.1.0/24", "2001:db8:a0b:12f0::1/32"},
+						Times: []TimeRange{
+							{
+								Start: "01:15:00",
+								End:   "03:15:00",
+							},
+							{
+								Start: "06:15:00",
+								End:   "09:15:00",
+							},
+						},
+						Locale: "Europe/Berlin",
+					},
+					NatsLimits: common.NatsLimits{
+						Subs:    1,
+						Data:    2,
+						Payload: 3,
+					},
+				},
+				BearerToken:            true,
+				AllowedConnectionTypes: []string{"STANDARD", "WEBSOCKET"},
+			},
+			IssuerAccount: "issueraccount",
+			GenericFields: common.GenericFields{
+				Tags:    []string{"tag1", "tag2"},
+				Type:    "user",
+				Version: 2,
+			},
+		},
+	}
+
+	nats, err := Convert(claims)
+	assert.NoError(err)
+	encoded, err := json.Marshal(nats)
+	assert.NoError(err)
+	decoded := &jwt.UserClaims{}
+	assert.NoError(json.Unmarshal(encoded, decoded))
+	assert.Equal(claims, ConvertFrom(decoded))
+
+	// the template of a scoped signing key is converted on its own
+	limits, err := ConvertUserPermissionLimits(&claims.UserPermissionLimits)
+	assert.NoError(err)
+	assert.Equal(claims.UserPermissionLimits, ConvertUserPermissionLimitsFrom(&limits))
+}
+
+func TestConvertFromRespWithoutExpires(t *testing.T) {
+	assert := assert.New(t)
+
+	claims := &UserClaims{
+		User: User{
+			UserPermissionLimits: UserPermissionLimits{
+				Permissions: common.Permissions{
+					Resp: &common.ResponsePermission{
+						MaxMsgs: 1,
+					},
+				},
+			},
+		},
+	}
+
+	nats, err := Convert(claims)
+	assert.NoError(err)
+	assert.Equal(time.Duration(0), nats.UserPermissionLimits.Resp.Expires)
+	encoded, err := json.Marshal(nats)
+	assert.NoError(err)
+	decoded := &jwt.UserClaims{}
+	assert.NoError(json.Unmarshal(encoded, decoded))
+	assert.Equal(claims.UserPermissionLimits, ConvertFrom(decoded).UserPermissionLimits)
+
+	limits, err := ConvertUserPermissionLimits(&claims.UserPermissionLimits)
+	assert.NoError(err)
+	assert.Equal(claims.UserPermissionLimits, ConvertUserPermissionLimitsFrom(&limits))
+}
@@ -21,16 +21,32 @@ func (r *Resolver) CloseConnection() {
 
 func isNatsUrl(url string) bool {
 	url = strings.ToLower(strings.TrimSpace(url))
-	return strings.HasPrefix(url, "nats://") || strings.HasPrefix(url, ",nats://")
+	for _, scheme := range []string{"nats://", "tls://"} {
+		if strings.HasPrefix(url, scheme) || strings.HasPrefix(url, ","+scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHTTPURL returns true if the account server is reached via http or https
+func IsHTTPURL(url string) bool {
+	url = strings.ToLower(strings.TrimSpace(url))
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
 }
 
-func createConnection(url string, userJWT []byte, userKp nkeys.KeyPair) (*nats.Conn, error) {
+func createConnection(url string, userJWT []byte, userKp nkeys.KeyPair, tlsConfig *TLSConfig) (*nats.Conn, error) {
 	if !isValidURL(url) {
 		return nil, fmt.Errorf("invalid url: %s", url)
 	}
 
 	if !isNatsUrl(url) {
-		return nil, fmt.Errorf("invalid url: %s, currently only nats urls are supported", url)
+		return nil, fmt.Errorf("invalid url: %s, expected a nats or tls url", url)
+	}
+
+	tlsOpts, err := tlsConfig.Config()
+	if err != nil {
+		return nil, err
 	}
 
 	nats.NewInbox()
@@ -43,7 +59,11 @@ func createConnection(url string, userJWT []byte, userKp nkeys.KeyPair) (*nats.C
 			})
 	}
 
-	return nats.Connect(url, createDefaultToolOptions("nsc_push", getOpt(string(userJWT), userKp))...)
+	opts := []nats.Option{getOpt(string(userJWT), userKp)}
+	if tlsOpts != nil {
+		opts = append(opts, nats.Secure(tlsOpts))
+	}
+	return nats.Connect(url, createDefaultToolOptions("nsc_push", opts...)...)
 }
 
 func createDefaultToolOptions(name string, o ...nats.Option) []nats.Option {
@@ -53,10 +73,6 @@ func createDefaultToolOptions(name string, o ...nats.Option) []nats.Option {
 
 	opts := []nats.Option{nats.Name(name)}
 	opts = append(opts, nats.Timeout(connectTimeout))
-	// todo: add tls
-	// opts = append(opts, rootCAsNats)
-	// opts = append(opts, tlsKeyNats)
-	// opts = append(opts, tlsCertNats)
 	opts = append(opts, nats.ReconnectWait(reconnectDelay))
 	opts = append(opts, nats.MaxReconnects(int(totalWait/reconnectDelay)))
 	opts = append(opts, nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
@@ -92,7 +108,7 @@ func isValidURL(s string) bool {
 		return false
 	}
 	scheme := strings.ToLower(u.Scheme)
-	supported := []string{"http", "https", "nats"}
+	supported := []string{"http", "https", "nats", "tls"}
 
 	ok := false
 	for _, v := range supported {
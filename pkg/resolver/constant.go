@@ -3,4 +3,7 @@ package resolver
 const (
 	ClaimsUpdateSubject = "$SYS.REQ.CLAIMS.UPDATE"
 	ClaimsDeleteSubject = "$SYS.REQ.CLAIMS.DELETE"
+	ClaimsListSubject   = "$SYS.REQ.CLAIMS.LIST"
+	// AccountLookupSubject is formatted with the public key of the account
+	AccountLookupSubject = "$SYS.REQ.ACCOUNT.%s.CLAIMS.LOOKUP"
 )
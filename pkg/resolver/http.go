@@ -0,0 +1,176 @@
+package resolver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/rs/zerolog/log"
+)
+
+var _ AccountResolver = &HTTPResolver{}
+
+// HTTPResolver pushes accounts to an account server with a REST API,
+// e.g. the nats-account-server. Account JWTs are posted to
+// <url>/accounts/<pubkey> and deleted from the same location.
+type HTTPResolver struct {
+	url    string
+	server string
+	client *http.Client
+}
+
+// NewHTTPResolver creates a resolver for the http(s) account server at url
+func NewHTTPResolver(serverURL string, opts Options) (*HTTPResolver, error) {
+	if !isValidURL(serverURL) || !IsHTTPURL(serverURL) {
+		return nil, fmt.Errorf("invalid url: %s, expected a http or https url", serverURL)
+	}
+	u, err := url.Parse(strings.TrimSpace(serverURL))
+	if err != nil {
+		return nil, err
+	}
+
+	tlsOpts, err := opts.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsOpts != nil {
+		transport.TLSClientConfig = tlsOpts
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &HTTPResolver{
+		url:    strings.TrimSuffix(u.String(), "/"),
+		server: u.Host,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}, nil
+}
+
+// PushAccount posts the account JWT to <url>/accounts/<pubkey>
+func (r *HTTPResolver) PushAccount(accountName string, accountJWT []byte) (*Result, error) {
+	claims, err := jwt.DecodeAccountClaims(string(accountJWT))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	message, err := r.request(http.MethodPost, claims.Subject, accountJWT)
+	if err != nil {
+		result.Failed = append(result.Failed, ServerResult{Server: r.server, Error: err.Error()})
+		return result, err
+	}
+	log.Info().Msgf("pushed %q to account server %s: %s", accountName, r.server, message)
+	result.Acknowledged = append(result.Acknowledged, ServerResult{Server: r.server, Message: message})
+	return result, nil
+}
+
+// DeleteAccounts sends a delete request for each account to <url>/accounts/<pubkey>.
+// The body of the request is a JWT signed by the operator listing the accounts.
+func (r *HTTPResolver) DeleteAccounts(acc []string, operatorKp nkeys.KeyPair) (*Result, error) {
+	defer operatorKp.Wipe()
+	pub, err := operatorKp.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	claim := jwt.NewGenericClaims(pub)
+	claim.Data["accounts"] = acc
+	deleteJwt, err := claim.Encode(operatorKp)
+	if err != nil {
+		log.Error().Msgf("Could not encode delete request (err:%v)", err)
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, account := range acc {
+		if _, err := r.request(http.MethodDelete, account, []byte(deleteJwt)); err != nil {
+			result.Failed = append(result.Failed, ServerResult{Server: r.server, Error: err.Error()})
+			return result, err
+		}
+	}
+	message := fmt.Sprintf("deleted %d accounts", len(acc))
+	log.Info().Msgf("pruned account server %s: %s", r.server, message)
+	result.Acknowledged = append(result.Acknowledged, ServerResult{Server: r.server, Message: message})
+	return result, nil
+}
+
+// ListAccounts is not supported by http account servers
+func (r *HTTPResolver) ListAccounts() ([]string, error) {
+	return nil, fmt.Errorf("listing accounts is not supported by http account servers")
+}
+
+// LookupAccount returns the account JWT stored at <url>/accounts/<pubkey>.
+// An empty string is returned if the account is unknown.
+func (r *HTTPResolver) LookupAccount(account string) (string, error) {
+	resp, err := r.client.Get(r.accountURL(account))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", nil
+	case resp.StatusCode >= 300:
+		return "", fmt.Errorf("account server responded with %s", resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// CloseConnection closes idle connections to the account server
+func (r *HTTPResolver) CloseConnection() {
+	if r != nil && r.client != nil {
+		r.client.CloseIdleConnections()
+	}
+}
+
+func (r *HTTPResolver) accountURL(account string) string {
+	return fmt.Sprintf("%s/accounts/%s", r.url, url.PathEscape(account))
+}
+
+// request sends the body to the account url and returns the response message
+func (r *HTTPResolver) request(method string, account string, body []byte) (string, error) {
+	req, err := http.NewRequest(method, r.accountURL(account), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/jwt")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		log.Error().Msgf("resolver: failed to %s %s: %v", strings.ToLower(method), account, err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	message := strings.TrimSpace(string(data))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Error().Msgf("resolver: account server %s responded with %s: %s", r.server, resp.Status, message)
+		if message == "" {
+			return "", fmt.Errorf("account server responded with %s", resp.Status)
+		}
+		return "", fmt.Errorf("account server responded with %s: %s", resp.Status, message)
+	}
+	if message == "" {
+		message = resp.Status
+	}
+	return message, nil
+}
@@ -0,0 +1,108 @@
+package resolver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAccountServer(t *testing.T) (*httptest.Server, map[string]string) {
+	var mu sync.Mutex
+	accounts := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		account := strings.TrimPrefix(r.URL.Path, "/jwt/v1/accounts/")
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		switch r.Method {
+		case http.MethodPost:
+			accounts[account] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			jwt, ok := accounts[account]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(jwt))
+		case http.MethodDelete:
+			if _, ok := accounts[account]; !ok {
+				http.Error(w, "account not found", http.StatusNotFound)
+				return
+			}
+			delete(accounts, account)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, accounts
+}
+
+func TestHTTPResolver(t *testing.T) {
+	assert := assert.New(t)
+	srv, accounts := newTestAccountServer(t)
+
+	operatorKp, err := nkeys.CreateOperator()
+	assert.NoError(err)
+	accountKp, err := nkeys.CreateAccount()
+	assert.NoError(err)
+	accountPub, err := accountKp.PublicKey()
+	assert.NoError(err)
+	accountJWT, err := jwt.NewAccountClaims(accountPub).Encode(operatorKp)
+	assert.NoError(err)
+
+	// only http urls are accepted
+	_, err = NewHTTPResolver("nats://localhost:4222", Options{})
+	assert.Error(err)
+
+	r, err := NewHTTPResolver(srv.URL+"/jwt/v1/", Options{})
+	assert.NoError(err)
+	defer r.CloseConnection()
+
+	// push
+	result, err := r.PushAccount("ac1", []byte(accountJWT))
+	assert.NoError(err)
+	assert.True(result.QuorumMet(1))
+	assert.Equal(accountJWT, accounts[accountPub])
+
+	// lookup
+	serverJWT, err := r.LookupAccount(accountPub)
+	assert.NoError(err)
+	assert.Equal(accountJWT, serverJWT)
+
+	// listing is not supported
+	_, err = r.ListAccounts()
+	assert.Error(err)
+
+	// delete
+	result, err = r.DeleteAccounts([]string{accountPub}, operatorKp)
+	assert.NoError(err)
+	assert.True(result.QuorumMet(1))
+	assert.Empty(accounts)
+	serverJWT, err = r.LookupAccount(accountPub)
+	assert.NoError(err)
+	assert.Empty(serverJWT)
+
+	// deleting unknown accounts fails
+	operatorKp, err = nkeys.CreateOperator()
+	assert.NoError(err)
+	result, err = r.DeleteAccounts([]string{accountPub}, operatorKp)
+	assert.Error(err)
+	assert.Len(result.Failed, 1)
+	assert.False(result.QuorumMet(1))
+}
+
+func TestIsHTTPURL(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsHTTPURL("http://localhost:9090"))
+	assert.True(IsHTTPURL(" HTTPS://localhost:9090"))
+	assert.False(IsHTTPURL("nats://localhost:4222"))
+	assert.False(IsHTTPURL("tls://localhost:4222"))
+}
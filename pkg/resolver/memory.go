@@ -0,0 +1,148 @@
+package resolver
+
+import (
+	"sync"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// MemoryServer is the server name the MemoryResolver acknowledges requests with
+const MemoryServer = "memory"
+
+var _ AccountResolver = &MemoryResolver{}
+
+// Push is a push recorded by the MemoryResolver
+type Push struct {
+	// Name of the account
+	Name string
+	// Public key of the account
+	Account string
+	// JWT of the account
+	JWT string
+}
+
+// MemoryResolver is an in-memory AccountResolver for tests.
+// It keeps the pushed accounts and records all pushes and deletes.
+type MemoryResolver struct {
+	mu       sync.Mutex
+	accounts map[string]string
+	pushes   []Push
+	deletes  []string
+	err      error
+}
+
+// NewMemoryResolver creates an empty in-memory resolver
+func NewMemoryResolver() *MemoryResolver {
+	return &MemoryResolver{
+		accounts: map[string]string{},
+	}
+}
+
+// SetError makes all following requests fail with err.
+// nil lets the requests succeed again.
+func (r *MemoryResolver) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// Pushes returns all recorded pushes in order
+func (r *MemoryResolver) Pushes() []Push {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Push{}, r.pushes...)
+}
+
+// Deletes returns the public keys of all deleted accounts in order
+func (r *MemoryResolver) Deletes() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.deletes...)
+}
+
+// Accounts returns the account JWTs indexed by the public key of the account
+func (r *MemoryResolver) Accounts() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	accounts := map[string]string{}
+	for k, v := range r.accounts {
+		accounts[k] = v
+	}
+	return accounts
+}
+
+// PushAccount stores the account JWT
+func (r *MemoryResolver) PushAccount(accountName string, accountJWT []byte) (*Result, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return memoryFailed(r.err), r.err
+	}
+	claims, err := jwt.DecodeAccountClaims(string(accountJWT))
+	if err != nil {
+		return memoryFailed(err), err
+	}
+	r.accounts[claims.Subject] = string(accountJWT)
+	r.pushes = append(r.pushes, Push{
+		Name:    accountName,
+		Account: claims.Subject,
+		JWT:     string(accountJWT),
+	})
+	return memoryAcknowledged("jwt updated"), nil
+}
+
+// DeleteAccounts removes the accounts
+func (r *MemoryResolver) DeleteAccounts(acc []string, operatorKp nkeys.KeyPair) (*Result, error) {
+	defer operatorKp.Wipe()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return memoryFailed(r.err), r.err
+	}
+	for _, account := range acc {
+		delete(r.accounts, account)
+		r.deletes = append(r.deletes, account)
+	}
+	return memoryAcknowledged("jwts deleted"), nil
+}
+
+// ListAccounts returns the public keys of the stored accounts
+func (r *MemoryResolver) ListAccounts() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	accounts := []string{}
+	for account := range r.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// LookupAccount returns the stored account JWT.
+// An empty string is returned if the account is unknown.
+func (r *MemoryResolver) LookupAccount(account string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return "", r.err
+	}
+	return r.accounts[account], nil
+}
+
+// CloseConnection does nothing, the stored accounts are kept
+func (r *MemoryResolver) CloseConnection() {}
+
+func memoryAcknowledged(message string) *Result {
+	return &Result{
+		Acknowledged: []ServerResult{{Server: MemoryServer, Message: message}},
+	}
+}
+
+func memoryFailed(err error) *Result {
+	return &Result{
+		Failed: []ServerResult{{Server: MemoryServer, Error: err.Error()}},
+	}
+}
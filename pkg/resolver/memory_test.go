@@ -0,0 +1,50 @@
+package resolver
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryResolver(t *testing.T) {
+	assert := assert.New(t)
+
+	operatorKp, err := nkeys.CreateOperator()
+	assert.NoError(err)
+	accountKp, err := nkeys.CreateAccount()
+	assert.NoError(err)
+	accountPub, err := accountKp.PublicKey()
+	assert.NoError(err)
+	accountJWT, err := jwt.NewAccountClaims(accountPub).Encode(operatorKp)
+	assert.NoError(err)
+
+	r := NewMemoryResolver()
+	result, err := r.PushAccount("ac1", []byte(accountJWT))
+	assert.NoError(err)
+	assert.True(result.QuorumMet(1))
+	assert.Equal([]Push{{Name: "ac1", Account: accountPub, JWT: accountJWT}}, r.Pushes())
+
+	accounts, err := r.ListAccounts()
+	assert.NoError(err)
+	assert.Equal([]string{accountPub}, accounts)
+	serverJWT, err := r.LookupAccount(accountPub)
+	assert.NoError(err)
+	assert.Equal(accountJWT, serverJWT)
+
+	// failing requests are not recorded
+	r.SetError(fmt.Errorf("unavailable"))
+	result, err = r.PushAccount("ac1", []byte(accountJWT))
+	assert.Error(err)
+	assert.False(result.QuorumMet(1))
+	assert.Len(r.Pushes(), 1)
+	r.SetError(nil)
+
+	result, err = r.DeleteAccounts([]string{accountPub}, operatorKp)
+	assert.NoError(err)
+	assert.True(result.QuorumMet(1))
+	assert.Equal([]string{accountPub}, r.Deletes())
+	assert.Empty(r.Accounts())
+}
@@ -1,21 +1,62 @@
 package resolver
 
 import (
+	"time"
+
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nkeys"
 )
 
+const (
+	// DefaultTimeout is the time to wait for the responses of the nats-servers
+	DefaultTimeout = time.Second
+)
+
+// AccountResolver distributes account JWTs to an account server
+type AccountResolver interface {
+	// PushAccount creates or updates the account
+	PushAccount(accountName string, accountJWT []byte) (*Result, error)
+	// DeleteAccounts deletes the accounts with the given public keys.
+	// The request is signed with the operator key pair.
+	DeleteAccounts(acc []string, operatorKp nkeys.KeyPair) (*Result, error)
+	// ListAccounts returns the public keys of the accounts known to the account server
+	ListAccounts() ([]string, error)
+	// LookupAccount returns the account JWT the account server knows for the public key
+	LookupAccount(account string) (string, error)
+	// CloseConnection releases the connection to the account server
+	CloseConnection()
+}
+
+var _ AccountResolver = &Resolver{}
+
+// Resolver pushes accounts to the nats-servers using the system account
 type Resolver struct {
-	nc *nats.Conn
+	nc      *nats.Conn
+	timeout time.Duration
+}
+
+// Options configure the connection to the account server
+type Options struct {
+	// TLS secures the connection with the given certificates
+	TLS *TLSConfig
+	// Timeout to wait for the responses of the nats-servers.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration
 }
 
-func NewResolver(url string, userJWT []byte, userKp nkeys.KeyPair) (*Resolver, error) {
-	nc, err := createConnection(url, userJWT, userKp)
+// NewResolver connects to the account server
+func NewResolver(url string, userJWT []byte, userKp nkeys.KeyPair, opts Options) (*Resolver, error) {
+	nc, err := createConnection(url, userJWT, userKp, opts.TLS)
 	if err != nil {
 		return nil, err
 	}
 
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
 	return &Resolver{
-		nc: nc,
+		nc:      nc,
+		timeout: timeout,
 	}, nil
 }
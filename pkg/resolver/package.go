@@ -5,7 +5,7 @@ package resolver
 // General prerequsites
 // ---------------------
 // -> There must be a sys account and a sys account user with permissions:
-// AllowPub: $SYS.REQ.CLAIMS.LIST, $SYS.REQ.CLAIMS.UPDATE, $SYS.REQ.CLAIMS.DELETE
+// AllowPub: $SYS.REQ.CLAIMS.LIST, $SYS.REQ.CLAIMS.UPDATE, $SYS.REQ.CLAIMS.DELETE, $SYS.REQ.ACCOUNT.*.CLAIMS.LOOKUP
 // AllowSub: _INBOX.>
 // -> open a nats connection with the JWT and SEED of this sys account user
 //    with options for (optional TLS certs), timeouts, reconnect handlers, etc.
@@ -21,3 +21,20 @@ package resolver
 // Get JWT of account to be deleted
 // create a PUB on subject $SYS.REQ.CLAIMS.DELETE with the JWT as []byte
 // After sending the PUB with the JWT wait for responses using SubscribeSync() within a defined time frame (e.g. 1 second). This information can be used to inform how many servers got the publish.
+
+// Listing accounts:
+// -----------------
+// create a PUB on subject $SYS.REQ.CLAIMS.LIST without payload
+// Each server responds with the public keys of the accounts it knows. The lists are merged.
+// The JWT a server knows for an account can be requested on $SYS.REQ.ACCOUNT.<pubkey>.CLAIMS.LOOKUP
+
+// HTTP account servers:
+// ---------------------
+// Account servers with a REST API (e.g. the nats-account-server) are reached via http(s).
+// Accounts are added with a POST of the JWT to <url>/accounts/<pubkey>,
+// deleted with a DELETE to the same location and looked up with a GET.
+// Listing accounts is not supported.
+
+// Testing:
+// --------
+// The MemoryResolver keeps the pushed accounts in memory and records all pushes and deletes.
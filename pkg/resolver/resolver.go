@@ -18,6 +18,7 @@ package resolver
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/nats-io/jwt/v2"
@@ -26,41 +27,86 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func (r *Resolver) multiRequest(subject string, operation string, reqData []byte, respHandler func(srv string, data interface{})) int {
+// ServerResult is the response of a single nats-server to a request
+type ServerResult struct {
+	Server  string `json:"server"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Result collects the responses of all nats-servers to a request
+type Result struct {
+	Acknowledged []ServerResult `json:"acknowledged,omitempty"`
+	Failed       []ServerResult `json:"failed,omitempty"`
+}
+
+// QuorumMet returns true if at least quorum servers acknowledged the request
+func (r *Result) QuorumMet(quorum int) bool {
+	if quorum < 1 {
+		quorum = 1
+	}
+	return r != nil && len(r.Acknowledged) >= quorum
+}
+
+// noAcknowledgementError returns the error for a request no nats-server
+// acknowledged. The errors of the servers that responded are included.
+func (r *Result) noAcknowledgementError() error {
+	if r == nil || len(r.Failed) == 0 {
+		return fmt.Errorf("no response from server")
+	}
+	errs := []string{}
+	for _, f := range r.Failed {
+		errs = append(errs, fmt.Sprintf("%s: %s", f.Server, f.Error))
+	}
+	return fmt.Errorf("no server acknowledged: %s", strings.Join(errs, "; "))
+}
+
+func (r *Resolver) multiRequest(subject string, operation string, reqData []byte, respHandler func(srv string, data interface{})) *Result {
+	result := &Result{}
 	ib := nats.NewInbox()
 	sub, err := r.nc.SubscribeSync(ib)
 	if err != nil {
 		log.Error().Msgf("resolver: failed to subscribe to response subject: %v", err)
-		return 0
+		return result
 	}
+	defer sub.Unsubscribe()
 	if err := r.nc.PublishRequest(subject, ib, reqData); err != nil {
 		log.Error().Msgf("resolver: failed to %s: %v", operation, err)
-		return 0
+		return result
 	}
-	responses := 0
 	now := time.Now()
 	start := now
-	end := start.Add(time.Second)
+	end := start.Add(r.timeout)
 	for ; end.After(now); now = time.Now() { // try with decreasing timeout until we dont get responses
-		if resp, err := sub.NextMsg(end.Sub(now)); err != nil {
-			if err != nats.ErrTimeout || responses == 0 {
+		resp, err := sub.NextMsg(end.Sub(now))
+		if err != nil {
+			if err != nats.ErrTimeout || len(result.Acknowledged)+len(result.Failed) == 0 {
 				log.Error().Msgf("resolver: failed to get response to %s: %v", operation, err)
 			}
-		} else if ok, srv, data := processResponse(resp); ok {
-			respHandler(srv, data)
-			responses++
+			break
+		}
+		srv, data, err := processResponse(resp)
+		if err != nil {
+			result.Failed = append(result.Failed, ServerResult{
+				Server: srv,
+				Error:  err.Error(),
+			})
 			continue
 		}
-		break
+		respHandler(srv, data)
+		result.Acknowledged = append(result.Acknowledged, ServerResult{
+			Server:  srv,
+			Message: responseMessage(data),
+		})
 	}
-	return responses
+	return result
 }
 
-func (r *Resolver) DeleteAccounts(acc []string, operatorKp nkeys.KeyPair) (int, error) {
+func (r *Resolver) DeleteAccounts(acc []string, operatorKp nkeys.KeyPair) (*Result, error) {
 	defer operatorKp.Wipe()
 	pub, err := operatorKp.PublicKey()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	claim := jwt.NewGenericClaims(pub)
@@ -69,36 +115,65 @@ func (r *Resolver) DeleteAccounts(acc []string, operatorKp nkeys.KeyPair) (int,
 	pruneJwt, err := claim.Encode(operatorKp)
 	if err != nil {
 		log.Error().Msgf("Could not encode delete request (err:%v)", err)
-		return 0, err
+		return nil, err
 	}
 	respPrune := r.multiRequest(ClaimsDeleteSubject, "delete", []byte(pruneJwt),
 		func(srv string, data interface{}) {
-			if dataMap, ok := data.(map[string]interface{}); ok {
-				log.Info().Msgf("pruned nats-server %s: %s", srv, dataMap["message"])
-			} else {
-				log.Info().Msgf("pruned nats-server %s: %v", srv, data)
-			}
+			log.Info().Msgf("pruned nats-server %s: %s", srv, responseMessage(data))
 		})
 
 	return respPrune, nil
 }
 
-func (r *Resolver) PushAccount(accountName string, accountJWT []byte) error {
+func (r *Resolver) PushAccount(accountName string, accountJWT []byte) (*Result, error) {
 	resp := r.multiRequest(ClaimsUpdateSubject, "create", accountJWT,
 		func(srv string, data interface{}) {
-			if dataMap, ok := data.(map[string]interface{}); ok {
-				log.Info().Msgf("pushed %q to nats-server %s: %s", accountName, srv, dataMap["message"])
-			} else {
-				log.Info().Msgf("pushed %q to nats-server %s: %v", accountName, srv, data)
+			log.Info().Msgf("pushed %q to nats-server %s: %s", accountName, srv, responseMessage(data))
+		})
+	if len(resp.Acknowledged) == 0 {
+		return resp, resp.noAcknowledgementError()
+	}
+	return resp, nil
+}
+
+// ListAccounts returns the public keys of all accounts known to the
+// responding nats-servers. The lists of all servers are merged.
+func (r *Resolver) ListAccounts() ([]string, error) {
+	known := map[string]bool{}
+	accounts := []string{}
+	resp := r.multiRequest(ClaimsListSubject, "list", nil,
+		func(srv string, data interface{}) {
+			list, ok := data.([]interface{})
+			if !ok {
+				log.Error().Msgf("nats-server %s responded with unexpected account list: %v", srv, data)
+				return
+			}
+			for _, e := range list {
+				if account, ok := e.(string); ok && !known[account] {
+					known[account] = true
+					accounts = append(accounts, account)
+				}
 			}
 		})
-	if resp == 0 {
-		return fmt.Errorf("no response from server")
+	if len(resp.Acknowledged) == 0 {
+		return nil, resp.noAcknowledgementError()
+	}
+	return accounts, nil
+}
+
+// LookupAccount returns the account JWT the nats-servers know for the public key.
+// An empty string is returned if the account is unknown.
+func (r *Resolver) LookupAccount(account string) (string, error) {
+	resp, err := r.nc.Request(fmt.Sprintf(AccountLookupSubject, account), nil, r.timeout)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	return string(resp.Data), nil
 }
 
-func processResponse(resp *nats.Msg) (bool, string, interface{}) {
+// processResponse returns the name of the responding server and
+// its data or the error the server responded with
+func processResponse(resp *nats.Msg) (string, interface{}, error) {
 	// ServerInfo copied from nats-server, refresh as needed. Error and Data are mutually exclusive
 	serverResp := struct {
 		Server *struct {
@@ -119,14 +194,32 @@ func processResponse(resp *nats.Msg) (bool, string, interface{}) {
 	}{}
 	if err := json.Unmarshal(resp.Data, &serverResp); err != nil {
 		log.Error().Msgf("resolver: failed to parse response: %v data: %s", err, string(resp.Data))
-	} else if srvName := serverResp.Server.Name; srvName == "" {
+		return "", nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	srvName := ""
+	if serverResp.Server != nil {
+		srvName = serverResp.Server.Name
+	}
+	if srvName == "" {
 		log.Error().Msgf("resolver: server responded without server name in info: %s", string(resp.Data))
+		return "", nil, fmt.Errorf("server responded without server name")
 	} else if err := serverResp.Error; err != nil {
 		log.Error().Msgf("resolver: server %s responded with error: %s", srvName, err.Description)
+		return srvName, nil, fmt.Errorf("%s", err.Description)
 	} else if data := serverResp.Data; data == nil {
 		log.Error().Msgf("resolver: server %s responded without data: %s", srvName, string(resp.Data))
+		return srvName, nil, fmt.Errorf("server responded without data")
 	} else {
-		return true, srvName, data
+		return srvName, data, nil
+	}
+}
+
+// responseMessage returns the message of a server response
+func responseMessage(data interface{}) string {
+	if dataMap, ok := data.(map[string]interface{}); ok {
+		if message, ok := dataMap["message"].(string); ok {
+			return message
+		}
 	}
-	return false, "", nil
+	return fmt.Sprintf("%v", data)
 }
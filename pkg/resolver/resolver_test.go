@@ -0,0 +1,66 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	srv, data, err := processResponse(&nats.Msg{
+		Data: []byte(`{"server":{"name":"n1"},"data":{"message":"jwt updated"}}`),
+	})
+	assert.NoError(err)
+	assert.Equal("n1", srv)
+	assert.Equal("jwt updated", responseMessage(data))
+
+	srv, _, err = processResponse(&nats.Msg{
+		Data: []byte(`{"server":{"name":"n2"},"error":{"description":"jwt validation failed","code":500}}`),
+	})
+	assert.EqualError(err, "jwt validation failed")
+	assert.Equal("n2", srv)
+
+	_, _, err = processResponse(&nats.Msg{
+		Data: []byte(`{"data":{"message":"no server"}}`),
+	})
+	assert.Error(err)
+
+	_, _, err = processResponse(&nats.Msg{
+		Data: []byte(`invalid`),
+	})
+	assert.Error(err)
+}
+
+func TestResultQuorum(t *testing.T) {
+	assert := assert.New(t)
+
+	var empty *Result
+	assert.False(empty.QuorumMet(1))
+
+	result := &Result{
+		Acknowledged: []ServerResult{{Server: "n1"}, {Server: "n2"}},
+		Failed:       []ServerResult{{Server: "n3", Error: "failed"}},
+	}
+	assert.True(result.QuorumMet(0))
+	assert.True(result.QuorumMet(2))
+	assert.False(result.QuorumMet(3))
+}
+
+func TestResultNoAcknowledgementError(t *testing.T) {
+	assert := assert.New(t)
+
+	var empty *Result
+	assert.EqualError(empty.noAcknowledgementError(), "no response from server")
+	assert.EqualError((&Result{}).noAcknowledgementError(), "no response from server")
+
+	result := &Result{
+		Failed: []ServerResult{
+			{Server: "n1", Error: "jwt validation failed"},
+			{Server: "n2", Error: "server responded without data"},
+		},
+	}
+	assert.EqualError(result.noAcknowledgementError(), "no server acknowledged: n1: jwt validation failed; n2: server responded without data")
+}
@@ -0,0 +1,59 @@
+package resolver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// TLSConfig holds the PEM encoded certificates used to
+// connect to the account server
+type TLSConfig struct {
+	// CA bundle to verify the server certificate.
+	// If not set, the system roots are used.
+	CACert string `json:"caCert,omitempty"`
+	// Client certificate for mutual TLS
+	ClientCert string `json:"clientCert,omitempty"`
+	// Private key of the client certificate
+	ClientKey string `json:"clientKey,omitempty"`
+	// Overrides the server name used to verify the server certificate
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// IsEmpty returns true if no TLS option is set
+func (c *TLSConfig) IsEmpty() bool {
+	return c == nil || *c == TLSConfig{}
+}
+
+// Config builds the tls.Config for the connection to the account server.
+// nil is returned if no TLS option is set.
+func (c *TLSConfig) Config() (*tls.Config, error) {
+	if c.IsEmpty() {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, fmt.Errorf("invalid ca certificate")
+		}
+		config.RootCAs = pool
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		if c.ClientCert == "" || c.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
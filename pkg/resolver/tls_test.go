@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nats"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return string(cert), string(privateKey)
+}
+
+func TestTLSConfig(t *testing.T) {
+	assert := assert.New(t)
+	cert, key := createTestCertificate(t)
+
+	// no tls settings
+	var empty *TLSConfig
+	config, err := empty.Config()
+	assert.NoError(err)
+	assert.Nil(config)
+	config, err = (&TLSConfig{}).Config()
+	assert.NoError(err)
+	assert.Nil(config)
+
+	// ca, client certificate and server name
+	config, err = (&TLSConfig{
+		CACert:     cert,
+		ClientCert: cert,
+		ClientKey:  key,
+		ServerName: "nats.example.com",
+	}).Config()
+	assert.NoError(err)
+	assert.NotNil(config.RootCAs)
+	assert.Len(config.Certificates, 1)
+	assert.Equal("nats.example.com", config.ServerName)
+
+	// invalid settings
+	_, err = (&TLSConfig{CACert: "invalid"}).Config()
+	assert.Error(err)
+	_, err = (&TLSConfig{ClientCert: cert}).Config()
+	assert.Error(err)
+	_, err = (&TLSConfig{ClientCert: cert, ClientKey: "invalid"}).Config()
+	assert.Error(err)
+}
+
+func TestIsNatsUrl(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(isNatsUrl("nats://localhost:4222"))
+	assert.True(isNatsUrl("tls://localhost:4222"))
+	assert.False(isNatsUrl("http://localhost:9090"))
+	assert.True(isValidURL("tls://localhost:4222"))
+}
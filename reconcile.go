@@ -0,0 +1,191 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// ReconcileOptions configures the periodic reconciliation
+// of the accounts known to the account server
+// +k8s:deepcopy-gen=true
+type ReconcileOptions struct {
+	// Enabled compares the accounts of the account server with the account issues
+	Enabled bool `json:"enabled"`
+	// Prune deletes accounts from the account server that are not managed by Vault
+	Prune bool `json:"prune,omitempty"`
+	// Push pushes missing and stale accounts to the account server
+	Push bool `json:"push,omitempty"`
+}
+
+// AccountServerDrift is the result of the last reconciliation
+type AccountServerDrift struct {
+	// Time of the reconciliation
+	Time int64 `json:"time"`
+	// Public keys of accounts known to the account server but not managed by Vault
+	Unknown []string `json:"unknown,omitempty"`
+	// Accounts managed by Vault but unknown to the account server
+	Missing []string `json:"missing,omitempty"`
+	// Accounts the account server knows with a different JWT
+	Stale []string `json:"stale,omitempty"`
+	// Accounts deleted from the account server
+	Pruned []string `json:"pruned,omitempty"`
+	// Accounts pushed to the account server
+	Pushed []string `json:"pushed,omitempty"`
+	// Errors of the reconciliation, if any
+	Errors []string `json:"errors,omitempty"`
+}
+
+type managedAccount struct {
+	Name string
+	JWT  string
+}
+
+// reconcileAccountServer compares the accounts of the account server with the
+// account issues of the operator, stores the drift in the operator issue and
+// prunes or pushes accounts if configured.
+func reconcileAccountServer(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) error {
+	if op.AccountServerReconcile == nil || !op.AccountServerReconcile.Enabled {
+		return nil
+	}
+	if !op.SyncAccountServer || op.Claims.AccountServerURL == "" {
+		log.Warn().Str("operator", op.Operator).
+			Msg("account server sync disabled - can't reconcile account server")
+		return nil
+	}
+
+	managed, err := listManagedAccounts(ctx, storage, op.Operator)
+	if err != nil {
+		return err
+	}
+
+	resolver, err := openAccountResolver(ctx, storage, op)
+	if err != nil {
+		return storeAccountServerDrift(ctx, storage, op, &AccountServerDrift{
+			Time:   time.Now().Unix(),
+			Errors: []string{err.Error()},
+		})
+	} else if resolver == nil {
+		return nil
+	}
+	defer resolver.CloseConnection()
+
+	drift := &AccountServerDrift{Time: time.Now().Unix()}
+	serverAccounts, err := resolver.ListAccounts()
+	if err != nil {
+		drift.Errors = append(drift.Errors, err.Error())
+		return storeAccountServerDrift(ctx, storage, op, drift)
+	}
+	computeAccountServerDrift(drift, managed, serverAccounts, resolver.LookupAccount)
+
+	if op.AccountServerReconcile.Prune && len(drift.Unknown) > 0 {
+		operatorKeyPair, err := readOperatorOnlineKeyPair(ctx, storage, op.Operator)
+		if err != nil {
+			return err
+		}
+		if operatorKeyPair != nil {
+			result, err := resolver.DeleteAccounts(drift.Unknown, operatorKeyPair)
+			err = op.AccountServerSync.checkQuorum(result, err)
+			if err != nil {
+				drift.Errors = append(drift.Errors, fmt.Sprintf("prune failed: %s", err))
+			} else {
+				drift.Pruned = drift.Unknown
+			}
+		}
+	}
+
+	if op.AccountServerReconcile.Push {
+		for _, account := range managed {
+			name := account.Name
+			if !containsString(drift.Missing, name) && !containsString(drift.Stale, name) {
+				continue
+			}
+			result, err := resolver.PushAccount(name, []byte(account.JWT))
+			err = op.AccountServerSync.checkQuorum(result, err)
+			if err != nil {
+				drift.Errors = append(drift.Errors, fmt.Sprintf("push of %s failed: %s", name, err))
+				continue
+			}
+			drift.Pushed = append(drift.Pushed, name)
+		}
+		sort.Strings(drift.Pushed)
+	}
+
+	if !drift.isEmpty() {
+		log.Warn().Str("operator", op.Operator).
+			Strs("unknown", drift.Unknown).Strs("missing", drift.Missing).Strs("stale", drift.Stale).
+			Msg("account server drift detected")
+	}
+	return storeAccountServerDrift(ctx, storage, op, drift)
+}
+
+// computeAccountServerDrift compares the managed accounts, indexed by their
+// public key, with the accounts known to the account server.
+func computeAccountServerDrift(drift *AccountServerDrift, managed map[string]managedAccount, serverAccounts []string, lookup func(string) (string, error)) {
+	known := map[string]bool{}
+	for _, publicKey := range serverAccounts {
+		known[publicKey] = true
+		account, ok := managed[publicKey]
+		if !ok {
+			drift.Unknown = append(drift.Unknown, publicKey)
+			continue
+		}
+		serverJWT, err := lookup(publicKey)
+		if err != nil || serverJWT != account.JWT {
+			drift.Stale = append(drift.Stale, account.Name)
+		}
+	}
+	for publicKey, account := range managed {
+		if !known[publicKey] {
+			drift.Missing = append(drift.Missing, account.Name)
+		}
+	}
+	sort.Strings(drift.Unknown)
+	sort.Strings(drift.Missing)
+	sort.Strings(drift.Stale)
+}
+
+// listManagedAccounts returns the account JWTs of the operator
+// indexed by the public key of the account
+func listManagedAccounts(ctx context.Context, storage logical.Storage, operator string) (map[string]managedAccount, error) {
+	accounts, err := listAccountIssues(ctx, storage, operator)
+	if err != nil {
+		return nil, err
+	}
+
+	managed := map[string]managedAccount{}
+	for _, account := range accounts {
+		accJWT, err := readAccountJWT(ctx, storage, JWTParameters{
+			Operator: operator,
+			Account:  account,
+		})
+		if err != nil {
+			return nil, err
+		} else if accJWT == nil {
+			continue
+		}
+		claims, err := jwt.DecodeAccountClaims(accJWT.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode jwt of account %s: %s", account, err)
+		}
+		managed[claims.Subject] = managedAccount{
+			Name: account,
+			JWT:  accJWT.JWT,
+		}
+	}
+	return managed, nil
+}
+
+func storeAccountServerDrift(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage, drift *AccountServerDrift) error {
+	op.AccountServerDrift = drift
+	return storeInStorage(ctx, storage, getOperatorIssuePath(op.Operator), op)
+}
+
+func (d *AccountServerDrift) isEmpty() bool {
+	return len(d.Unknown) == 0 && len(d.Missing) == 0 && len(d.Stale) == 0
+}
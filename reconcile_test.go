@@ -0,0 +1,228 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/stm"
+)
+
+func TestComputeAccountServerDrift(t *testing.T) {
+	managed := map[string]managedAccount{
+		"AINSYNC":  {Name: "insync", JWT: "jwt1"},
+		"ASTALE":   {Name: "stale", JWT: "jwt2"},
+		"AMISSING": {Name: "missing", JWT: "jwt3"},
+	}
+	server := map[string]string{
+		"AINSYNC":  "jwt1",
+		"ASTALE":   "old",
+		"AUNKNOWN": "jwt4",
+	}
+	lookup := func(publicKey string) (string, error) {
+		if jwt, ok := server[publicKey]; ok {
+			return jwt, nil
+		}
+		return "", fmt.Errorf("not found")
+	}
+
+	drift := &AccountServerDrift{}
+	computeAccountServerDrift(drift, managed, []string{"AINSYNC", "ASTALE", "AUNKNOWN"}, lookup)
+	assert.Equal(t, []string{"AUNKNOWN"}, drift.Unknown)
+	assert.Equal(t, []string{"missing"}, drift.Missing)
+	assert.Equal(t, []string{"stale"}, drift.Stale)
+	assert.False(t, drift.isEmpty())
+
+	drift = &AccountServerDrift{}
+	computeAccountServerDrift(drift, map[string]managedAccount{
+		"AINSYNC": {Name: "insync", JWT: "jwt1"},
+	}, []string{"AINSYNC"}, lookup)
+	assert.True(t, drift.isEmpty())
+}
+
+func TestReconcileAccountServerOptions(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"accountServerReconcile": map[string]interface{}{
+				"enabled": true,
+				"prune":   true,
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1/account/ac1",
+		Storage:   reqStorage,
+		Data:      map[string]interface{}{},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	// the account jwts are indexed by their public key
+	managed, err := listManagedAccounts(context.Background(), reqStorage, "op1")
+	assert.NoError(t, err)
+	assert.Len(t, managed, 1)
+	for publicKey, account := range managed {
+		assert.Equal(t, "ac1", account.Name)
+		assert.Equal(t, byte('A'), publicKey[0])
+	}
+
+	// without account server sync nothing is reconciled
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: reqStorage})
+	assert.NoError(t, err)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+	var current IssueOperatorData
+	stm.MapToStruct(resp.Data, &current)
+	assert.Equal(t, &ReconcileOptions{Enabled: true, Prune: true}, current.AccountServerReconcile)
+	assert.Nil(t, current.AccountServerDrift)
+}
+
+func TestReconcileAccountServerPrune(t *testing.T) {
+	b, reqStorage, memory := getTestBackendWithResolver(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "issue/operator/op1",
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"syncAccountServer": true,
+			"accountServerReconcile": map[string]interface{}{
+				"enabled": true,
+				"prune":   true,
+			},
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"accountServerUrl": "nats://localhost:4222",
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.IsError())
+
+	// an account the account server knows but vault doesn't manage
+	operatorKp, err := nkeys.CreateOperator()
+	assert.NoError(t, err)
+	accountKp, err := nkeys.CreateAccount()
+	assert.NoError(t, err)
+	unknown, err := accountKp.PublicKey()
+	assert.NoError(t, err)
+	unknownJWT, err := jwt.NewAccountClaims(unknown).Encode(operatorKp)
+	assert.NoError(t, err)
+	_, err = memory.PushAccount("unknown", []byte(unknownJWT))
+	assert.NoError(t, err)
+
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: reqStorage})
+	assert.NoError(t, err)
+
+	issue, err := readOperatorIssue(context.Background(), reqStorage, IssueOperatorParameters{
+		Operator: "op1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{unknown}, issue.AccountServerDrift.Unknown)
+	assert.Equal(t, []string{unknown}, issue.AccountServerDrift.Pruned)
+	assert.Empty(t, issue.AccountServerDrift.Errors)
+	assert.Equal(t, []string{unknown}, memory.Deletes())
+}
+
+// failingWritesResolver lists the accounts of the memory resolver
+// but refuses to push or delete accounts
+type failingWritesResolver struct {
+	*resolver.MemoryResolver
+}
+
+func (r *failingWritesResolver) PushAccount(accountName string, accountJWT []byte) (*resolver.Result, error) {
+	return nil, fmt.Errorf("push refused")
+}
+
+func (r *failingWritesResolver) DeleteAccounts(acc []string, operatorKp nkeys.KeyPair) (*resolver.Result, error) {
+	operatorKp.Wipe()
+	return nil, fmt.Errorf("delete refused")
+}
+
+func TestReconcileAccountServerReportsAllErrors(t *testing.T) {
+	b, reqStorage, memory := getTestBackendWithResolver(t)
+
+	request := func(path string, data map[string]interface{}) {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+	}
+	request("issue/operator/op1", map[string]interface{}{
+		"syncAccountServer": true,
+		"accountServerReconcile": map[string]interface{}{
+			"enabled": true,
+			"prune":   true,
+			"push":    true,
+		},
+		"claims": map[string]interface{}{
+			"operator": map[string]interface{}{
+				"accountServerUrl": "nats://localhost:4222",
+			},
+		},
+	})
+	request("issue/operator/op1/account/ac1", map[string]interface{}{})
+	request("issue/operator/op1/account/ac2", map[string]interface{}{})
+
+	// the account server lost both accounts and knows an unknown one
+	operatorKp, err := nkeys.CreateOperator()
+	assert.NoError(t, err)
+	accountKp, err := nkeys.CreateAccount()
+	assert.NoError(t, err)
+	unknown, err := accountKp.PublicKey()
+	assert.NoError(t, err)
+	unknownJWT, err := jwt.NewAccountClaims(unknown).Encode(operatorKp)
+	assert.NoError(t, err)
+	accounts := []string{}
+	for account := range memory.Accounts() {
+		accounts = append(accounts, account)
+	}
+	_, err = memory.DeleteAccounts(accounts, operatorKp)
+	assert.NoError(t, err)
+	_, err = memory.PushAccount("unknown", []byte(unknownJWT))
+	assert.NoError(t, err)
+
+	b.accountResolver = func(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) (resolver.AccountResolver, error) {
+		return &failingWritesResolver{memory}, nil
+	}
+	err = b.periodicFunc(context.Background(), &logical.Request{Storage: reqStorage})
+	assert.NoError(t, err)
+
+	issue, err := readOperatorIssue(context.Background(), reqStorage, IssueOperatorParameters{
+		Operator: "op1",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"prune failed: delete refused",
+		"push of ac1 failed: push refused",
+		"push of ac2 failed: push refused",
+	}, issue.AccountServerDrift.Errors)
+	assert.Empty(t, issue.AccountServerDrift.Pruned)
+	assert.Empty(t, issue.AccountServerDrift.Pushed)
+}
@@ -0,0 +1,188 @@
+package natsbackend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+// With StrictSigningKeyUsage set in the operator claims nats-server refuses
+// accounts signed with the operator identity key and users signed with an
+// account identity key. An operator with an offline identity key can't sign
+// accounts with it either. Issues that don't name a signing key are signed
+// with the configured default signing key instead, or refused if there is none.
+
+// operatorRequiresSigningKey returns if the accounts of the operator
+// have to be signed with an operator signing nkey
+func operatorRequiresSigningKey(issue *IssueOperatorStorage) bool {
+	return issue.OfflineIdentityKey != "" || issue.Claims.StrictSigningKeyUsage
+}
+
+// accountRequiresSigningKey returns if the users of the accounts of the
+// operator have to be signed with an account signing nkey
+func accountRequiresSigningKey(issue *IssueOperatorStorage) bool {
+	return issue.Claims.StrictSigningKeyUsage
+}
+
+// checkOperatorSigningKeyUsage checks that an operator that requires
+// signing keys has one that can sign the accounts created by the plugin
+func checkOperatorSigningKeyUsage(params IssueOperatorParameters) error {
+	issue := IssueOperatorStorage{
+		Operator:           params.Operator,
+		OfflineIdentityKey: params.OfflineIdentityKey,
+		DefaultSigningKey:  params.DefaultSigningKey,
+		Claims:             params.Claims,
+	}
+	if params.DefaultSigningKey != "" {
+		if isSigningPublicKey(params.DefaultSigningKey, nkeys.PrefixByteOperator) {
+			return fmt.Errorf("default signing key %s must be managed by Vault", params.DefaultSigningKey)
+		}
+		if !containsString(params.Claims.SigningKeys, params.DefaultSigningKey) {
+			return fmt.Errorf("default signing key %s is not a signing key of the operator", params.DefaultSigningKey)
+		}
+	}
+	_, err := getDefaultOperatorSigningKey(issue)
+	return err
+}
+
+// checkAccountDefaultSigningKey checks that the default signing key
+// of an account is one of its signing keys
+func checkAccountDefaultSigningKey(params IssueAccountParameters) error {
+	if params.DefaultSigningKey == "" {
+		return nil
+	}
+	if isSigningPublicKey(params.DefaultSigningKey, nkeys.PrefixByteAccount) {
+		return fmt.Errorf("default signing key %s must be managed by Vault", params.DefaultSigningKey)
+	}
+	if !containsString(getAccountSigningKeyNames(&params.Claims), params.DefaultSigningKey) {
+		return fmt.Errorf("default signing key %s is not a signing key of the account", params.DefaultSigningKey)
+	}
+	return nil
+}
+
+// getDefaultOperatorSigningKey returns the signing key that signs the
+// accounts created by the plugin, i.e. the system account. That is the
+// configured default signing key or the first signing key managed by Vault.
+// The identity key is used unless the operator requires a signing key.
+func getDefaultOperatorSigningKey(issue IssueOperatorStorage) (string, error) {
+	if !operatorRequiresSigningKey(&issue) {
+		return "", nil
+	}
+	if issue.DefaultSigningKey != "" {
+		return issue.DefaultSigningKey, nil
+	}
+	for _, signingKey := range issue.Claims.SigningKeys {
+		if !isSigningPublicKey(signingKey, nkeys.PrefixByteOperator) {
+			return signingKey, nil
+		}
+	}
+	return "", fmt.Errorf("operator %s requires at least one operator signing key managed by Vault", issue.Operator)
+}
+
+// resolveAccountSigningKey returns the operator signing key an account
+// is signed with. An empty string means the operator identity key.
+// Accounts without useSigningKey are signed like the system account.
+func resolveAccountSigningKey(ctx context.Context, storage logical.Storage, operator string, useSigningKey string) (string, error) {
+	if useSigningKey != "" {
+		return useSigningKey, nil
+	}
+	issue, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{Operator: operator})
+	if err != nil {
+		return "", err
+	}
+	if issue == nil {
+		return "", nil
+	}
+	return getDefaultOperatorSigningKey(*issue)
+}
+
+// resolveUserSigningKey returns the account signing key a user
+// is signed with. An empty string means the account identity key.
+func resolveUserSigningKey(ctx context.Context, storage logical.Storage, operator string, account string, useSigningKey string) (string, error) {
+	if useSigningKey != "" {
+		return useSigningKey, nil
+	}
+	op, err := readOperatorIssue(ctx, storage, IssueOperatorParameters{Operator: operator})
+	if err != nil {
+		return "", err
+	}
+	if op == nil || !accountRequiresSigningKey(op) {
+		return "", nil
+	}
+	issue, err := readAccountIssue(ctx, storage, IssueAccountParameters{
+		Operator: operator,
+		Account:  account,
+	})
+	if err != nil {
+		return "", err
+	}
+	if issue != nil && issue.DefaultSigningKey != "" {
+		return issue.DefaultSigningKey, nil
+	}
+	return "", fmt.Errorf("operator %s requires users to be signed with an account signing key: set useSigningKey or the defaultSigningKey of account %s", operator, account)
+}
+
+// isAccountIdentityKeySigned reports if the stored account jwt is signed
+// with the operator identity key although the operator requires signing keys
+func isAccountIdentityKeySigned(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage, account string) (bool, error) {
+	if op == nil || !operatorRequiresSigningKey(op) {
+		return false, nil
+	}
+	token, err := readAccountJWT(ctx, storage, JWTParameters{Operator: op.Operator, Account: account})
+	if err != nil || token == nil {
+		return false, err
+	}
+	claims, err := jwt.DecodeAccountClaims(token.JWT)
+	if err != nil {
+		return false, err
+	}
+	operatorPublicKey, err := readOperatorPublicKey(ctx, storage, op.Operator)
+	if err != nil {
+		return false, err
+	}
+	return claims.Issuer == operatorPublicKey, nil
+}
+
+// isUserIdentityKeySigned reports if the stored user jwt is signed with the
+// account identity key although the operator requires signing keys
+func isUserIdentityKeySigned(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage, account string, user string) (bool, error) {
+	if op == nil || !accountRequiresSigningKey(op) {
+		return false, nil
+	}
+	token, err := readUserJWT(ctx, storage, JWTParameters{Operator: op.Operator, Account: account, User: user})
+	if err != nil || token == nil {
+		return false, err
+	}
+	claims, err := jwt.DecodeUserClaims(token.JWT)
+	if err != nil {
+		return false, err
+	}
+	return claims.IssuerAccount == "", nil
+}
+
+// listIdentityKeySignedAccounts returns the accounts of the operator whose
+// stored jwt is signed with the operator identity key although the
+// operator requires signing keys
+func listIdentityKeySignedAccounts(ctx context.Context, storage logical.Storage, op *IssueOperatorStorage) ([]string, error) {
+	if !operatorRequiresSigningKey(op) {
+		return nil, nil
+	}
+	accounts, err := listAccountIssues(ctx, storage, op.Operator)
+	if err != nil {
+		return nil, err
+	}
+	var signed []string
+	for _, account := range accounts {
+		ok, err := isAccountIdentityKeySigned(ctx, storage, op, account)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			signed = append(signed, account)
+		}
+	}
+	return signed, nil
+}
@@ -0,0 +1,173 @@
+package natsbackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/nats-io/jwt/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrictSigningKeyUsage(t *testing.T) {
+	b, reqStorage := getTestBackend(t)
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   reqStorage,
+			Data:      data,
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	strictOperator := func(operator string, data map[string]interface{}) *logical.Response {
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		data["claims"] = map[string]interface{}{
+			"operator": map[string]interface{}{
+				"signingKeys":           []interface{}{"opsk1"},
+				"strictSigningKeyUsage": true,
+			},
+		}
+		return request(logical.CreateOperation, "issue/operator/"+operator, data)
+	}
+	userClaims := func(operator string, account string, user string) *jwt.UserClaims {
+		token, err := readUserJWT(context.Background(), reqStorage, JWTParameters{Operator: operator, Account: account, User: user})
+		assert.NoError(t, err)
+		claims, err := jwt.DecodeUserClaims(token.JWT)
+		assert.NoError(t, err)
+		return claims
+	}
+
+	t.Run("Test strict operator requires a signing key", func(t *testing.T) {
+		resp := request(logical.CreateOperation, "issue/operator/op1", map[string]interface{}{
+			"claims": map[string]interface{}{
+				"operator": map[string]interface{}{
+					"strictSigningKeyUsage": true,
+				},
+			},
+		})
+		assert.True(t, resp.IsError())
+
+		resp = strictOperator("op1", map[string]interface{}{"defaultSigningKey": "unknown"})
+		assert.True(t, resp.IsError())
+	})
+
+	t.Run("Test system account of a strict operator", func(t *testing.T) {
+		resp := strictOperator("op1", map[string]interface{}{"createSystemAccount": true})
+		assert.False(t, resp.IsError())
+
+		sys, err := readAccountIssue(context.Background(), reqStorage, IssueAccountParameters{Operator: "op1", Account: DefaultSysAccountName})
+		assert.NoError(t, err)
+		assert.Equal(t, "opsk1", sys.UseSigningKey)
+		assert.Equal(t, DefaultSysAccountSigningKey, sys.DefaultSigningKey)
+
+		// the push user is signed with the signing key of the system account
+		sysPublicKey, err := readAccountPublicKey(context.Background(), reqStorage, "op1", DefaultSysAccountName)
+		assert.NoError(t, err)
+		claims := userClaims("op1", DefaultSysAccountName, DefaultPushUser)
+		assert.Equal(t, sysPublicKey, claims.IssuerAccount)
+	})
+
+	t.Run("Test users are refused without signing key", func(t *testing.T) {
+		resp := request(logical.CreateOperation, "issue/operator/op1/account/ac1", map[string]interface{}{
+			"useSigningKey": "opsk1",
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"signingKeys": []interface{}{"acsk1"},
+				},
+			},
+		})
+		assert.False(t, resp.IsError())
+
+		resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1/user/u1", map[string]interface{}{})
+		assert.True(t, resp.IsError())
+		assert.EqualError(t, resp.Error(), AddingIssueFailedError+": operator op1 requires users to be signed with an account signing key: set useSigningKey or the defaultSigningKey of account ac1")
+		resp = request(logical.CreateOperation, "issue/operator/op1/account/ac1/user/u1", map[string]interface{}{
+			"useSigningKey": "acsk1",
+		})
+		assert.False(t, resp.IsError())
+	})
+
+	t.Run("Test default signing keys are used", func(t *testing.T) {
+		resp := strictOperator("op1", map[string]interface{}{
+			"createSystemAccount": true,
+			"defaultSigningKey":   "opsk1",
+		})
+		assert.False(t, resp.IsError())
+		resp = request(logical.CreateOperation, "issue/operator/op1/account/ac2", map[string]interface{}{
+			"defaultSigningKey": "acsk1",
+			"claims": map[string]interface{}{
+				"account": map[string]interface{}{
+					"signingKeys": []interface{}{"acsk1"},
+				},
+			},
+		})
+		assert.False(t, resp.IsError())
+
+		operatorSigningKey, err := readNkeyPublicKey(context.Background(), reqStorage, getOperatorSigningNkeyPath("op1", "opsk1"))
+		assert.NoError(t, err)
+		token, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{Operator: "op1", Account: "ac2"})
+		assert.NoError(t, err)
+		accountClaims, err := jwt.DecodeAccountClaims(token.JWT)
+		assert.NoError(t, err)
+		assert.Equal(t, operatorSigningKey, accountClaims.Issuer)
+
+		resp = request(logical.CreateOperation, "issue/operator/op1/account/ac2/user/u1", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+		accountSigningKey, err := readNkeyPublicKey(context.Background(), reqStorage, getAccountSigningNkeyPath("op1", "ac2", "acsk1"))
+		assert.NoError(t, err)
+		assert.Equal(t, accountSigningKey, userClaims("op1", "ac2", "u1").Issuer)
+
+		// the default has to be a signing key of the account
+		resp = request(logical.CreateOperation, "issue/operator/op1/account/ac3", map[string]interface{}{
+			"defaultSigningKey": "acsk1",
+		})
+		assert.True(t, resp.IsError())
+	})
+
+	t.Run("Test identity key signed jwts are flagged", func(t *testing.T) {
+		resp := request(logical.CreateOperation, "issue/operator/op2", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+		resp = request(logical.CreateOperation, "issue/operator/op2/account/ac1", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+		resp = request(logical.CreateOperation, "issue/operator/op2/account/ac1/user/u1", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+
+		resp = request(logical.ReadOperation, "issue/operator/op2/account/ac1", nil)
+		assert.False(t, resp.IsError())
+		assert.Nil(t, resp.Data["status"].(map[string]interface{})["identityKeySigned"])
+
+		// the accounts are re-issued with the first signing key,
+		// the users of accounts without signing keys are not
+		resp = strictOperator("op2", nil)
+		assert.False(t, resp.IsError())
+
+		resp = request(logical.ReadOperation, "issue/operator/op2", nil)
+		assert.False(t, resp.IsError())
+		assert.Nil(t, resp.Data["status"].(map[string]interface{})["identityKeySignedAccounts"])
+
+		resp = request(logical.ReadOperation, "issue/operator/op2/account/ac1", nil)
+		assert.False(t, resp.IsError())
+		assert.Nil(t, resp.Data["status"].(map[string]interface{})["identityKeySigned"])
+
+		resp = request(logical.ReadOperation, "issue/operator/op2/account/ac1/user/u1", nil)
+		assert.False(t, resp.IsError())
+		assert.Equal(t, true, resp.Data["status"].(map[string]interface{})["identityKeySigned"])
+
+		// accounts of a strict operator without default signing key
+		// can still be updated
+		resp = request(logical.UpdateOperation, "issue/operator/op2/account/ac1", map[string]interface{}{})
+		assert.False(t, resp.IsError())
+		operatorSigningKey, err := readNkeyPublicKey(context.Background(), reqStorage, getOperatorSigningNkeyPath("op2", "opsk1"))
+		assert.NoError(t, err)
+		token, err := readAccountJWT(context.Background(), reqStorage, JWTParameters{Operator: "op2", Account: "ac1"})
+		assert.NoError(t, err)
+		accountClaims, err := jwt.DecodeAccountClaims(token.JWT)
+		assert.NoError(t, err)
+		assert.Equal(t, operatorSigningKey, accountClaims.Issuer)
+	})
+}
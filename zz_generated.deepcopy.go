@@ -21,12 +21,54 @@ limitations under the License.
 
 package natsbackend
 
-import ()
+import (
+	"github.com/edgefarm/vault-plugin-secrets-nats/pkg/resolver"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AccountServerSyncOptions) DeepCopyInto(out *AccountServerSyncOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AccountServerSyncOptions.
+func (in *AccountServerSyncOptions) DeepCopy() *AccountServerSyncOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(AccountServerSyncOptions)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthCalloutConfig) DeepCopyInto(out *AuthCalloutConfig) {
+	*out = *in
+	if in.AuthUsers != nil {
+		in, out := &in.AuthUsers, &out.AuthUsers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthCalloutConfig.
+func (in *AuthCalloutConfig) DeepCopy() *AuthCalloutConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthCalloutConfig)
+	in.DeepCopyInto(out)
+	return out
+}
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IssueAccountParameters) DeepCopyInto(out *IssueAccountParameters) {
 	*out = *in
 	in.Claims.DeepCopyInto(&out.Claims)
+	if in.AuthCallout != nil {
+		in, out := &in.AuthCallout, &out.AuthCallout
+		*out = new(AuthCalloutConfig)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssueAccountParameters.
@@ -42,6 +84,21 @@ func (in *IssueAccountParameters) DeepCopy() *IssueAccountParameters {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IssueOperatorParameters) DeepCopyInto(out *IssueOperatorParameters) {
 	*out = *in
+	if in.AccountServerTLS != nil {
+		in, out := &in.AccountServerTLS, &out.AccountServerTLS
+		*out = new(resolver.TLSConfig)
+		**out = **in
+	}
+	if in.AccountServerReconcile != nil {
+		in, out := &in.AccountServerReconcile, &out.AccountServerReconcile
+		*out = new(ReconcileOptions)
+		**out = **in
+	}
+	if in.AccountServerSync != nil {
+		in, out := &in.AccountServerSync, &out.AccountServerSync
+		*out = new(AccountServerSyncOptions)
+		**out = **in
+	}
 	in.Claims.DeepCopyInto(&out.Claims)
 }
 
@@ -70,3 +127,18 @@ func (in *IssueUserParameters) DeepCopy() *IssueUserParameters {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReconcileOptions) DeepCopyInto(out *ReconcileOptions) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReconcileOptions.
+func (in *ReconcileOptions) DeepCopy() *ReconcileOptions {
+	if in == nil {
+		return nil
+	}
+	out := new(ReconcileOptions)
+	in.DeepCopyInto(out)
+	return out
+}